@@ -4,12 +4,21 @@ go 1.16
 
 require (
 	github.com/lucas-clemente/quic-go v0.22.1
-	github.com/mengelbart/rtq-go v0.1.1-0.20210913160810-c84302426051
 	github.com/mengelbart/scream-go v0.3.0
 	github.com/pion/interceptor v0.0.13-0.20210819152811-ea60e4df22b3
 	github.com/pion/logging v0.2.2
-	github.com/pion/rtcp v1.2.7
-	github.com/pion/rtp v1.7.2
+	github.com/pion/rtcp v1.2.14
+	github.com/pion/rtp v1.8.7
+	github.com/pion/srtp/v2 v2.0.18
+	github.com/pion/transport/v2 v2.2.10 // indirect
+	golang.org/x/crypto v0.14.0 // indirect
+	golang.org/x/mod v0.11.0 // indirect
+	golang.org/x/net v0.17.0 // indirect
+	golang.org/x/sys v0.13.0
+	golang.org/x/text v0.13.0 // indirect
+	golang.org/x/tools v0.10.0 // indirect
 )
 
-replace github.com/lucas-clemente/quic-go v0.22.1 => github.com/mengelbart/quic-go v0.7.1-0.20210909103716-3e25d1c2cf91
+// third_party/quic-go is the fork github.com/mengelbart/quic-go at
+// 3e25d1c2cf91 with the congestion controller selectable in quic.Config.
+replace github.com/lucas-clemente/quic-go v0.22.1 => ./third_party/quic-go
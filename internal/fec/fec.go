@@ -0,0 +1,243 @@
+// Package fec provides interceptors which protect RTP streams with XOR
+// parity packets in the FlexFEC format with flexible masks (RFC 8627) and
+// recover lost packets from them.
+package fec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/pion/interceptor"
+)
+
+const (
+	rtpHeaderLength = 12
+	// fecHeaderLength is the length of the FEC header up to the first
+	// mask.
+	fecHeaderLength = 10
+	// maxOffset is the largest sequence number offset which fits in a
+	// flexible mask.
+	maxOffset = 109
+	// maxMaskLength is the length of a flexible mask covering maxOffset.
+	maxMaskLength = 14
+	// csrcLength is the length of the CSRC carrying the protected SSRC.
+	csrcLength = 4
+
+	// Overhead is the largest number of bytes an FEC packet is longer than
+	// the longest packet it protects.
+	Overhead = csrcLength + fecHeaderLength + maxMaskLength
+)
+
+// ErrInvalidFECPacket is returned when parsing an FEC packet which does not
+// follow RFC 8627 or uses features which are not supported, e.g. fixed
+// masks or several protected SSRCs.
+var ErrInvalidFECPacket = errors.New("invalid FEC packet")
+
+// fecAttributeKey is the key of the SSRC of the protected stream in the
+// attributes of an FEC stream.
+type fecAttributeKey struct{}
+
+// SetFEC marks a stream as the FEC stream which protects the stream with
+// SSRC mediaSSRC.
+func SetFEC(attributes interceptor.Attributes, mediaSSRC uint32) interceptor.Attributes {
+	if attributes == nil {
+		attributes = interceptor.Attributes{}
+	}
+	attributes[fecAttributeKey{}] = mediaSSRC
+	return attributes
+}
+
+// GetFEC returns the SSRC stored by SetFEC and whether the stream is an FEC
+// stream.
+func GetFEC(attributes interceptor.Attributes) (uint32, bool) {
+	mediaSSRC, ok := attributes[fecAttributeKey{}].(uint32)
+	return mediaSSRC, ok
+}
+
+// LossSource provides the fraction of packets lost on the path, usually
+// observed by a congestion controller.
+type LossSource interface {
+	LossRate() float64
+}
+
+// repair holds the XOR of the protected packets of an FEC packet.
+type repair struct {
+	// header is the XOR of the first two bytes of the RTP headers.
+	header [2]byte
+	length uint16
+	ts     uint32
+	// payload is the XOR of the packets following the fixed RTP header.
+	payload []byte
+}
+
+// add XORs the marshaled RTP packet pkt into r.
+func (r *repair) add(pkt []byte) {
+	r.header[0] ^= pkt[0]
+	r.header[1] ^= pkt[1]
+	r.length ^= uint16(len(pkt) - rtpHeaderLength)
+	r.ts ^= binary.BigEndian.Uint32(pkt[4:8])
+	body := pkt[rtpHeaderLength:]
+	if len(body) > len(r.payload) {
+		r.payload = append(r.payload, make([]byte, len(body)-len(r.payload))...)
+	}
+	for i, b := range body {
+		r.payload[i] ^= b
+	}
+}
+
+// withoutExtension returns the marshaled RTP packet pkt without its header
+// extension. Extensions like the transport-wide sequence number may be added
+// after the packet was protected, so packets are protected and recovered
+// without them.
+func withoutExtension(pkt []byte) []byte {
+	if len(pkt) < rtpHeaderLength || pkt[0]&0x10 == 0 {
+		return pkt
+	}
+	offset := rtpHeaderLength + 4*int(pkt[0]&0x0F)
+	if len(pkt) < offset+4 {
+		return pkt
+	}
+	end := offset + 4 + 4*int(binary.BigEndian.Uint16(pkt[offset+2:]))
+	if len(pkt) < end {
+		return pkt
+	}
+	stripped := make([]byte, 0, len(pkt)-(end-offset))
+	stripped = append(stripped, pkt[:offset]...)
+	stripped = append(stripped, pkt[end:]...)
+	stripped[0] &^= 0x10
+	return stripped
+}
+
+// fecPacket is the payload of an FEC packet protecting a single SSRC.
+type fecPacket struct {
+	repair
+	base    uint16
+	offsets []uint16
+}
+
+// seqs returns the sequence numbers of the protected packets.
+func (p *fecPacket) seqs() []uint16 {
+	seqs := make([]uint16, len(p.offsets))
+	for i, offset := range p.offsets {
+		seqs[i] = p.base + offset
+	}
+	return seqs
+}
+
+// maskLength returns the length of the flexible mask which covers offsets up
+// to max.
+func maskLength(max uint16) int {
+	switch {
+	case max <= 14:
+		return 2
+	case max <= 45:
+		return 6
+	default:
+		return maxMaskLength
+	}
+}
+
+// maskBit returns the position of the bit of offset in a flexible mask,
+// which skips the k bits in front of the first and second part.
+func maskBit(offset uint16) int {
+	if offset > 14 {
+		return int(offset) + 2
+	}
+	return int(offset) + 1
+}
+
+// marshal returns the payload of the FEC packet. The offsets must be sorted
+// and not exceed maxOffset.
+func (p *fecPacket) marshal() []byte {
+	n := maskLength(p.offsets[len(p.offsets)-1])
+	buf := make([]byte, fecHeaderLength+n+len(p.payload))
+	// R and F are 0, the flexible mask is used.
+	buf[0] = p.header[0] & 0x3F
+	buf[1] = p.header[1]
+	binary.BigEndian.PutUint16(buf[2:], p.length)
+	binary.BigEndian.PutUint32(buf[4:], p.ts)
+	binary.BigEndian.PutUint16(buf[8:], p.base)
+	mask := buf[fecHeaderLength : fecHeaderLength+n]
+	for _, offset := range p.offsets {
+		bit := maskBit(offset)
+		mask[bit/8] |= 0x80 >> (bit % 8)
+	}
+	switch n {
+	case 2:
+		mask[0] |= 0x80
+	case 6:
+		mask[2] |= 0x80
+	}
+	copy(buf[fecHeaderLength+n:], p.payload)
+	return buf
+}
+
+// unmarshal parses the payload of an FEC packet.
+func (p *fecPacket) unmarshal(buf []byte) error {
+	if len(buf) < fecHeaderLength+2 {
+		return ErrInvalidFECPacket
+	}
+	if buf[0]&0xC0 != 0 {
+		return fmt.Errorf("%w: fixed masks are not supported", ErrInvalidFECPacket)
+	}
+	p.header[0] = buf[0] & 0x3F
+	p.header[1] = buf[1]
+	p.length = binary.BigEndian.Uint16(buf[2:])
+	p.ts = binary.BigEndian.Uint32(buf[4:])
+	p.base = binary.BigEndian.Uint16(buf[8:])
+	n := 2
+	if buf[fecHeaderLength]&0x80 == 0 {
+		n = 6
+		if len(buf) < fecHeaderLength+n {
+			return ErrInvalidFECPacket
+		}
+		if buf[fecHeaderLength+2]&0x80 == 0 {
+			n = maxMaskLength
+		}
+	}
+	if len(buf) < fecHeaderLength+n {
+		return ErrInvalidFECPacket
+	}
+	mask := buf[fecHeaderLength : fecHeaderLength+n]
+	p.offsets = p.offsets[:0]
+	for offset := uint16(0); offset <= maxOffset; offset++ {
+		bit := maskBit(offset)
+		if bit/8 >= n {
+			break
+		}
+		if mask[bit/8]&(0x80>>(bit%8)) != 0 {
+			p.offsets = append(p.offsets, offset)
+		}
+	}
+	if len(p.offsets) == 0 {
+		return fmt.Errorf("%w: empty mask", ErrInvalidFECPacket)
+	}
+	p.payload = buf[fecHeaderLength+n:]
+	return nil
+}
+
+// recover restores the packet with sequence number seq of the stream with
+// SSRC ssrc from p and the other protected packets.
+func (p *fecPacket) recover(seq uint16, ssrc uint32, others [][]byte) ([]byte, error) {
+	r := repair{
+		header:  p.header,
+		length:  p.length,
+		ts:      p.ts,
+		payload: append([]byte(nil), p.payload...),
+	}
+	for _, pkt := range others {
+		r.add(pkt)
+	}
+	if int(r.length) > len(r.payload) {
+		return nil, fmt.Errorf("%w: repair payload shorter than recovered packet", ErrInvalidFECPacket)
+	}
+	pkt := make([]byte, rtpHeaderLength+int(r.length))
+	pkt[0] = 0x80 | r.header[0]&0x3F
+	pkt[1] = r.header[1]
+	binary.BigEndian.PutUint16(pkt[2:], seq)
+	binary.BigEndian.PutUint32(pkt[4:], r.ts)
+	binary.BigEndian.PutUint32(pkt[8:], ssrc)
+	copy(pkt[rtpHeaderLength:], r.payload)
+	return pkt, nil
+}
@@ -0,0 +1,151 @@
+package fec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func marshalRTP(t *testing.T, seq uint16, ts uint32, marker bool, payload []byte) []byte {
+	t.Helper()
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			Marker:         marker,
+			PayloadType:    96,
+			SequenceNumber: seq,
+			Timestamp:      ts,
+			SSRC:           0x11223344,
+		},
+		Payload: payload,
+	}
+	buf, err := pkt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+func TestFECPacketRecover(t *testing.T) {
+	pkts := [][]byte{
+		marshalRTP(t, 65534, 1000, false, []byte{1, 2, 3, 4, 5}),
+		marshalRTP(t, 65535, 1000, false, []byte{6, 7}),
+		marshalRTP(t, 2, 4000, true, bytes.Repeat([]byte{8}, 300)),
+	}
+	p := &fecPacket{base: 65534, offsets: []uint16{0, 1, 4}}
+	for _, pkt := range pkts {
+		p.add(pkt)
+	}
+
+	var parsed fecPacket
+	if err := parsed.unmarshal(p.marshal()); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if got, want := parsed.seqs(), []uint16{65534, 65535, 2}; !equalSeqs(got, want) {
+		t.Fatalf("got protected sequence numbers %v, want %v", got, want)
+	}
+
+	for lost := range pkts {
+		var others [][]byte
+		for i, pkt := range pkts {
+			if i != lost {
+				others = append(others, pkt)
+			}
+		}
+		seq := parsed.seqs()[lost]
+		got, err := parsed.recover(seq, 0x11223344, others)
+		if err != nil {
+			t.Fatalf("failed to recover %v: %v", seq, err)
+		}
+		if !bytes.Equal(got, pkts[lost]) {
+			t.Errorf("recovered %v as %x, want %x", seq, got, pkts[lost])
+		}
+	}
+}
+
+func TestFECPacketMaskLengths(t *testing.T) {
+	for _, offsets := range [][]uint16{
+		{0},
+		{0, 14},
+		{3, 15, 45},
+		{0, 46, maxOffset},
+	} {
+		p := &fecPacket{base: 100, offsets: offsets}
+		p.add(marshalRTP(t, 100, 0, false, []byte{1}))
+		buf := p.marshal()
+		if got, want := len(buf), fecHeaderLength+maskLength(offsets[len(offsets)-1])+1; got != want {
+			t.Errorf("offsets %v: got %v bytes, want %v", offsets, got, want)
+		}
+		var parsed fecPacket
+		if err := parsed.unmarshal(buf); err != nil {
+			t.Fatalf("offsets %v: failed to unmarshal: %v", offsets, err)
+		}
+		if !equalSeqs(parsed.offsets, offsets) {
+			t.Errorf("got offsets %v, want %v", parsed.offsets, offsets)
+		}
+	}
+}
+
+func TestFECPacketUnmarshalInvalid(t *testing.T) {
+	valid := (&fecPacket{offsets: []uint16{0}}).marshal()
+	fixed := append([]byte(nil), valid...)
+	fixed[0] |= 0x40
+	empty := append([]byte(nil), valid...)
+	empty[fecHeaderLength] = 0x80
+	empty[fecHeaderLength+1] = 0
+
+	for name, buf := range map[string][]byte{
+		"short":       valid[:fecHeaderLength],
+		"fixed mask":  fixed,
+		"empty mask":  empty,
+		"cut in mask": valid[:fecHeaderLength+1],
+	} {
+		var p fecPacket
+		if err := p.unmarshal(buf); !errors.Is(err, ErrInvalidFECPacket) {
+			t.Errorf("%v: got error %v, want %v", name, err, ErrInvalidFECPacket)
+		}
+	}
+}
+
+func TestWithoutExtension(t *testing.T) {
+	pkt := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 7,
+			SSRC:           1,
+		},
+		Payload: []byte{1, 2, 3},
+	}
+	plain, err := pkt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkt.Header.SetExtension(1, []byte{0xAA, 0xBB}); err != nil {
+		t.Fatal(err)
+	}
+	extended, err := pkt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := withoutExtension(extended); !bytes.Equal(got, plain) {
+		t.Errorf("got %x, want %x", got, plain)
+	}
+	if got := withoutExtension(plain); !bytes.Equal(got, plain) {
+		t.Errorf("packet without extension changed to %x", got)
+	}
+}
+
+func equalSeqs(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
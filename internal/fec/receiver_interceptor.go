@@ -0,0 +1,203 @@
+package fec
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+)
+
+// ReceiverInterceptor recovers the lost packets of remote streams from the
+// FEC packets received on the FEC stream of the stream. FEC streams are
+// remote streams whose attributes were set by SetFEC. Recovered packets are
+// passed to the reader of the protected stream, so only interceptors bound
+// before the ReceiverInterceptor see them. Recovered packets have no header
+// extensions.
+type ReceiverInterceptor struct {
+	interceptor.NoOp
+	size int
+	log  logging.LeveledLogger
+
+	streams   map[uint32]*remoteStream
+	streamsMu sync.Mutex
+}
+
+type remoteStream struct {
+	ssrc uint32
+	// reader passes recovered packets to the interceptors bound before.
+	reader interceptor.RTPReader
+
+	mu sync.Mutex
+	// packets holds the received packets indexed by sequence number
+	// modulo the size of the buffer.
+	packets [][]byte
+	highest uint16
+	started bool
+	// pending are the FEC packets which protect more than one missing
+	// packet.
+	pending []*fecPacket
+}
+
+// NewReceiverInterceptor returns a new ReceiverInterceptor.
+func NewReceiverInterceptor(opts ...ReceiverOption) (*ReceiverInterceptor, error) {
+	r := &ReceiverInterceptor{
+		size:    1024,
+		log:     logging.NewDefaultLoggerFactory().NewLogger("fec_receiver"),
+		streams: map[uint32]*remoteStream{},
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BindRemoteStream lets you modify any incoming RTP packets. It is called once for per RemoteStream. The returned method
+// will be called once per rtp packet.
+func (r *ReceiverInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	if mediaSSRC, ok := GetFEC(info.Attributes); ok {
+		return r.bindFECStream(mediaSSRC, reader)
+	}
+
+	stream := &remoteStream{
+		ssrc:    info.SSRC,
+		reader:  reader,
+		packets: make([][]byte, r.size),
+	}
+	r.streamsMu.Lock()
+	r.streams[info.SSRC] = stream
+	r.streamsMu.Unlock()
+
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		if i < rtpHeaderLength {
+			return i, attr, nil
+		}
+		stream.mu.Lock()
+		stream.add(b[:i])
+		recovered := stream.recover()
+		stream.mu.Unlock()
+		r.push(stream, recovered)
+		return i, attr, nil
+	})
+}
+
+// bindFECStream collects the FEC packets read from an FEC stream for the
+// stream mediaSSRC and recovers its packets.
+func (r *ReceiverInterceptor) bindFECStream(mediaSSRC uint32, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		var header rtp.Header
+		n, err := header.Unmarshal(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+		r.streamsMu.Lock()
+		stream, ok := r.streams[mediaSSRC]
+		r.streamsMu.Unlock()
+		if !ok {
+			return i, attr, nil
+		}
+		p := &fecPacket{}
+		if err := p.unmarshal(append([]byte(nil), b[n:i]...)); err != nil {
+			r.log.Warnf("dropping FEC packet: %v", err)
+			return i, attr, nil
+		}
+		stream.mu.Lock()
+		stream.pending = append(stream.pending, p)
+		recovered := stream.recover()
+		stream.mu.Unlock()
+		r.push(stream, recovered)
+		return i, attr, nil
+	})
+}
+
+// UnbindRemoteStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (r *ReceiverInterceptor) UnbindRemoteStream(info *interceptor.StreamInfo) {
+	r.streamsMu.Lock()
+	delete(r.streams, info.SSRC)
+	r.streamsMu.Unlock()
+}
+
+// push passes the recovered packets to the reader of stream.
+func (r *ReceiverInterceptor) push(stream *remoteStream, recovered [][]byte) {
+	for _, pkt := range recovered {
+		if _, _, err := stream.reader.Read(pkt, interceptor.Attributes{}); err != nil {
+			r.log.Warnf("failed passing recovered packet: %+v", err)
+		}
+	}
+}
+
+// add stores a copy of the packet pkt without its header extension, s.mu
+// must be held.
+func (s *remoteStream) add(pkt []byte) {
+	seq := binary.BigEndian.Uint16(pkt[2:])
+	s.packets[int(seq)%len(s.packets)] = append([]byte(nil), withoutExtension(pkt)...)
+	if !s.started || seq-s.highest < 1<<15 {
+		s.highest = seq
+		s.started = true
+	}
+}
+
+// get returns the packet with sequence number seq or nil if it is missing,
+// s.mu must be held.
+func (s *remoteStream) get(seq uint16) []byte {
+	pkt := s.packets[int(seq)%len(s.packets)]
+	if pkt == nil || binary.BigEndian.Uint16(pkt[2:]) != seq {
+		return nil
+	}
+	return pkt
+}
+
+// recover restores the packets protected by the pending FEC packets which
+// miss a single packet and returns them. Since a recovered packet may be
+// the last missing packet of another FEC packet, the pending FEC packets
+// are checked until no more packets are recovered. FEC packets which are
+// no longer needed or too old are removed. s.mu must be held.
+func (s *remoteStream) recover() [][]byte {
+	var recovered [][]byte
+	for progress := true; progress; {
+		progress = false
+		pending := s.pending[:0]
+		for _, p := range s.pending {
+			seqs := p.seqs()
+			if age := s.highest - seqs[len(seqs)-1]; s.started && age < 1<<15 && int(age) > len(s.packets)/2 {
+				continue
+			}
+			var missing []uint16
+			others := make([][]byte, 0, len(seqs))
+			for _, seq := range seqs {
+				if pkt := s.get(seq); pkt != nil {
+					others = append(others, pkt)
+				} else {
+					missing = append(missing, seq)
+				}
+			}
+			switch len(missing) {
+			case 0:
+				continue
+			case 1:
+				pkt, err := p.recover(missing[0], s.ssrc, others)
+				if err != nil {
+					continue
+				}
+				s.add(pkt)
+				recovered = append(recovered, pkt)
+				progress = true
+				continue
+			}
+			pending = append(pending, p)
+		}
+		s.pending = pending
+	}
+	return recovered
+}
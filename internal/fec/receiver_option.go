@@ -0,0 +1,30 @@
+package fec
+
+import (
+	"fmt"
+
+	"github.com/pion/logging"
+)
+
+// ReceiverOption can be used to configure ReceiverInterceptor.
+type ReceiverOption func(r *ReceiverInterceptor) error
+
+// ReceiverSize sets the number of packets of each stream kept to recover
+// lost packets.
+func ReceiverSize(size int) ReceiverOption {
+	return func(r *ReceiverInterceptor) error {
+		if size <= 2*maxOffset || size > 1<<15 {
+			return fmt.Errorf("invalid receive buffer size: %v", size)
+		}
+		r.size = size
+		return nil
+	}
+}
+
+// ReceiverLog sets a logger for the interceptor.
+func ReceiverLog(log logging.LeveledLogger) ReceiverOption {
+	return func(r *ReceiverInterceptor) error {
+		r.log = log
+		return nil
+	}
+}
@@ -0,0 +1,241 @@
+package fec
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+)
+
+// fecPayloadType is the payload type of FEC packets. Receivers associate FEC
+// streams with the protected stream by SSRC, so a single payload type is
+// used for all streams.
+const fecPayloadType = 98
+
+const (
+	// minLossRate is the loss rate below which no FEC packets are sent if
+	// the overhead is adapted to the loss rate.
+	minLossRate = 0.001
+	// maxColumns is the longest row protected by a single FEC packet if
+	// the overhead is adapted to the loss rate.
+	maxColumns = 48
+)
+
+// SenderInterceptor protects local streams with XOR parity packets which it
+// sends on the FEC stream of the stream. The packets of a stream are
+// arranged in blocks of columns x rows packets in sending order. Each row of
+// consecutive packets is protected by a row FEC packet and, if a block has
+// more than one row, each column is protected by a column FEC packet at the
+// end of the block (RFC 8627, section 1.1.4). FEC streams are local streams
+// whose attributes were set by SetFEC, they must be bound after their
+// protected stream. FEC packets are written to the FEC stream, so
+// interceptors bound before the SenderInterceptor see them as packets of the
+// FEC stream. Header extensions are not protected.
+type SenderInterceptor struct {
+	interceptor.NoOp
+	columns int
+	rows    int
+	loss    LossSource
+	log     logging.LeveledLogger
+
+	streams   map[uint32]*localStream
+	streamsMu sync.Mutex
+}
+
+type localStream struct {
+	mu    sync.Mutex
+	ssrc  uint32
+	block block
+	fec   *fecStream
+}
+
+// block holds the repairs of the packets of the current block of a stream.
+type block struct {
+	columns int
+	rows    int
+	base    uint16
+	count   int
+	row     repair
+	// columnRepairs are nil if the block has a single row.
+	columnRepairs []repair
+}
+
+// fecStream numbers and writes the FEC packets of a local stream.
+type fecStream struct {
+	ssrc      uint32
+	seq       uint16
+	rtpWriter interceptor.RTPWriter
+}
+
+// NewSenderInterceptor returns a new SenderInterceptor.
+func NewSenderInterceptor(opts ...SenderOption) (*SenderInterceptor, error) {
+	s := &SenderInterceptor{
+		columns: 10,
+		rows:    1,
+		log:     logging.NewDefaultLoggerFactory().NewLogger("fec_sender"),
+		streams: map[uint32]*localStream{},
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
+// will be called once per rtp packet.
+func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if mediaSSRC, ok := GetFEC(info.Attributes); ok {
+		s.streamsMu.Lock()
+		defer s.streamsMu.Unlock()
+		stream, ok := s.streams[mediaSSRC]
+		if !ok {
+			s.log.Warnf("no stream %v to protect with FEC stream %v", mediaSSRC, info.SSRC)
+			return writer
+		}
+		stream.mu.Lock()
+		stream.fec = &fecStream{
+			ssrc:      info.SSRC,
+			seq:       uint16(rand.Uint32()), // #nosec
+			rtpWriter: writer,
+		}
+		stream.mu.Unlock()
+		return writer
+	}
+
+	stream := &localStream{ssrc: info.SSRC}
+	s.streamsMu.Lock()
+	s.streams[info.SSRC] = stream
+	s.streamsMu.Unlock()
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err != nil {
+			return n, err
+		}
+		s.protect(stream, header, payload)
+		return n, nil
+	})
+}
+
+// UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (s *SenderInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	s.streamsMu.Lock()
+	delete(s.streams, info.SSRC)
+	s.streamsMu.Unlock()
+}
+
+// blockSize returns the size of the next block. If the overhead is adapted
+// to the loss rate, a row FEC packet is sent for about every 1/(2p) packets
+// at a loss rate p, so that a row rarely loses more than one packet. Once
+// the rows would get shorter than the configured columns, the configured
+// block is used, which adds column FEC packets if it has several rows.
+func (s *SenderInterceptor) blockSize() (columns, rows int) {
+	if s.loss == nil {
+		return s.columns, s.rows
+	}
+	p := s.loss.LossRate()
+	if p < minLossRate {
+		return 0, 0
+	}
+	columns = int(math.Round(1 / (2 * p)))
+	if columns <= s.columns {
+		return s.columns, s.rows
+	}
+	if columns > maxColumns {
+		columns = maxColumns
+	}
+	return columns, 1
+}
+
+// protect adds the packet to the block of stream and sends the FEC packets
+// of the rows and columns it completes.
+func (s *SenderInterceptor) protect(stream *localStream, header *rtp.Header, payload []byte) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+	if stream.fec == nil {
+		return
+	}
+	b := &stream.block
+	if b.count > 0 && header.SequenceNumber != b.base+uint16(b.count) {
+		// The sequence was interrupted, the packets of the block can
+		// no longer be recovered together.
+		b.count = 0
+	}
+	if b.count == 0 {
+		b.columns, b.rows = s.blockSize()
+		if b.columns == 0 {
+			return
+		}
+		b.base = header.SequenceNumber
+		b.row = repair{}
+		b.columnRepairs = nil
+		if b.rows > 1 {
+			b.columnRepairs = make([]repair, b.columns)
+		}
+	}
+
+	pkt := &rtp.Packet{Header: *header, Payload: payload}
+	buf, err := pkt.Marshal()
+	if err != nil {
+		s.log.Warnf("failed to protect packet: %+v", err)
+		b.count = 0
+		return
+	}
+	buf = withoutExtension(buf)
+	column, row := b.count%b.columns, b.count/b.columns
+	b.row.add(buf)
+	if b.columnRepairs != nil {
+		b.columnRepairs[column].add(buf)
+	}
+	b.count++
+
+	if column == b.columns-1 {
+		offsets := make([]uint16, b.columns)
+		for i := range offsets {
+			offsets[i] = uint16(i)
+		}
+		s.writeFEC(stream, header.Timestamp, &fecPacket{
+			repair:  b.row,
+			base:    b.base + uint16(row*b.columns),
+			offsets: offsets,
+		})
+		b.row = repair{}
+	}
+	if b.count < b.columns*b.rows {
+		return
+	}
+	for i, r := range b.columnRepairs {
+		offsets := make([]uint16, b.rows)
+		for j := range offsets {
+			offsets[j] = uint16(j * b.columns)
+		}
+		s.writeFEC(stream, header.Timestamp, &fecPacket{
+			repair:  r,
+			base:    b.base + uint16(i),
+			offsets: offsets,
+		})
+	}
+	b.count = 0
+}
+
+// writeFEC sends p on the FEC stream of stream with the timestamp ts of the
+// last protected packet, stream.mu must be held.
+func (s *SenderInterceptor) writeFEC(stream *localStream, ts uint32, p *fecPacket) {
+	header := rtp.Header{
+		Version:        2,
+		PayloadType:    fecPayloadType,
+		SequenceNumber: stream.fec.seq,
+		Timestamp:      ts,
+		SSRC:           stream.fec.ssrc,
+		CSRC:           []uint32{stream.ssrc},
+	}
+	stream.fec.seq++
+	if _, err := stream.fec.rtpWriter.Write(&header, p.marshal(), interceptor.Attributes{}); err != nil {
+		s.log.Warnf("failed sending FEC packet: %+v", err)
+	}
+}
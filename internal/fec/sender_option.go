@@ -0,0 +1,45 @@
+package fec
+
+import (
+	"fmt"
+
+	"github.com/pion/logging"
+)
+
+// SenderOption can be used to configure SenderInterceptor.
+type SenderOption func(s *SenderInterceptor) error
+
+// SenderBlock sets the number of columns and rows of the blocks of packets
+// which are protected together. A row FEC packet is sent for every columns
+// packets, and columns column FEC packets for every block if rows is larger
+// than 1.
+func SenderBlock(columns, rows int) SenderOption {
+	return func(s *SenderInterceptor) error {
+		if columns <= 0 || columns > maxOffset+1 {
+			return fmt.Errorf("invalid number of FEC columns: %v", columns)
+		}
+		if rows <= 0 || (rows-1)*columns > maxOffset {
+			return fmt.Errorf("invalid number of FEC rows for %v columns: %v", columns, rows)
+		}
+		s.columns = columns
+		s.rows = rows
+		return nil
+	}
+}
+
+// SenderLossSource adapts the overhead to the loss rate reported by loss,
+// using the block set by SenderBlock at high loss rates.
+func SenderLossSource(loss LossSource) SenderOption {
+	return func(s *SenderInterceptor) error {
+		s.loss = loss
+		return nil
+	}
+}
+
+// SenderLog sets a logger for the interceptor.
+func SenderLog(log logging.LeveledLogger) SenderOption {
+	return func(s *SenderInterceptor) error {
+		s.log = log
+		return nil
+	}
+}
@@ -12,7 +12,7 @@ void gstreamer_receive_start_mainloop(void) {
 static gboolean gstreamer_receive_bus_call(GstBus *bus, GstMessage *msg, gpointer data) {
     switch (GST_MESSAGE_TYPE(msg)) {
     case GST_MESSAGE_EOS: {
-        goHandleReceiveEOS();
+        goHandleReceiveEOS(GPOINTER_TO_INT(data));
         break;
     }
 
@@ -41,9 +41,9 @@ GstElement *gstreamer_receive_create_pipeline(char *pipeline) {
   return gst_parse_launch(pipeline, &error);
 }
 
-void gstreamer_receive_start_pipeline(GstElement *pipeline) {
+void gstreamer_receive_start_pipeline(GstElement *pipeline, int pipelineId) {
   GstBus *bus = gst_pipeline_get_bus(GST_PIPELINE(pipeline));
-  gst_bus_add_watch(bus, gstreamer_receive_bus_call, NULL);
+  gst_bus_add_watch(bus, gstreamer_receive_bus_call, GINT_TO_POINTER(pipelineId));
   gst_object_unref(bus);
 
   gst_element_set_state(pipeline, GST_STATE_PLAYING);
@@ -54,6 +54,9 @@ void gstreamer_receive_stop_pipeline(GstElement* pipeline) {
 }
 
 void gstreamer_receive_destroy_pipeline(GstElement* pipeline) {
+    GstBus *bus = gst_pipeline_get_bus(GST_PIPELINE(pipeline));
+    gst_bus_remove_watch(bus);
+    gst_object_unref(bus);
     gst_element_set_state(pipeline, GST_STATE_NULL);
     gst_object_unref(pipeline);
 }
@@ -67,3 +70,68 @@ void gstreamer_receive_push_buffer(GstElement *pipeline, void *buffer, int len)
     gst_object_unref(src);
   }
 }
+
+// gstreamer_receive_request_keyframes enables key frame requests of element
+// if it is a depayloader or decoder which supports them. It returns whether
+// the element supports them. Both properties were added in GStreamer 1.20.
+static gboolean gstreamer_receive_request_keyframes(GstElement *element) {
+  GObjectClass *klass = G_OBJECT_GET_CLASS(element);
+  gboolean supported = FALSE;
+  if (g_object_class_find_property(klass, "request-keyframe") != NULL) {
+    g_object_set(element, "request-keyframe", TRUE, NULL);
+    supported = TRUE;
+  }
+  if (g_object_class_find_property(klass, "automatic-request-sync-points") != NULL) {
+    g_object_set(element, "automatic-request-sync-points", TRUE, NULL);
+    supported = TRUE;
+  }
+  return supported;
+}
+
+static void gstreamer_receive_deep_element_added(GstBin *bin, GstBin *sub_bin, GstElement *element, gpointer data) {
+  gstreamer_receive_request_keyframes(element);
+}
+
+static GstPadProbeReturn gstreamer_receive_keyframe_probe(GstPad *pad, GstPadProbeInfo *info, gpointer data) {
+  GstEvent *event = GST_PAD_PROBE_INFO_EVENT(info);
+  if (GST_EVENT_TYPE(event) == GST_EVENT_CUSTOM_UPSTREAM) {
+    const GstStructure *s = gst_event_get_structure(event);
+    if (s != NULL && gst_structure_has_name(s, "GstForceKeyUnit")) {
+      gboolean all_headers = FALSE;
+      gst_structure_get_boolean(s, "all-headers", &all_headers);
+      goHandleKeyFrameRequest(GPOINTER_TO_INT(data), all_headers);
+    }
+  }
+  return GST_PAD_PROBE_OK;
+}
+
+// gstreamer_receive_handle_keyframe_requests enables key frame requests of
+// the depayloader and the decoders created by decodebin and passes the
+// force-key-unit events which arrive at the appsrc to Go. It returns whether
+// an element of the pipeline, i.e. the depayloader, supports key frame
+// requests. The decoders are only created when the stream starts.
+int gstreamer_receive_handle_keyframe_requests(GstElement *pipeline, int pipelineId) {
+  gboolean supported = FALSE;
+  GstIterator *it = gst_bin_iterate_recurse(GST_BIN(pipeline));
+  GValue item = G_VALUE_INIT;
+  while (gst_iterator_next(it, &item) == GST_ITERATOR_OK) {
+    if (gstreamer_receive_request_keyframes(GST_ELEMENT(g_value_get_object(&item)))) {
+      supported = TRUE;
+    }
+    g_value_reset(&item);
+  }
+  g_value_unset(&item);
+  gst_iterator_free(it);
+  g_signal_connect(pipeline, "deep-element-added", G_CALLBACK(gstreamer_receive_deep_element_added), NULL);
+
+  GstElement *src = gst_bin_get_by_name(GST_BIN(pipeline), "src");
+  if (src != NULL) {
+    GstPad *pad = gst_element_get_static_pad(src, "src");
+    if (pad != NULL) {
+      gst_pad_add_probe(pad, GST_PAD_PROBE_TYPE_EVENT_UPSTREAM, gstreamer_receive_keyframe_probe, GINT_TO_POINTER(pipelineId), NULL);
+      gst_object_unref(pad);
+    }
+    gst_object_unref(src);
+  }
+  return supported;
+}
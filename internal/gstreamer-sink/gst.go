@@ -9,6 +9,8 @@ package gst
 import "C"
 import (
 	"errors"
+	"log"
+	"sync"
 	"unsafe"
 )
 
@@ -18,13 +20,29 @@ var ErrUnknownCodec = errors.New("unknown codec")
 // It needs to be called from the process' main thread
 // Because many gstreamer plugins require access to the main thread
 // See: https://golang.org/pkg/runtime/#LockOSThread
+// The main loop is shared by all pipelines, calls after the first one return
+// immediately.
 func StartMainLoop() {
-	C.gstreamer_receive_start_mainloop()
+	mainLoopOnce.Do(func() {
+		C.gstreamer_receive_start_mainloop()
+	})
 }
 
+var mainLoopOnce sync.Once
+
+var pipelines = map[int]*Pipeline{}
+var pipelinesLock sync.Mutex
+var nextPipelineID int
+
 type Pipeline struct {
+	id          int
 	pipeline    *C.GstElement
 	pipelineStr string
+	eosHandler  func()
+	// keyFrameHandler is called when the pipeline needs a key frame.
+	keyFrameHandler func(full bool)
+	// requestsKeyFrames is set if the depayloader requests key frames.
+	requestsKeyFrames bool
 }
 
 func NewPipeline(codecName, dst string) (*Pipeline, error) {
@@ -40,16 +58,33 @@ func NewPipeline(codecName, dst string) (*Pipeline, error) {
 	case "h264":
 		pipelineStr += " ! rtpjitterbuffer ! queue ! rtph264depay ! decodebin ! " + dst
 
+	case "h265":
+		pipelineStr += ", media=video, clock-rate=90000, encoding-name=H265 ! rtpjitterbuffer ! queue ! rtph265depay ! decodebin ! " + dst
+
+	case "av1":
+		pipelineStr += ", media=video, clock-rate=90000, encoding-name=AV1 ! rtpjitterbuffer ! queue ! rtpav1depay ! decodebin ! " + dst
+
+	case "opus":
+		pipelineStr += ", media=audio, encoding-name=OPUS, clock-rate=48000 ! rtpjitterbuffer ! queue ! rtpopusdepay ! opusdec ! audioconvert ! audioresample ! " + dst
+
 	default:
 		return nil, ErrUnknownCodec
 	}
 
 	pipelineStrUnsafe := C.CString(pipelineStr)
 	defer C.free(unsafe.Pointer(pipelineStrUnsafe))
-	return &Pipeline{
+
+	pipelinesLock.Lock()
+	defer pipelinesLock.Unlock()
+
+	p := &Pipeline{
+		id:          nextPipelineID,
 		pipeline:    C.gstreamer_receive_create_pipeline(pipelineStrUnsafe),
 		pipelineStr: pipelineStr,
-	}, nil
+	}
+	nextPipelineID++
+	pipelines[p.id] = p
+	return p, nil
 }
 
 func (p *Pipeline) String() string {
@@ -58,7 +93,13 @@ func (p *Pipeline) String() string {
 
 // Start starts the GStreamer Pipeline
 func (p *Pipeline) Start() {
-	C.gstreamer_receive_start_pipeline(p.pipeline)
+	if p.keyFrameHandler != nil {
+		p.requestsKeyFrames = C.gstreamer_receive_handle_keyframe_requests(p.pipeline, C.int(p.id)) != 0
+		if !p.requestsKeyFrames {
+			log.Printf("neither request-keyframe nor automatic-request-sync-points is supported, which require GStreamer 1.20, the pipeline does not request key frames")
+		}
+	}
+	C.gstreamer_receive_start_pipeline(p.pipeline, C.int(p.id))
 }
 
 func (p *Pipeline) Stop() {
@@ -66,18 +107,61 @@ func (p *Pipeline) Stop() {
 }
 
 func (p *Pipeline) Destroy() {
+	pipelinesLock.Lock()
+	delete(pipelines, p.id)
+	pipelinesLock.Unlock()
+
 	C.gstreamer_receive_destroy_pipeline(p.pipeline)
 }
 
-var eosHandler func()
-
-func HandleSinkEOS(handler func()) {
-	eosHandler = handler
+// HandleEOS sets the function which is called when the pipeline reached the
+// end of the stream. It must be set before the pipeline is started.
+func (p *Pipeline) HandleEOS(handler func()) {
+	p.eosHandler = handler
 }
 
 //export goHandleReceiveEOS
-func goHandleReceiveEOS() {
-	eosHandler()
+func goHandleReceiveEOS(pipelineID C.int) {
+	pipelinesLock.Lock()
+	pipeline, ok := pipelines[int(pipelineID)]
+	pipelinesLock.Unlock()
+	if !ok {
+		log.Printf("no pipeline with ID %v, discarding EOS", int(pipelineID))
+		return
+	}
+	if pipeline.eosHandler != nil {
+		pipeline.eosHandler()
+	}
+}
+
+// HandleKeyFrameRequest sets the function which is called when the
+// depayloader or decoder needs a key frame, e.g. after packet loss. full is
+// set if the parameter sets are needed as well. The handler is called on a
+// streaming thread and must not block. It must be set before the pipeline
+// is started.
+func (p *Pipeline) HandleKeyFrameRequest(handler func(full bool)) {
+	p.keyFrameHandler = handler
+}
+
+//export goHandleKeyFrameRequest
+func goHandleKeyFrameRequest(pipelineID C.int, allHeaders C.int) {
+	pipelinesLock.Lock()
+	pipeline, ok := pipelines[int(pipelineID)]
+	pipelinesLock.Unlock()
+	if !ok {
+		log.Printf("no pipeline with ID %v, discarding key frame request", int(pipelineID))
+		return
+	}
+	if pipeline.keyFrameHandler != nil {
+		pipeline.keyFrameHandler(allHeaders != 0)
+	}
+}
+
+// RequestsKeyFrames reports whether the pipeline calls the handler set by
+// HandleKeyFrameRequest after packet loss, which requires GStreamer 1.20.
+// It is valid after the pipeline was started.
+func (p *Pipeline) RequestsKeyFrames() bool {
+	return p.requestsKeyFrames
 }
 
 // Push pushes a buffer on the appsrc of the GStreamer Pipeline
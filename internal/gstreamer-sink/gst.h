@@ -9,11 +9,13 @@
 void gstreamer_receive_start_mainloop(void);
 
 GstElement *gstreamer_receive_create_pipeline(char *pipeline);
-void gstreamer_receive_start_pipeline(GstElement *pipeline);
+void gstreamer_receive_start_pipeline(GstElement *pipeline, int pipelineId);
 void gstreamer_receive_stop_pipeline(GstElement* pipeline);
 void gstreamer_receive_destroy_pipeline(GstElement* pipeline);
 void gstreamer_receive_push_buffer(GstElement *pipeline, void *buffer, int len);
+int gstreamer_receive_handle_keyframe_requests(GstElement *pipeline, int pipelineId);
 
-extern void goHandleReceiveEOS();
+extern void goHandleReceiveEOS(int pipelineId);
+extern void goHandleKeyFrameRequest(int pipelineId, int allHeaders);
 
 #endif
@@ -11,7 +11,7 @@ static gboolean go_gst_bus_call(GstBus *bus, GstMessage *msg, gpointer data) {
     switch (GST_MESSAGE_TYPE(msg)) {
 
     case GST_MESSAGE_EOS: {
-        goHandleSendEOS();
+        goHandleSendEOS(GPOINTER_TO_INT(data));
         break;
     }
 
@@ -69,7 +69,7 @@ void gstreamer_send_start_pipeline(GstElement* pipeline, int pipelineId) {
     s->pipelineId = pipelineId;
 
     GstBus *bus = gst_pipeline_get_bus(GST_PIPELINE(pipeline));
-    gst_bus_add_watch(bus, go_gst_bus_call, NULL);
+    gst_bus_add_watch(bus, go_gst_bus_call, GINT_TO_POINTER(pipelineId));
     gst_object_unref(bus);
 
     GstElement *appsink = gst_bin_get_by_name(GST_BIN(pipeline), "appsink");
@@ -109,3 +109,30 @@ void gstreamer_send_set_property_uint(GstElement* pipeline, char *name, char *pr
         gst_object_unref(element);
     }
 }
+
+void gstreamer_send_force_key_unit(GstElement* pipeline) {
+    GstElement* encoder = gst_bin_get_by_name(GST_BIN(pipeline), "encoder");
+    if (encoder == NULL) {
+        return;
+    }
+    GstPad* pad = gst_element_get_static_pad(encoder, "src");
+    if (pad != NULL) {
+        GstStructure* s = gst_structure_new("GstForceKeyUnit",
+            "all-headers", G_TYPE_BOOLEAN, TRUE,
+            NULL);
+        gst_pad_send_event(pad, gst_event_new_custom(GST_EVENT_CUSTOM_UPSTREAM, s));
+        gst_object_unref(pad);
+    }
+    gst_object_unref(encoder);
+}
+
+int gstreamer_send_has_element(char *name) {
+    gst_init(NULL, NULL);
+
+    GstElementFactory* factory = gst_element_factory_find(name);
+    if (factory == NULL) {
+        return 0;
+    }
+    gst_object_unref(factory);
+    return 1;
+}
@@ -10,6 +10,7 @@ import "C"
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"sync"
@@ -18,16 +19,30 @@ import (
 
 var ErrUnknownCodec = errors.New("unknown codec")
 
+const (
+	// opusMinBitrate and opusMaxBitrate bound the bitrate property of
+	// opusenc in bps.
+	opusMinBitrate = 4_000
+	opusMaxBitrate = 650_000
+)
+
 // StartMainLoop starts GLib's main loop
 // It needs to be called from the process' main thread
 // Because many gstreamer plugins require access to the main thread
 // See: https://golang.org/pkg/runtime/#LockOSThread
+// The main loop is shared by all pipelines, calls after the first one return
+// immediately.
 func StartMainLoop() {
-	C.gstreamer_send_start_mainloop()
+	mainLoopOnce.Do(func() {
+		C.gstreamer_send_start_mainloop()
+	})
 }
 
+var mainLoopOnce sync.Once
+
 var pipelines = map[int]*Pipeline{}
 var pipelinesLock sync.Mutex
+var nextPipelineID int
 
 type Pipeline struct {
 	id          int
@@ -36,24 +51,51 @@ type Pipeline struct {
 	pipelineStr string
 	payloder    string
 	codec       string
+	eosHandler  func()
 }
 
-func NewPipeline(codec, src string, w io.Writer) (*Pipeline, error) {
+// NewPipeline creates a pipeline which encodes src with codec and writes
+// RTP packets of at most mtu bytes to w. Video encoders produce a key frame
+// at least every keyFrameInterval frames, 0 keeps the default interval of
+// the codec.
+func NewPipeline(codec, src string, mtu, keyFrameInterval int, w io.Writer) (*Pipeline, error) {
 	pipelineStr := "appsink name=appsink"
 	var payloader string
 
 	switch codec {
 	case "vp8":
 		payloader = "rtpvp8pay"
-		pipelineStr = src + "! vp8enc name=encoder error-resilient=partitions keyframe-max-dist=10 auto-alt-ref=true cpu-used=5 deadline=1 ! rtpvp8pay name=rtpvp8pay mtu=1200 ! " + pipelineStr
+		pipelineStr = src + fmt.Sprintf("! vp8enc name=encoder error-resilient=partitions keyframe-max-dist=%v auto-alt-ref=true cpu-used=5 deadline=1 ! rtpvp8pay name=rtpvp8pay mtu=%v ! ", keyFrameDistance(keyFrameInterval, 10), mtu) + pipelineStr
 
 	case "vp9":
 		payloader = "rtpvp9pay"
-		pipelineStr = src + " ! vp9enc name=encoder keyframe-max-dist=10 auto-alt-ref=true cpu-used=5 ! rtpvp9pay name=rtpvp9pay mtu=1200 ! " + pipelineStr
+		pipelineStr = src + fmt.Sprintf(" ! vp9enc name=encoder keyframe-max-dist=%v auto-alt-ref=true cpu-used=5 ! rtpvp9pay name=rtpvp9pay mtu=%v ! ", keyFrameDistance(keyFrameInterval, 10), mtu) + pipelineStr
 
 	case "h264":
 		payloader = "rtph264pay"
-		pipelineStr = src + " ! x264enc name=encoder pass=5 speed-preset=4 tune=4 ! rtph264pay name=rtph264pay mtu=1200 ! " + pipelineStr
+		encoder := "x264enc name=encoder pass=5 speed-preset=4 tune=4"
+		if keyFrameInterval > 0 {
+			// x264enc picks the interval itself by default.
+			encoder += fmt.Sprintf(" key-int-max=%v", keyFrameInterval)
+		}
+		pipelineStr = src + fmt.Sprintf(" ! %v ! rtph264pay name=rtph264pay mtu=%v ! ", encoder, mtu) + pipelineStr
+
+	case "h265":
+		payloader = "rtph265pay"
+		pipelineStr = src + fmt.Sprintf(" ! x265enc name=encoder speed-preset=ultrafast tune=zerolatency key-int-max=%v ! rtph265pay name=rtph265pay config-interval=-1 mtu=%v ! ", keyFrameDistance(keyFrameInterval, 30), mtu) + pipelineStr
+
+	case "av1":
+		payloader = "rtpav1pay"
+		distance := keyFrameDistance(keyFrameInterval, 30)
+		encoder := fmt.Sprintf("av1enc name=encoder end-usage=cbr cpu-used=8 keyframe-max-dist=%v", distance)
+		if !hasElement("av1enc") && hasElement("svtav1enc") {
+			encoder = fmt.Sprintf("svtav1enc name=encoder preset=12 intra-period-length=%v", distance)
+		}
+		pipelineStr = src + fmt.Sprintf(" ! %v ! rtpav1pay name=rtpav1pay mtu=%v ! ", encoder, mtu) + pipelineStr
+
+	case "opus":
+		payloader = "rtpopuspay"
+		pipelineStr = src + fmt.Sprintf(" ! audioconvert ! audioresample ! opusenc name=encoder ! rtpopuspay name=rtpopuspay mtu=%v ! ", mtu) + pipelineStr
 
 	default:
 		return nil, ErrUnknownCodec
@@ -66,17 +108,27 @@ func NewPipeline(codec, src string, w io.Writer) (*Pipeline, error) {
 	defer pipelinesLock.Unlock()
 
 	sp := &Pipeline{
-		id:          len(pipelines),
+		id:          nextPipelineID,
 		pipeline:    C.gstreamer_send_create_pipeline(pipelineStrUnsafe),
 		pipelineStr: pipelineStr,
 		payloder:    payloader,
 		codec:       codec,
 		writer:      w,
 	}
+	nextPipelineID++
 	pipelines[sp.id] = sp
 	return sp, nil
 }
 
+// keyFrameDistance returns keyFrameInterval, or the default interval def of
+// the codec if it is 0.
+func keyFrameDistance(keyFrameInterval, def int) int {
+	if keyFrameInterval > 0 {
+		return keyFrameInterval
+	}
+	return def
+}
+
 func (p *Pipeline) String() string {
 	return p.pipelineStr
 }
@@ -90,18 +142,31 @@ func (p *Pipeline) Stop() {
 }
 
 func (p *Pipeline) Destroy() {
+	pipelinesLock.Lock()
+	delete(pipelines, p.id)
+	pipelinesLock.Unlock()
+
 	C.gstreamer_send_destroy_pipeline(p.pipeline)
 }
 
-var eosHandler func()
-
-func HandleSrcEOS(handler func()) {
-	eosHandler = handler
+// HandleEOS sets the function which is called when the pipeline reached the
+// end of the stream. It must be set before the pipeline is started.
+func (p *Pipeline) HandleEOS(handler func()) {
+	p.eosHandler = handler
 }
 
 //export goHandleSendEOS
-func goHandleSendEOS() {
-	eosHandler()
+func goHandleSendEOS(pipelineID C.int) {
+	pipelinesLock.Lock()
+	pipeline, ok := pipelines[int(pipelineID)]
+	pipelinesLock.Unlock()
+	if !ok {
+		log.Printf("no pipeline with ID %v, discarding EOS", int(pipelineID))
+		return
+	}
+	if pipeline.eosHandler != nil {
+		pipeline.eosHandler()
+	}
 }
 
 func (p *Pipeline) setPropertyUint(name string, prop string, value uint) {
@@ -133,26 +198,57 @@ func (p *Pipeline) SetSSRC(ssrc uint) {
 	p.setPropertyUint(p.payloder, "ssrc", ssrc)
 }
 
+// bitrateProperty returns the bitrate property of the encoder and its unit
+// in bps.
+func (p *Pipeline) bitrateProperty() (string, uint) {
+	switch p.codec {
+	case "vp8", "vp9":
+		// vp8enc, vp9enc
+		return "target-bitrate", 1
+	case "h264", "h265":
+		// x264enc, x265enc
+		return "bitrate", 1000
+	case "av1":
+		// av1enc, svtav1enc
+		return "target-bitrate", 1000
+	default:
+		// opusenc
+		return "bitrate", 1
+	}
+}
+
 func (p *Pipeline) SetBitRate(bitrate uint) {
-	value := bitrate
-	prop := "bitrate"
-	if p.codec == "vp8" || p.codec == "vp9" {
-		prop = "target-bitrate"
-	} else if p.codec == "h264" {
-		value = value / 1000
+	if p.codec == "opus" {
+		if bitrate < opusMinBitrate {
+			bitrate = opusMinBitrate
+		} else if bitrate > opusMaxBitrate {
+			bitrate = opusMaxBitrate
+		}
 	}
+	prop, unit := p.bitrateProperty()
 	//previous := p.getPropertyUint("encoder", prop)
-	p.setPropertyUint("encoder", prop, value)
+	p.setPropertyUint("encoder", prop, bitrate/unit)
 	//next := p.getPropertyUint("encoder", prop)
-	//fmt.Printf("updating bitrate for codec %v: %v => %v (got %v, value=%v)\n", p.codec, previous, next, bitrate, value)
+	//fmt.Printf("updating bitrate for codec %v: %v => %v (got %v, value=%v)\n", p.codec, previous, next, bitrate, bitrate/unit)
 }
 
+// GetBitrate returns the bitrate of the encoder in bps.
 func (p *Pipeline) GetBitrate() uint {
-	prop := "bitrate"
-	if p.codec == "vp8" || p.codec == "vp9" {
-		prop = "target-bitrate"
-	}
-	return p.getPropertyUint(p.codec, prop)
+	prop, unit := p.bitrateProperty()
+	return p.getPropertyUint("encoder", prop) * unit
+}
+
+// hasElement reports whether the GStreamer element factory name is
+// installed.
+func hasElement(name string) bool {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	return C.gstreamer_send_has_element(cName) != 0
+}
+
+// ForceKeyFrame asks the encoder to encode the next frame as a key frame.
+func (p *Pipeline) ForceKeyFrame() {
+	C.gstreamer_send_force_key_unit(p.pipeline)
 }
 
 //export goHandlePipelineBuffer
@@ -7,7 +7,7 @@ typedef struct SampleHandlerUserData {
     int pipelineId;
 } SampleHandlerUserData;
 
-extern void goHandleSendEOS();
+extern void goHandleSendEOS(int pipelineId);
 extern void goHandlePipelineBuffer(void *buffer, int bufferLen, int pipelineId);
 
 void gstreamer_send_start_mainloop(void);
@@ -19,5 +19,7 @@ void gstreamer_send_destroy_pipeline(GstElement* pipeline);
 
 unsigned int gstreamer_get_property_uint(GstElement* pipeline, char *name, char *prop);
 void gstreamer_send_set_property_uint(GstElement* pipeline, char *name, char *prop, unsigned int value);
+void gstreamer_send_force_key_unit(GstElement* pipeline);
+int gstreamer_send_has_element(char *name);
 
 #endif
@@ -0,0 +1,112 @@
+// Package keyframe provides interceptors which request key frames with
+// picture loss indications (RFC 4585) and full intra requests (RFC 5104)
+// and pass the requests received for local streams to the encoder.
+package keyframe
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+)
+
+// GeneratorInterceptor sends the key frame requests of the application,
+// e.g. when a decoder lost its state. Requests for the same stream are sent
+// at most once per interval, since the sender needs some time to encode a
+// key frame.
+type GeneratorInterceptor struct {
+	interceptor.NoOp
+	interval time.Duration
+	log      logging.LeveledLogger
+
+	senderSSRC uint32
+
+	mu         sync.Mutex
+	rtcpWriter interceptor.RTCPWriter
+	streams    map[uint32]*remoteStream
+}
+
+type remoteStream struct {
+	lastRequest time.Time
+	// firSeq is the sequence number of the next FIR.
+	firSeq uint8
+}
+
+// NewGeneratorInterceptor returns a new GeneratorInterceptor.
+func NewGeneratorInterceptor(opts ...GeneratorOption) (*GeneratorInterceptor, error) {
+	g := &GeneratorInterceptor{
+		interval:   500 * time.Millisecond,
+		log:        logging.NewDefaultLoggerFactory().NewLogger("keyframe_generator"),
+		senderSSRC: rand.Uint32(), // #nosec
+		streams:    map[uint32]*remoteStream{},
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// BindRTCPWriter lets you modify any outgoing RTCP packets. It is called once per PeerConnection. The returned method
+// will be called once per packet batch.
+func (g *GeneratorInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.rtcpWriter = writer
+	return writer
+}
+
+// BindRemoteStream lets you modify any incoming RTP packets. It is called once for per RemoteStream. The returned method
+// will be called once per rtp packet.
+func (g *GeneratorInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.streams[info.SSRC] = &remoteStream{}
+	return reader
+}
+
+// UnbindRemoteStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (g *GeneratorInterceptor) UnbindRemoteStream(info *interceptor.StreamInfo) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.streams, info.SSRC)
+}
+
+// RequestKeyFrame asks the sender of the remote stream with the given SSRC
+// for a key frame. A full intra request is sent if full is set, e.g. when
+// the decoder also needs the parameter sets, otherwise a picture loss
+// indication. Requests within the interval of the last request of the
+// stream are dropped.
+func (g *GeneratorInterceptor) RequestKeyFrame(ssrc uint32, full bool) {
+	g.mu.Lock()
+	stream, ok := g.streams[ssrc]
+	writer := g.rtcpWriter
+	if !ok || writer == nil || time.Since(stream.lastRequest) < g.interval {
+		g.mu.Unlock()
+		return
+	}
+	stream.lastRequest = time.Now()
+	var pkt rtcp.Packet = &rtcp.PictureLossIndication{
+		SenderSSRC: g.senderSSRC,
+		MediaSSRC:  ssrc,
+	}
+	if full {
+		pkt = &rtcp.FullIntraRequest{
+			SenderSSRC: g.senderSSRC,
+			FIR: []rtcp.FIREntry{{
+				SSRC:           ssrc,
+				SequenceNumber: stream.firSeq,
+			}},
+		}
+		stream.firSeq++
+	}
+	g.mu.Unlock()
+
+	if _, err := writer.Write([]rtcp.Packet{pkt}, interceptor.Attributes{}); err != nil {
+		g.log.Warnf("failed sending key frame request: %+v", err)
+	}
+}
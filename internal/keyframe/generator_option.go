@@ -0,0 +1,31 @@
+package keyframe
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// GeneratorOption can be used to configure GeneratorInterceptor.
+type GeneratorOption func(g *GeneratorInterceptor) error
+
+// GeneratorInterval sets the minimum interval between the key frame
+// requests of a stream.
+func GeneratorInterval(interval time.Duration) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid key frame request interval: %v", interval)
+		}
+		g.interval = interval
+		return nil
+	}
+}
+
+// GeneratorLog sets a logger for the interceptor.
+func GeneratorLog(log logging.LeveledLogger) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		g.log = log
+		return nil
+	}
+}
@@ -0,0 +1,69 @@
+package keyframe
+
+import (
+	"sync"
+	"time"
+)
+
+// maxGap is the largest gap in the sequence numbers which is tracked packet
+// by packet. Larger jumps are reported as loss immediately.
+const maxGap = 1 << 10
+
+// LossDetector detects packets of a stream which are still missing after a
+// timeout, i.e. which neither retransmissions nor FEC recovered. It is used
+// to request key frames when the depayloader and decoder cannot request
+// them, like before GStreamer 1.20.
+type LossDetector struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	started bool
+	highest uint16
+	// missing holds the time at which each missing packet was noticed.
+	missing map[uint16]time.Time
+}
+
+// NewLossDetector returns a LossDetector which reports packets missing for
+// longer than timeout.
+func NewLossDetector(timeout time.Duration) *LossDetector {
+	return &LossDetector{
+		timeout: timeout,
+		missing: map[uint16]time.Time{},
+	}
+}
+
+// Push records the packet with sequence number seq, which arrived at now,
+// and reports whether a packet was missing for longer than the timeout.
+// Reported packets are forgotten, so that each loss is reported once.
+func (d *LossDetector) Push(seq uint16, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.started {
+		d.started = true
+		d.highest = seq
+		return false
+	}
+	lost := false
+	switch diff := int16(seq - d.highest); {
+	case diff > maxGap || diff < -maxGap:
+		lost = true
+		d.missing = map[uint16]time.Time{}
+		d.highest = seq
+	case diff > 0:
+		for s := d.highest + 1; s != seq; s++ {
+			d.missing[s] = now
+		}
+		d.highest = seq
+	default:
+		// Reordered, retransmitted or recovered packet.
+		delete(d.missing, seq)
+	}
+	for s, noticed := range d.missing {
+		if now.Sub(noticed) > d.timeout {
+			lost = true
+			delete(d.missing, s)
+		}
+	}
+	return lost
+}
@@ -0,0 +1,61 @@
+package keyframe
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLossDetector(t *testing.T) {
+	timeout := 100 * time.Millisecond
+	start := time.Unix(0, 0)
+	at := func(ms int) time.Time {
+		return start.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	t.Run("in order", func(t *testing.T) {
+		d := NewLossDetector(timeout)
+		for i := 0; i < 1000; i++ {
+			if d.Push(uint16(65000+i), at(i)) {
+				t.Fatalf("loss reported for packet %v", i)
+			}
+		}
+	})
+
+	t.Run("recovered", func(t *testing.T) {
+		d := NewLossDetector(timeout)
+		d.Push(1, at(0))
+		d.Push(3, at(10))
+		if d.Push(2, at(50)) {
+			t.Fatal("loss reported for recovered packet")
+		}
+		if d.Push(4, at(500)) {
+			t.Fatal("loss reported after recovery")
+		}
+	})
+
+	t.Run("lost", func(t *testing.T) {
+		d := NewLossDetector(timeout)
+		d.Push(65535, at(0))
+		d.Push(1, at(10))
+		if d.Push(2, at(100)) {
+			t.Fatal("loss reported before timeout")
+		}
+		if !d.Push(3, at(111)) {
+			t.Fatal("no loss reported after timeout")
+		}
+		if d.Push(4, at(300)) {
+			t.Fatal("loss reported twice")
+		}
+	})
+
+	t.Run("jump", func(t *testing.T) {
+		d := NewLossDetector(timeout)
+		d.Push(100, at(0))
+		if !d.Push(100+2*maxGap, at(1)) {
+			t.Fatal("no loss reported for jump")
+		}
+		if d.Push(101+2*maxGap, at(500)) {
+			t.Fatal("loss reported after jump")
+		}
+	})
+}
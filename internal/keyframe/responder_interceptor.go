@@ -0,0 +1,91 @@
+package keyframe
+
+import (
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+)
+
+// ResponderInterceptor passes the picture loss indications and full intra
+// requests received for local streams to a handler, which usually asks
+// the encoder of the stream for a key frame. Repeated full intra requests
+// with the same sequence number are only passed on once (RFC 5104,
+// section 4.3.1.1).
+type ResponderInterceptor struct {
+	interceptor.NoOp
+	handler func(ssrc uint32)
+	log     logging.LeveledLogger
+
+	mu sync.Mutex
+	// firSeqs holds the sequence number of the last full intra request
+	// of each local stream which got one.
+	firSeqs map[uint32]uint8
+}
+
+// NewResponderInterceptor returns a new ResponderInterceptor which calls
+// handler with the SSRC of the local stream of each key frame request.
+func NewResponderInterceptor(handler func(ssrc uint32), opts ...ResponderOption) (*ResponderInterceptor, error) {
+	r := &ResponderInterceptor{
+		handler: handler,
+		log:     logging.NewDefaultLoggerFactory().NewLogger("keyframe_responder"),
+		firSeqs: map[uint32]uint8{},
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BindRTCPReader lets you modify any incoming RTCP packets. It is called once per sender/receiver, however this might
+// change in the future. The returned method will be called once per packet batch.
+func (r *ResponderInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkts, err := rtcp.Unmarshal(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, pkt := range pkts {
+			switch p := pkt.(type) {
+			case *rtcp.PictureLossIndication:
+				r.log.Debugf("got PLI for SSRC %v", p.MediaSSRC)
+				r.handler(p.MediaSSRC)
+			case *rtcp.FullIntraRequest:
+				for _, entry := range p.FIR {
+					if r.repeated(entry) {
+						continue
+					}
+					r.log.Debugf("got FIR %v for SSRC %v", entry.SequenceNumber, entry.SSRC)
+					r.handler(entry.SSRC)
+				}
+			}
+		}
+		return i, attr, nil
+	})
+}
+
+// UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (r *ResponderInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.firSeqs, info.SSRC)
+}
+
+// repeated reports whether entry repeats the last full intra request of its
+// stream and records it otherwise.
+func (r *ResponderInterceptor) repeated(entry rtcp.FIREntry) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if seq, ok := r.firSeqs[entry.SSRC]; ok && seq == entry.SequenceNumber {
+		return true
+	}
+	r.firSeqs[entry.SSRC] = entry.SequenceNumber
+	return false
+}
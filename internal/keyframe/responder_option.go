@@ -0,0 +1,14 @@
+package keyframe
+
+import "github.com/pion/logging"
+
+// ResponderOption can be used to configure ResponderInterceptor.
+type ResponderOption func(r *ResponderInterceptor) error
+
+// ResponderLog sets a logger for the interceptor.
+func ResponderLog(log logging.LeveledLogger) ResponderOption {
+	return func(r *ResponderInterceptor) error {
+		r.log = log
+		return nil
+	}
+}
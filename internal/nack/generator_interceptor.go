@@ -0,0 +1,183 @@
+package nack
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// GeneratorInterceptor sends generic NACKs for the packets missing in the
+// sequence of remote streams which support NACK feedback. Packets which
+// arrive on the RTX stream of a remote stream count as received packets of
+// the remote stream.
+type GeneratorInterceptor struct {
+	interceptor.NoOp
+	size     uint16
+	interval time.Duration
+	maxNACKs int
+	log      logging.LeveledLogger
+
+	receiveLogs   map[uint32]*receiveLog
+	receiveLogsMu sync.Mutex
+
+	m     sync.Mutex
+	wg    sync.WaitGroup
+	close chan struct{}
+}
+
+// NewGeneratorInterceptor returns a new GeneratorInterceptor.
+func NewGeneratorInterceptor(opts ...GeneratorOption) (*GeneratorInterceptor, error) {
+	g := &GeneratorInterceptor{
+		size:        512,
+		interval:    50 * time.Millisecond,
+		maxNACKs:    4,
+		log:         logging.NewDefaultLoggerFactory().NewLogger("nack_generator"),
+		receiveLogs: map[uint32]*receiveLog{},
+		close:       make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(g); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// BindRTCPWriter lets you modify any outgoing RTCP packets. It is called once per PeerConnection. The returned method
+// will be called once per packet batch.
+func (g *GeneratorInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if g.isClosed() {
+		return writer
+	}
+
+	g.wg.Add(1)
+
+	go g.loop(writer)
+
+	return writer
+}
+
+// BindRemoteStream lets you modify any incoming RTP packets. It is called once for per RemoteStream. The returned method
+// will be called once per rtp packet.
+func (g *GeneratorInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	if mediaSSRC, ok := GetRTX(info.Attributes); ok {
+		return g.bindRTXStream(mediaSSRC, reader)
+	}
+	if !streamSupportNack(info) {
+		return reader
+	}
+
+	receiveLog := newReceiveLog(g.size)
+	g.receiveLogsMu.Lock()
+	g.receiveLogs[info.SSRC] = receiveLog
+	g.receiveLogsMu.Unlock()
+
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		var header rtp.Header
+		if _, err = header.Unmarshal(b[:i]); err != nil {
+			return 0, nil, err
+		}
+		receiveLog.add(header.SequenceNumber)
+		return i, attr, nil
+	})
+}
+
+// bindRTXStream marks the original sequence numbers of the packets read from
+// an RTX stream as received in the log of the stream mediaSSRC.
+func (g *GeneratorInterceptor) bindRTXStream(mediaSSRC uint32, reader interceptor.RTPReader) interceptor.RTPReader {
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		var pkt rtp.Packet
+		if err = pkt.Unmarshal(b[:i]); err != nil {
+			return 0, nil, err
+		}
+		g.receiveLogsMu.Lock()
+		receiveLog, ok := g.receiveLogs[mediaSSRC]
+		g.receiveLogsMu.Unlock()
+		if ok && len(pkt.Payload) >= 2 {
+			receiveLog.add(binary.BigEndian.Uint16(pkt.Payload))
+		}
+		return i, attr, nil
+	})
+}
+
+// UnbindRemoteStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (g *GeneratorInterceptor) UnbindRemoteStream(info *interceptor.StreamInfo) {
+	g.receiveLogsMu.Lock()
+	delete(g.receiveLogs, info.SSRC)
+	g.receiveLogsMu.Unlock()
+}
+
+// Close closes the interceptor.
+func (g *GeneratorInterceptor) Close() error {
+	defer g.wg.Wait()
+	g.m.Lock()
+	defer g.m.Unlock()
+
+	if !g.isClosed() {
+		close(g.close)
+	}
+	return nil
+}
+
+func (g *GeneratorInterceptor) loop(rtcpWriter interceptor.RTCPWriter) {
+	defer g.wg.Done()
+
+	senderSSRC := rand.Uint32() // #nosec
+
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			var pkts []rtcp.Packet
+			g.receiveLogsMu.Lock()
+			for ssrc, receiveLog := range g.receiveLogs {
+				missing := receiveLog.nacks(g.maxNACKs)
+				if len(missing) == 0 {
+					continue
+				}
+				pkts = append(pkts, &rtcp.TransportLayerNack{
+					SenderSSRC: senderSSRC,
+					MediaSSRC:  ssrc,
+					Nacks:      rtcp.NackPairsFromSequenceNumbers(missing),
+				})
+			}
+			g.receiveLogsMu.Unlock()
+			if len(pkts) == 0 {
+				continue
+			}
+			if _, err := rtcpWriter.Write(pkts, interceptor.Attributes{}); err != nil {
+				g.log.Warnf("failed sending nack: %+v", err)
+			}
+
+		case <-g.close:
+			return
+		}
+	}
+}
+
+func (g *GeneratorInterceptor) isClosed() bool {
+	select {
+	case <-g.close:
+		return true
+	default:
+		return false
+	}
+}
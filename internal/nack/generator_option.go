@@ -0,0 +1,54 @@
+package nack
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// GeneratorOption can be used to configure GeneratorInterceptor.
+type GeneratorOption func(g *GeneratorInterceptor) error
+
+// GeneratorSize sets the number of sequence numbers behind the highest
+// received one which are requested when missing.
+func GeneratorSize(size uint16) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		if size == 0 || size >= 1<<15 {
+			return fmt.Errorf("invalid receive log size: %v", size)
+		}
+		g.size = size
+		return nil
+	}
+}
+
+// GeneratorInterval sets the interval at which NACKs are sent.
+func GeneratorInterval(interval time.Duration) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid nack interval: %v", interval)
+		}
+		g.interval = interval
+		return nil
+	}
+}
+
+// GeneratorMaxNACKs sets how often a missing packet is requested before it is
+// given up.
+func GeneratorMaxNACKs(n int) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		if n <= 0 {
+			return fmt.Errorf("invalid number of nacks per packet: %v", n)
+		}
+		g.maxNACKs = n
+		return nil
+	}
+}
+
+// GeneratorLog sets a logger for the interceptor.
+func GeneratorLog(log logging.LeveledLogger) GeneratorOption {
+	return func(g *GeneratorInterceptor) error {
+		g.log = log
+		return nil
+	}
+}
@@ -0,0 +1,72 @@
+// Package nack provides interceptors which request lost RTP packets with
+// generic NACKs (RFC 4585) and retransmit them on a separate RTX stream
+// (RFC 4588).
+package nack
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// RTXOverhead is the number of bytes an RTX packet is longer than the packet
+// it retransmits.
+const RTXOverhead = 2
+
+// ErrInvalidRTXPacket is returned when unwrapping an RTX packet whose payload
+// is too short to carry the original sequence number.
+var ErrInvalidRTXPacket = errors.New("invalid RTX packet")
+
+// rtxAttributeKey is the key of the SSRC of the original stream in the
+// attributes of an RTX stream.
+type rtxAttributeKey struct{}
+
+// SetRTX marks a stream as the RTX stream which carries the retransmissions
+// of the stream with SSRC mediaSSRC.
+func SetRTX(attributes interceptor.Attributes, mediaSSRC uint32) interceptor.Attributes {
+	if attributes == nil {
+		attributes = interceptor.Attributes{}
+	}
+	attributes[rtxAttributeKey{}] = mediaSSRC
+	return attributes
+}
+
+// GetRTX returns the SSRC stored by SetRTX and whether the stream is an RTX
+// stream.
+func GetRTX(attributes interceptor.Attributes) (uint32, bool) {
+	mediaSSRC, ok := attributes[rtxAttributeKey{}].(uint32)
+	return mediaSSRC, ok
+}
+
+func streamSupportNack(info *interceptor.StreamInfo) bool {
+	for _, fb := range info.RTCPFeedback {
+		if fb.Type == "nack" && fb.Parameter == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// wrapRTX returns the payload of the RTX packet retransmitting pkt, which
+// starts with the original sequence number.
+func wrapRTX(pkt *rtp.Packet) []byte {
+	payload := make([]byte, RTXOverhead+len(pkt.Payload))
+	binary.BigEndian.PutUint16(payload, pkt.SequenceNumber)
+	copy(payload[RTXOverhead:], pkt.Payload)
+	return payload
+}
+
+// UnwrapRTX restores the original packet of the stream with SSRC mediaSSRC
+// and the given payload type from the RTX packet pkt.
+func UnwrapRTX(pkt *rtp.Packet, mediaSSRC uint32, payloadType uint8) error {
+	if len(pkt.Payload) < RTXOverhead {
+		return ErrInvalidRTXPacket
+	}
+	pkt.SSRC = mediaSSRC
+	pkt.PayloadType = payloadType
+	pkt.SequenceNumber = binary.BigEndian.Uint16(pkt.Payload)
+	pkt.Payload = pkt.Payload[RTXOverhead:]
+	return nil
+}
@@ -0,0 +1,105 @@
+package nack
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+func TestRTX(t *testing.T) {
+	original := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    96,
+			SequenceNumber: 65535,
+			Timestamp:      1234,
+			SSRC:           1,
+		},
+		Payload: []byte{1, 2, 3},
+	}
+	rtx := &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			PayloadType:    97,
+			SequenceNumber: 10,
+			Timestamp:      1234,
+			SSRC:           2,
+		},
+		Payload: wrapRTX(original),
+	}
+	if got, want := len(rtx.Payload), len(original.Payload)+RTXOverhead; got != want {
+		t.Fatalf("got RTX payload of %v bytes, want %v", got, want)
+	}
+	if err := UnwrapRTX(rtx, 1, 96); err != nil {
+		t.Fatalf("failed to unwrap: %v", err)
+	}
+	if rtx.SSRC != original.SSRC || rtx.PayloadType != original.PayloadType ||
+		rtx.SequenceNumber != original.SequenceNumber || !bytes.Equal(rtx.Payload, original.Payload) {
+		t.Errorf("got %v, want %v", rtx, original)
+	}
+
+	short := &rtp.Packet{Payload: []byte{1}}
+	if err := UnwrapRTX(short, 1, 96); !errors.Is(err, ErrInvalidRTXPacket) {
+		t.Errorf("got error %v for short packet, want %v", err, ErrInvalidRTXPacket)
+	}
+}
+
+func TestReceiveLog(t *testing.T) {
+	t.Run("wraparound", func(t *testing.T) {
+		l := newReceiveLog(128)
+		for _, seq := range []uint16{65533, 65534, 1, 3} {
+			l.add(seq)
+		}
+		if got, want := l.nacks(10), []uint16{65535, 0, 2}; !equalSeqs(got, want) {
+			t.Errorf("got NACKs %v, want %v", got, want)
+		}
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		l := newReceiveLog(128)
+		for _, seq := range []uint16{1, 4, 2} {
+			l.add(seq)
+		}
+		if got, want := l.nacks(10), []uint16{3}; !equalSeqs(got, want) {
+			t.Errorf("got NACKs %v, want %v", got, want)
+		}
+	})
+
+	t.Run("max NACKs", func(t *testing.T) {
+		l := newReceiveLog(128)
+		l.add(1)
+		l.add(3)
+		for i := 0; i < 2; i++ {
+			if got, want := l.nacks(2), []uint16{2}; !equalSeqs(got, want) {
+				t.Errorf("round %v: got NACKs %v, want %v", i, got, want)
+			}
+		}
+		if got := l.nacks(2); len(got) != 0 {
+			t.Errorf("got NACKs %v after giving up", got)
+		}
+	})
+
+	t.Run("window", func(t *testing.T) {
+		l := newReceiveLog(4)
+		l.add(1)
+		l.add(3)
+		l.add(100)
+		if got, want := l.nacks(10), []uint16{96, 97, 98, 99}; !equalSeqs(got, want) {
+			t.Errorf("got NACKs %v, want %v", got, want)
+		}
+	})
+}
+
+func equalSeqs(a, b []uint16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package nack
+
+import (
+	"sort"
+	"sync"
+)
+
+// receiveLog tracks the missing sequence numbers of a remote stream within
+// a window behind the highest sequence number received.
+type receiveLog struct {
+	mu      sync.Mutex
+	size    uint16
+	started bool
+	highest uint16
+	// missing counts the NACKs sent for each missing sequence number.
+	missing map[uint16]int
+}
+
+func newReceiveLog(size uint16) *receiveLog {
+	return &receiveLog{
+		size:    size,
+		missing: map[uint16]int{},
+	}
+}
+
+func (l *receiveLog) add(seq uint16) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.started {
+		l.started = true
+		l.highest = seq
+		return
+	}
+	diff := seq - l.highest
+	if diff == 0 {
+		return
+	}
+	if diff >= 1<<15 {
+		// Reordered or retransmitted packet.
+		delete(l.missing, seq)
+		return
+	}
+	gapStart := l.highest + 1
+	if diff > l.size {
+		gapStart = seq - l.size
+	}
+	for s := gapStart; s != seq; s++ {
+		l.missing[s] = 0
+	}
+	l.highest = seq
+}
+
+// nacks returns the missing sequence numbers in order and counts a NACK for
+// each of them. Sequence numbers which fell out of the window or were
+// requested maxNACKs times are given up.
+func (l *receiveLog) nacks(maxNACKs int) []uint16 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seqs := make([]uint16, 0, len(l.missing))
+	for seq, count := range l.missing {
+		if l.highest-seq > l.size || count >= maxNACKs {
+			delete(l.missing, seq)
+			continue
+		}
+		l.missing[seq] = count + 1
+		seqs = append(seqs, seq)
+	}
+	// Oldest first, which is the order expected by
+	// rtcp.NackPairsFromSequenceNumbers.
+	sort.Slice(seqs, func(i, j int) bool {
+		return l.highest-seqs[i] > l.highest-seqs[j]
+	})
+	return seqs
+}
@@ -0,0 +1,152 @@
+package nack
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// rtxPayloadType is the payload type of RTX packets. Receivers associate RTX
+// streams with their original stream by SSRC, so a single payload type is
+// used for all streams.
+const rtxPayloadType = 97
+
+// ResponderInterceptor keeps a history of the packets sent on local streams
+// which support NACK feedback and retransmits the packets requested by NACKs
+// on the RTX stream of the stream. RTX streams are local streams whose
+// attributes were set by SetRTX, they must be bound after their original
+// stream. Retransmissions are written to the RTX stream, so interceptors
+// bound before the ResponderInterceptor see them as packets of the RTX
+// stream.
+type ResponderInterceptor struct {
+	interceptor.NoOp
+	size int
+	log  logging.LeveledLogger
+
+	streams   map[uint32]*localStream
+	streamsMu sync.Mutex
+}
+
+type localStream struct {
+	sendBuffer *sendBuffer
+	rtx        *rtxStream
+}
+
+// rtxStream numbers and writes the retransmissions of a local stream.
+type rtxStream struct {
+	mu        sync.Mutex
+	ssrc      uint32
+	seq       uint16
+	rtpWriter interceptor.RTPWriter
+}
+
+// NewResponderInterceptor returns a new ResponderInterceptor.
+func NewResponderInterceptor(opts ...ResponderOption) (*ResponderInterceptor, error) {
+	r := &ResponderInterceptor{
+		size:    1024,
+		log:     logging.NewDefaultLoggerFactory().NewLogger("nack_responder"),
+		streams: map[uint32]*localStream{},
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BindRTCPReader lets you modify any incoming RTCP packets. It is called once per sender/receiver, however this might
+// change in the future. The returned method will be called once per packet batch.
+func (r *ResponderInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkts, err := rtcp.Unmarshal(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, pkt := range pkts {
+			nack, ok := pkt.(*rtcp.TransportLayerNack)
+			if !ok {
+				continue
+			}
+			go r.resendPackets(nack)
+		}
+		return i, attr, nil
+	})
+}
+
+// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
+// will be called once per rtp packet.
+func (r *ResponderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if mediaSSRC, ok := GetRTX(info.Attributes); ok {
+		r.streamsMu.Lock()
+		defer r.streamsMu.Unlock()
+		stream, ok := r.streams[mediaSSRC]
+		if !ok {
+			r.log.Warnf("no stream %v to retransmit on RTX stream %v", mediaSSRC, info.SSRC)
+			return writer
+		}
+		stream.rtx = &rtxStream{
+			ssrc:      info.SSRC,
+			seq:       uint16(rand.Uint32()), // #nosec
+			rtpWriter: writer,
+		}
+		return writer
+	}
+	if !streamSupportNack(info) {
+		return writer
+	}
+
+	sendBuffer := newSendBuffer(r.size)
+	r.streamsMu.Lock()
+	r.streams[info.SSRC] = &localStream{sendBuffer: sendBuffer}
+	r.streamsMu.Unlock()
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		sendBuffer.add(header, payload)
+		return writer.Write(header, payload, attributes)
+	})
+}
+
+// UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (r *ResponderInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	r.streamsMu.Lock()
+	delete(r.streams, info.SSRC)
+	r.streamsMu.Unlock()
+}
+
+func (r *ResponderInterceptor) resendPackets(nack *rtcp.TransportLayerNack) {
+	r.streamsMu.Lock()
+	stream, ok := r.streams[nack.MediaSSRC]
+	r.streamsMu.Unlock()
+	if !ok || stream.rtx == nil {
+		return
+	}
+
+	stream.rtx.mu.Lock()
+	defer stream.rtx.mu.Unlock()
+	for _, pair := range nack.Nacks {
+		pair.Range(func(seq uint16) bool {
+			pkt := stream.sendBuffer.get(seq)
+			if pkt == nil {
+				return true
+			}
+			header := pkt.Header
+			header.SSRC = stream.rtx.ssrc
+			header.SequenceNumber = stream.rtx.seq
+			header.PayloadType = rtxPayloadType
+			stream.rtx.seq++
+			if _, err := stream.rtx.rtpWriter.Write(&header, wrapRTX(pkt), interceptor.Attributes{}); err != nil {
+				r.log.Warnf("failed resending nacked packet: %+v", err)
+			}
+			return true
+		})
+	}
+}
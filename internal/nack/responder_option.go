@@ -0,0 +1,30 @@
+package nack
+
+import (
+	"fmt"
+
+	"github.com/pion/logging"
+)
+
+// ResponderOption can be used to configure ResponderInterceptor.
+type ResponderOption func(r *ResponderInterceptor) error
+
+// ResponderSize sets the number of packets kept in the history of each
+// stream.
+func ResponderSize(size int) ResponderOption {
+	return func(r *ResponderInterceptor) error {
+		if size <= 0 || size > 1<<16 {
+			return fmt.Errorf("invalid history size: %v", size)
+		}
+		r.size = size
+		return nil
+	}
+}
+
+// ResponderLog sets a logger for the interceptor.
+func ResponderLog(log logging.LeveledLogger) ResponderOption {
+	return func(r *ResponderInterceptor) error {
+		r.log = log
+		return nil
+	}
+}
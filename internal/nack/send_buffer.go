@@ -0,0 +1,40 @@
+package nack
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+// sendBuffer holds the most recent packets of a local stream in a ring
+// indexed by sequence number.
+type sendBuffer struct {
+	mu      sync.Mutex
+	packets []*rtp.Packet
+}
+
+func newSendBuffer(size int) *sendBuffer {
+	return &sendBuffer{packets: make([]*rtp.Packet, size)}
+}
+
+func (b *sendBuffer) add(header *rtp.Header, payload []byte) {
+	pkt := &rtp.Packet{
+		Header:  *header,
+		Payload: append([]byte(nil), payload...),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.packets[int(header.SequenceNumber)%len(b.packets)] = pkt
+}
+
+// get returns the packet with sequence number seq, or nil if it was
+// overwritten by newer packets.
+func (b *sendBuffer) get(seq uint16) *rtp.Packet {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	pkt := b.packets[int(seq)%len(b.packets)]
+	if pkt == nil || pkt.SequenceNumber != seq {
+		return nil
+	}
+	return pkt
+}
@@ -22,11 +22,18 @@ type ReceiverInterceptor struct {
 	screamRx   map[uint32]*scream.Rx
 	screamRxMu sync.Mutex
 	interval   time.Duration
-	receive    chan *rtp.Packet
+	receive    chan receivedPacket
 
 	t0 float64
 }
 
+// receivedPacket is a received RTP packet and the ECN codepoint it was
+// received with.
+type receivedPacket struct {
+	pkt *rtp.Packet
+	ecn uint8
+}
+
 // NewReceiverInterceptor returns a new ReceiverInterceptor
 func NewReceiverInterceptor(opts ...ReceiverOption) (*ReceiverInterceptor, error) {
 	r := &ReceiverInterceptor{
@@ -34,7 +41,7 @@ func NewReceiverInterceptor(opts ...ReceiverOption) (*ReceiverInterceptor, error
 		close:    make(chan struct{}),
 		log:      logging.NewDefaultLoggerFactory().NewLogger("scream_receiver"),
 		screamRx: map[uint32]*scream.Rx{},
-		receive:  make(chan *rtp.Packet),
+		receive:  make(chan receivedPacket),
 		t0:       getNTPT0(),
 	}
 	for _, opt := range opts {
@@ -89,7 +96,7 @@ func (r *ReceiverInterceptor) BindRemoteStream(info *interceptor.StreamInfo, rea
 			return 0, nil, err
 		}
 
-		r.receive <- &pkt
+		r.receive <- receivedPacket{pkt: &pkt, ecn: getECN(a)}
 
 		return i, attr, nil
 	})
@@ -121,13 +128,14 @@ func (r *ReceiverInterceptor) loop(rtcpWriter interceptor.RTCPWriter) {
 	defer ticker.Stop()
 	for {
 		select {
-		case pkt := <-r.receive:
+		case p := <-r.receive:
 			t := r.getTimeNTP(time.Now())
 
 			r.screamRxMu.Lock()
+			pkt := p.pkt
 			if rx, ok := r.screamRx[pkt.SSRC]; ok {
 				//fmt.Printf("receive pkt %v at t=%v\n", pkt.SequenceNumber, t)
-				rx.Receive(t, pkt.SSRC, pkt.MarshalSize(), pkt.SequenceNumber, 0)
+				rx.Receive(t, pkt.SSRC, pkt.MarshalSize(), pkt.SequenceNumber, p.ecn)
 			}
 			r.screamRxMu.Unlock()
 
@@ -4,9 +4,98 @@ package scream
 import (
 	"time"
 
+	"github.com/mengelbart/rtq-go-endpoint/internal/fec"
+	"github.com/mengelbart/rtq-go-endpoint/internal/nack"
 	"github.com/pion/interceptor"
 )
 
+// ecnAttributeKey is the key of the ECN codepoint in the attributes of
+// received RTP packets.
+type ecnAttributeKey struct{}
+
+// SetECN stores the ECN codepoint a packet was received with in attributes,
+// so that the ReceiverInterceptor can report it in the feedback.
+func SetECN(attributes interceptor.Attributes, ecn uint8) interceptor.Attributes {
+	if attributes == nil {
+		attributes = interceptor.Attributes{}
+	}
+	attributes[ecnAttributeKey{}] = ecn
+	return attributes
+}
+
+// getECN returns the ECN codepoint stored by SetECN, or 0 (Not-ECT).
+func getECN(attributes interceptor.Attributes) uint8 {
+	if ecn, ok := attributes[ecnAttributeKey{}].(uint8); ok {
+		return ecn
+	}
+	return 0
+}
+
+// priorityAttributeKey is the key of the priority in the attributes of local
+// streams.
+type priorityAttributeKey struct{}
+
+// SetPriority stores the priority of a local stream in the attributes of its
+// StreamInfo. SCReAM shares the bandwidth between the streams of a
+// SenderInterceptor according to their priorities, which range from 0
+// (exclusive) to 1, the highest priority and the default.
+func SetPriority(attributes interceptor.Attributes, priority float64) interceptor.Attributes {
+	if attributes == nil {
+		attributes = interceptor.Attributes{}
+	}
+	attributes[priorityAttributeKey{}] = priority
+	return attributes
+}
+
+// getPriority returns the priority stored by SetPriority, or 1.
+func getPriority(attributes interceptor.Attributes) float64 {
+	if priority, ok := attributes[priorityAttributeKey{}].(float64); ok {
+		return priority
+	}
+	return 1
+}
+
+// bitrateAttributeKey is the key of the bitrate range in the attributes of
+// local streams.
+type bitrateAttributeKey struct{}
+
+type bitrateRange struct {
+	min, start, max float64
+}
+
+// defaultBitrates is the bitrate range of streams without a range set by
+// SetBitrateRange: 1 Kbps (gstreamers x264enc minimum), starting at 100 Kbps
+// up to 2048 Mbps (gstreamers x264enc maximum).
+var defaultBitrates = bitrateRange{min: 1_000, start: 100_000, max: 2048000000}
+
+// SetBitrateRange stores the minimum, start and maximum target bitrate of a
+// local stream in bps in the attributes of its StreamInfo.
+func SetBitrateRange(attributes interceptor.Attributes, min, start, max float64) interceptor.Attributes {
+	if attributes == nil {
+		attributes = interceptor.Attributes{}
+	}
+	attributes[bitrateAttributeKey{}] = bitrateRange{min: min, start: start, max: max}
+	return attributes
+}
+
+// getBitrateRange returns the range stored by SetBitrateRange, or
+// defaultBitrates.
+func getBitrateRange(attributes interceptor.Attributes) bitrateRange {
+	if r, ok := attributes[bitrateAttributeKey{}].(bitrateRange); ok {
+		return r
+	}
+	return defaultBitrates
+}
+
+// repairedStream returns the SSRC of the stream repaired by an RTX or FEC
+// stream and whether the stream with the given attributes is one.
+func repairedStream(attributes interceptor.Attributes) (uint32, bool) {
+	if mediaSSRC, ok := nack.GetRTX(attributes); ok {
+		return mediaSSRC, true
+	}
+	return fec.GetFEC(attributes)
+}
+
 func streamSupportSCReAM(info *interceptor.StreamInfo) bool {
 	for _, fb := range info.RTCPFeedback {
 		if fb.Type == "ack" && fb.Parameter == "ccfb" {
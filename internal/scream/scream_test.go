@@ -0,0 +1,99 @@
+package scream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/mengelbart/rtq-go-endpoint/transport/loopbacktest"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+const (
+	testSSRC       = 1
+	testPacketSize = 100
+	mediaFlow      = 0
+	feedbackFlow   = 1
+)
+
+// runLoopback sends media at the target bitrate of a SenderInterceptor for
+// the given duration to a ReceiverInterceptor on the other end of a
+// loopback pair. It returns the target bitrate and loss rate at the end.
+func runLoopback(t *testing.T, duration time.Duration, opts ...transport.LoopbackOption) (float64, float64) {
+	t.Helper()
+	link := loopbacktest.New(t, opts...)
+	s, err := NewSenderInterceptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReceiverInterceptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &interceptor.StreamInfo{
+		SSRC:         testSSRC,
+		RTCPFeedback: []interceptor.RTCPFeedback{{Type: "ack", Parameter: "ccfb"}},
+	}
+
+	feedbackWriter, _ := link.B.Writer(feedbackFlow)
+	r.BindRTCPWriter(interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, _ interceptor.Attributes) (int, error) {
+		return feedbackWriter.WriteRTCP(pkts)
+	}))
+	mediaReader, _ := link.B.Reader(mediaFlow)
+	rtpReader := r.BindRemoteStream(info, interceptor.RTPReaderFunc(loopbacktest.FlowReader(mediaReader)))
+	link.Go(func() error {
+		_, _, err := rtpReader.Read(make([]byte, 1500), nil)
+		return err
+	})
+
+	mediaWriter, _ := link.A.Writer(mediaFlow)
+	writer := s.BindLocalStream(info, interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+		return mediaWriter.WriteRTP(header, payload)
+	}))
+	feedbackReader, _ := link.A.Reader(feedbackFlow)
+	rtcpReader := s.BindRTCPReader(interceptor.RTCPReaderFunc(loopbacktest.FlowReader(feedbackReader)))
+	link.Go(func() error {
+		_, _, err := rtcpReader.Read(make([]byte, 1500), nil)
+		return err
+	})
+
+	loopbacktest.SendMedia(t, writer, s, testSSRC, testPacketSize, duration)
+	bitrate, err := s.GetTargetBitrate(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loss := s.LossRate()
+
+	// The readers stop when the loopback is closed, the interceptors must
+	// be closed afterwards, since reading blocks on their loops.
+	link.Close()
+	s.Close()
+	r.Close()
+	return bitrate, loss
+}
+
+func TestSCReAMLoopback(t *testing.T) {
+	bitrate, loss := runLoopback(t, 3*time.Second, transport.LoopbackDelay(10*time.Millisecond))
+	t.Logf("target bitrate without loss: %v, loss rate %v", bitrate, loss)
+	if bitrate <= defaultBitrates.start {
+		t.Errorf("target bitrate %v did not increase from %v without loss", bitrate, defaultBitrates.start)
+	}
+	if loss > 0.01 {
+		t.Errorf("loss rate %v without loss", loss)
+	}
+
+	lossyBitrate, loss := runLoopback(t, 3*time.Second,
+		transport.LoopbackDelay(10*time.Millisecond),
+		transport.LoopbackLoss(0.1),
+		transport.LoopbackSeed(7),
+	)
+	t.Logf("target bitrate with 10%% loss: %v, loss rate %v", lossyBitrate, loss)
+	if lossyBitrate >= bitrate {
+		t.Errorf("target bitrate %v with loss is not below %v without loss", lossyBitrate, bitrate)
+	}
+	if loss < 0.03 || loss > 0.2 {
+		t.Errorf("loss rate %v, want about 0.1", loss)
+	}
+}
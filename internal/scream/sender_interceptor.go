@@ -3,6 +3,7 @@ package scream
 import (
 	"encoding/binary"
 	"fmt"
+	"math"
 	"sync"
 	"time"
 
@@ -42,6 +43,14 @@ type SenderInterceptor struct {
 	rtpStreams   map[uint32]*localStream
 	rtpStreamsMu sync.Mutex
 
+	// lossRate is a moving average of the fraction of packets which the
+	// feedback reports as not received. accounted holds the highest
+	// sequence number of each stream which was counted, so that packets
+	// which were not sent yet or were reported before are skipped.
+	lossRate   float64
+	accounted  map[uint32]uint16
+	lossRateMu sync.Mutex
+
 	t0 float64
 }
 
@@ -53,6 +62,7 @@ func NewSenderInterceptor(opts ...SenderOption) (*SenderInterceptor, error) {
 		log:         logging.NewDefaultLoggerFactory().NewLogger("scream_sender"),
 		newRTPQueue: newQueue,
 		rtpStreams:  map[uint32]*localStream{},
+		accounted:   map[uint32]uint16{},
 		t0:          getNTPT0(),
 	}
 	for _, opt := range opts {
@@ -88,11 +98,16 @@ func (s *SenderInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interc
 				continue
 			}
 
+			feedback := s.knownStreams(*packet)
+			if feedback == nil {
+				continue
+			}
 			s.m.Lock()
-			s.tx.IncomingStandardizedFeedback(t, b[:n])
+			s.tx.IncomingStandardizedFeedback(t, feedback)
 			s.m.Unlock()
 
-			ssrcs := extractSSRCs(*packet)
+			s.updateLossRate(feedback)
+			ssrcs := extractSSRCs(feedback)
 
 			for _, ssrc := range ssrcs {
 				s.rtpStreamsMu.Lock()
@@ -107,6 +122,57 @@ func (s *SenderInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interc
 	})
 }
 
+// knownStreams returns the feedback packet without the report blocks of
+// SSRCs which are not registered with SCReAM, like repair streams. SCReAM
+// stops parsing feedback at the first unknown SSRC. It returns nil if no
+// block is left or the packet is malformed. Other packets are returned
+// unchanged.
+func (s *SenderInterceptor) knownStreams(packet []byte) []byte {
+	// Header with the SSRC of the sender and the report timestamp.
+	if len(packet) < 12 {
+		return nil
+	}
+	if packet[1] != ccfbPacketType {
+		return packet
+	}
+	filtered := append([]byte(nil), packet[:8]...)
+	s.rtpStreamsMu.Lock()
+	defer s.rtpStreamsMu.Unlock()
+	blocks := 0
+	offset := 8
+	for offset < len(packet)-4 {
+		if offset+8 > len(packet)-4 {
+			return nil
+		}
+		ssrc := binary.BigEndian.Uint32(packet[offset:])
+		numReports := int(binary.BigEndian.Uint16(packet[offset+6:]))
+		// pad 16 bits 0 if numReports is not a multiple of 2
+		if numReports%2 != 0 {
+			numReports++
+		}
+		end := offset + 8 + 2*numReports
+		if end > len(packet)-4 {
+			return nil
+		}
+		if _, ok := s.rtpStreams[ssrc]; ok {
+			filtered = append(filtered, packet[offset:end]...)
+			blocks++
+		}
+		offset = end
+	}
+	if blocks == 0 {
+		return nil
+	}
+	filtered = append(filtered, packet[len(packet)-4:]...)
+	binary.BigEndian.PutUint16(filtered[2:], uint16(len(filtered)/4-1))
+	return filtered
+}
+
+// ccfbPacketType is the packet type of RFC 8888 feedback. SCReAM does not
+// set the format, so other transport layer feedback is told apart by the
+// RTCP parser, which only returns RawPackets for unknown formats.
+const ccfbPacketType = 205
+
 func extractSSRCs(packet []byte) []uint32 {
 	uniqueSSRCs := make(map[uint32]struct{})
 	var ssrcs []uint32
@@ -133,12 +199,94 @@ func extractSSRCs(packet []byte) []uint32 {
 	return ssrcs
 }
 
+// lossRateWeight is the weight of a reported packet in the moving average
+// of the loss rate.
+const lossRateWeight = 0.02
+
+// updateLossRate adds the packets which are reported by the feedback packet
+// to the moving average of the loss rate. Each packet is weighted equally,
+// independent of how many packets a feedback packet reports.
+func (s *SenderInterceptor) updateLossRate(packet []byte) {
+	s.lossRateMu.Lock()
+	defer s.lossRateMu.Unlock()
+	received, reported := s.countReceived(packet)
+	if reported == 0 {
+		return
+	}
+	// The weight of the feedback is that of applying the average once per
+	// reported packet.
+	weight := 1 - math.Pow(1-lossRateWeight, float64(reported))
+	lost := float64(reported-received) / float64(reported)
+	s.lossRate += weight * (lost - s.lossRate)
+}
+
+// countReceived returns the number of packets reported for the first time
+// in the metric blocks of the feedback packet and how many of them have the
+// received bit set. SCReAM reports a fixed window of sequence numbers up to
+// the highest received one, which may start before the first packet sent,
+// and may repeat a block, so only packets after the highest accounted
+// sequence number of each stream are counted. The caller must hold
+// lossRateMu.
+func (s *SenderInterceptor) countReceived(packet []byte) (received, reported int) {
+	offset := 8
+	for offset+8 <= len(packet)-4 {
+		ssrc := binary.BigEndian.Uint32(packet[offset:])
+		begin := binary.BigEndian.Uint16(packet[offset+4:])
+		numReports := int(binary.BigEndian.Uint16(packet[offset+6:]))
+		metrics := offset + 8
+		accounted, ok := s.accounted[ssrc]
+		for i := 0; ok && i < numReports && metrics+2*i+2 <= len(packet)-4; i++ {
+			seq := begin + uint16(i)
+			if int16(seq-accounted) <= 0 {
+				continue
+			}
+			accounted = seq
+			reported++
+			if packet[metrics+2*i]&0x80 != 0 {
+				received++
+			}
+		}
+		if ok {
+			s.accounted[ssrc] = accounted
+		}
+
+		// pad 16 bits 0 if numReports is not a multiple of 2
+		if numReports%2 != 0 {
+			numReports++
+		}
+		offset += 2 * numReports
+		offset += 8
+	}
+	return received, reported
+}
+
+// transmitted starts the loss accounting of the stream ssrc with the first
+// packet sent, seq.
+func (s *SenderInterceptor) transmitted(ssrc uint32, seq uint16) {
+	s.lossRateMu.Lock()
+	defer s.lossRateMu.Unlock()
+	if _, ok := s.accounted[ssrc]; !ok {
+		s.accounted[ssrc] = seq - 1
+	}
+}
+
+// LossRate returns a moving average of the fraction of packets which the
+// feedback reported as lost.
+func (s *SenderInterceptor) LossRate() float64 {
+	s.lossRateMu.Lock()
+	defer s.lossRateMu.Unlock()
+	return s.lossRate
+}
+
 // BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
 // will be called once per rtp packet.
 func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
 	if !streamSupportSCReAM(info) {
 		return writer
 	}
+	if mediaSSRC, ok := repairedStream(info.Attributes); ok {
+		return s.bindRepairStream(info.SSRC, mediaSSRC, writer)
+	}
 
 	s.m.Lock()
 	defer s.m.Unlock()
@@ -154,18 +302,16 @@ func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer
 		queue:       rtpQueue,
 		newFrame:    make(chan struct{}),
 		newFeedback: make(chan struct{}),
+		close:       make(chan struct{}),
 	}
 	s.rtpStreamsMu.Lock()
 	s.rtpStreams[info.SSRC] = localStream
 	s.rtpStreamsMu.Unlock()
 
-	// TODO: Somehow set these attributes per stream
-	priority := float64(1)            // highest priority
-	minBitrate := float64(1_000)      // 1 Kbps (gstreamers x264enc minimum)
-	startBitrate := float64(100_000)  // 100 Kbps
-	maxBitrate := float64(2048000000) // 2048 Mbps (gstreamers x264enc maximum)
+	priority := getPriority(info.Attributes)
+	bitrates := getBitrateRange(info.Attributes)
 
-	s.tx.RegisterNewStream(rtpQueue, info.SSRC, priority, minBitrate, startBitrate, maxBitrate)
+	s.tx.RegisterNewStream(rtpQueue, info.SSRC, priority, bitrates.min, bitrates.start, bitrates.max)
 
 	go s.loop(writer, info.SSRC)
 
@@ -185,12 +331,47 @@ func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer
 	})
 }
 
+// bindRepairStream returns the writer of the RTX or FEC stream ssrc, which
+// repairs the stream mediaSSRC. Repair packets share the queue of the media
+// stream, so that they count towards its bitrate instead of being a
+// separate SCReAM stream. They are not added to the packets in flight,
+// since their sequence numbers are not those of the media stream.
+func (s *SenderInterceptor) bindRepairStream(ssrc, mediaSSRC uint32, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	s.rtpStreamsMu.Lock()
+	stream, ok := s.rtpStreams[mediaSSRC]
+	s.rtpStreamsMu.Unlock()
+	if !ok {
+		s.log.Warnf("no stream %v for repair stream %v, sending it without congestion control", mediaSSRC, ssrc)
+		return writer
+	}
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		t := s.getTimeNTP(time.Now())
+		pkt := &rtp.Packet{Header: *header, Payload: payload}
+		stream.queue.Enqueue(pkt, float64(t)/65536.0)
+		size := pkt.MarshalSize()
+		s.m.Lock()
+		s.tx.NewMediaFrame(t, mediaSSRC, size)
+		s.m.Unlock()
+		stream.newFeedback <- struct{}{}
+		return size, nil
+	})
+}
+
 // UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
 func (s *SenderInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
 	s.rtpStreamsMu.Lock()
 	defer s.rtpStreamsMu.Unlock()
-	close(s.rtpStreams[info.SSRC].close)
+	stream, ok := s.rtpStreams[info.SSRC]
+	if !ok {
+		// Repair and unsupported streams are not registered.
+		return
+	}
+	close(stream.close)
 	delete(s.rtpStreams, info.SSRC)
+
+	s.lossRateMu.Lock()
+	delete(s.accounted, info.SSRC)
+	s.lossRateMu.Unlock()
 }
 
 // Close closes the interceptor
@@ -213,45 +394,68 @@ func (s *SenderInterceptor) loop(writer interceptor.RTPWriter, ssrc uint32) {
 
 	defer s.log.Infof("leave send loop for ssrc: %v", ssrc)
 
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
 	for {
 		select {
 		case <-stream.newFrame:
 		case <-stream.newFeedback:
+		case <-timer.C:
+		case <-stream.close:
+			return
 		case <-s.close:
 			return
-		default:
 		}
 
-		if stream.queue.SizeOfQueue() <= 0 {
-			continue
+		wait := s.transmitQueued(writer, stream, ssrc)
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
 		}
+		timer.Reset(wait)
+	}
+}
 
+// pollInterval is how long the send loop waits for new packets or feedback
+// before it asks SCReAM again, so that its timers make progress.
+const pollInterval = 10 * time.Millisecond
+
+// transmitQueued sends the queued packets of the stream ssrc as long as
+// SCReAM allows it. It returns how long to wait before trying again.
+func (s *SenderInterceptor) transmitQueued(writer interceptor.RTPWriter, stream *localStream, ssrc uint32) time.Duration {
+	for stream.queue.SizeOfQueue() > 0 {
 		s.m.Lock()
 		transmit := s.tx.IsOkToTransmit(s.getTimeNTP(time.Now()), ssrc)
 		s.m.Unlock()
 		switch {
 		case transmit == -1:
 			// no packets or CWND too small
-			continue
+			return pollInterval
+		case transmit > 1e-3:
+			// paced, transmit is the time until the next packet in seconds
+			return time.Duration(transmit * float64(time.Second))
+		}
 
-		case transmit <= 1e-3:
-			// send packet
-			packet := stream.queue.Dequeue()
-			if packet == nil {
-				continue
-			}
-			// TODO: Forward attributes from above?
-			if _, err := writer.Write(&packet.Header, packet.Payload, interceptor.Attributes{}); err != nil {
-				s.log.Warnf("failed sending RTP packet: %+v", err)
-			}
-			s.m.Lock()
-			transmit = s.tx.AddTransmitted(s.getTimeNTP(time.Now()), ssrc, packet.MarshalSize(), packet.SequenceNumber, packet.Marker)
-			s.m.Unlock()
-			if transmit == -1 {
-				continue
-			}
+		packet := stream.queue.Dequeue()
+		if packet == nil {
+			break
 		}
+		// TODO: Forward attributes from above?
+		if _, err := writer.Write(&packet.Header, packet.Payload, interceptor.Attributes{}); err != nil {
+			s.log.Warnf("failed sending RTP packet: %+v", err)
+		}
+		if packet.SSRC != ssrc {
+			// Repair packets are not reported for this stream.
+			continue
+		}
+		s.transmitted(ssrc, packet.SequenceNumber)
+		s.m.Lock()
+		s.tx.AddTransmitted(s.getTimeNTP(time.Now()), ssrc, packet.MarshalSize(), packet.SequenceNumber, packet.Marker)
+		s.m.Unlock()
 	}
+	return pollInterval
 }
 
 // GetTargetBitrate returns the target bitrate calculated by SCReAM in bps.
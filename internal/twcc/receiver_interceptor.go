@@ -0,0 +1,141 @@
+package twcc
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// ReceiverInterceptor records the arrival times of the packets of remote
+// streams which carry a transport-wide sequence number and reports them in
+// transport-cc feedback every interval. It should be bound farthest from
+// the application, so that the arrival times do not include the time
+// spent in other interceptors.
+type ReceiverInterceptor struct {
+	interceptor.NoOp
+	interval time.Duration
+	log      logging.LeveledLogger
+
+	recorder   *recorder
+	recorderMu sync.Mutex
+
+	m     sync.Mutex
+	wg    sync.WaitGroup
+	close chan struct{}
+}
+
+// NewReceiverInterceptor returns a new ReceiverInterceptor.
+func NewReceiverInterceptor(opts ...ReceiverOption) (*ReceiverInterceptor, error) {
+	r := &ReceiverInterceptor{
+		interval: 100 * time.Millisecond,
+		log:      logging.NewDefaultLoggerFactory().NewLogger("twcc_receiver"),
+		recorder: newRecorder(rand.Uint32()), // #nosec
+		close:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// BindRTCPWriter lets you modify any outgoing RTCP packets. It is called once per PeerConnection. The returned method
+// will be called once per packet batch.
+func (r *ReceiverInterceptor) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.isClosed() {
+		return writer
+	}
+
+	r.wg.Add(1)
+
+	go r.loop(writer)
+
+	return writer
+}
+
+// BindRemoteStream lets you modify any incoming RTP packets. It is called once for per RemoteStream. The returned method
+// will be called once per rtp packet.
+func (r *ReceiverInterceptor) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	id, ok := extensionID(info)
+	if !ok {
+		return reader
+	}
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		arrival := time.Now()
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		var header rtp.Header
+		if _, err = header.Unmarshal(b[:i]); err != nil {
+			return 0, nil, err
+		}
+		ext := header.GetExtension(id)
+		if ext == nil {
+			return i, attr, nil
+		}
+		var tcc rtp.TransportCCExtension
+		if err = tcc.Unmarshal(ext); err != nil {
+			return 0, nil, err
+		}
+		r.recorderMu.Lock()
+		r.recorder.record(header.SSRC, tcc.TransportSequence, arrival)
+		r.recorderMu.Unlock()
+		return i, attr, nil
+	})
+}
+
+// Close closes the interceptor.
+func (r *ReceiverInterceptor) Close() error {
+	defer r.wg.Wait()
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if !r.isClosed() {
+		close(r.close)
+	}
+	return nil
+}
+
+func (r *ReceiverInterceptor) loop(rtcpWriter interceptor.RTCPWriter) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.recorderMu.Lock()
+			pkts := r.recorder.feedback()
+			r.recorderMu.Unlock()
+			// Each feedback packet is sent on its own, so that a
+			// burst of packets does not exceed the MTU.
+			for _, pkt := range pkts {
+				if _, err := rtcpWriter.Write([]rtcp.Packet{pkt}, interceptor.Attributes{}); err != nil {
+					r.log.Warnf("failed sending transport-cc feedback: %+v", err)
+				}
+			}
+
+		case <-r.close:
+			return
+		}
+	}
+}
+
+func (r *ReceiverInterceptor) isClosed() bool {
+	select {
+	case <-r.close:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,30 @@
+package twcc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/logging"
+)
+
+// ReceiverOption can be used to configure ReceiverInterceptor.
+type ReceiverOption func(r *ReceiverInterceptor) error
+
+// ReceiverInterval sets the interval at which feedback is sent.
+func ReceiverInterval(interval time.Duration) ReceiverOption {
+	return func(r *ReceiverInterceptor) error {
+		if interval <= 0 {
+			return fmt.Errorf("invalid feedback interval: %v", interval)
+		}
+		r.interval = interval
+		return nil
+	}
+}
+
+// ReceiverLog sets a logger for the interceptor.
+func ReceiverLog(log logging.LeveledLogger) ReceiverOption {
+	return func(r *ReceiverInterceptor) error {
+		r.log = log
+		return nil
+	}
+}
@@ -0,0 +1,177 @@
+package twcc
+
+import (
+	"math"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+const (
+	// tick is the resolution of the receive deltas.
+	tick = rtcp.TypeTCCDeltaScaleFactor * time.Microsecond
+	// referenceTicks is the number of ticks in a unit of the reference
+	// time, which is a multiple of 64ms.
+	referenceTicks = int64(64 * time.Millisecond / tick)
+	// maxStatusCount is the largest number of packets reported by a
+	// single feedback packet, which keeps it well below the MTU.
+	maxStatusCount = 256
+)
+
+// recorder collects the arrival times of packets and builds the feedback
+// packets which report them.
+type recorder struct {
+	senderSSRC uint32
+	mediaSSRC  uint32
+	start      time.Time
+	fbCount    uint8
+
+	started bool
+	// highest is the highest unwrapped transport-wide sequence number
+	// received.
+	highest int64
+	// next is the first unwrapped sequence number which is not reported
+	// yet.
+	next int64
+	// arrivals holds the arrival times of the packets which are not
+	// reported yet in ticks since start.
+	arrivals map[int64]int64
+}
+
+func newRecorder(senderSSRC uint32) *recorder {
+	return &recorder{
+		senderSSRC: senderSSRC,
+		start:      time.Now(),
+		arrivals:   map[int64]int64{},
+	}
+}
+
+// record adds the arrival of the packet with the transport-wide sequence
+// number seq. Packets which arrive after they were reported as lost are
+// dropped.
+func (r *recorder) record(ssrc uint32, seq uint16, arrival time.Time) {
+	r.mediaSSRC = ssrc
+	unwrapped := int64(seq)
+	if r.started {
+		unwrapped = r.highest + int64(int16(seq-uint16(r.highest)))
+	} else {
+		r.started = true
+		r.highest = unwrapped
+		r.next = unwrapped
+	}
+	if unwrapped < r.next {
+		return
+	}
+	if unwrapped > r.highest {
+		r.highest = unwrapped
+	}
+	r.arrivals[unwrapped] = int64(arrival.Sub(r.start) / tick)
+}
+
+// feedback returns the feedback packets which report the packets up to the
+// highest received one.
+func (r *recorder) feedback() []rtcp.Packet {
+	if len(r.arrivals) == 0 {
+		return nil
+	}
+	var pkts []rtcp.Packet
+	for r.next <= r.highest {
+		pkts = append(pkts, r.packet())
+	}
+	return pkts
+}
+
+// packet returns the next feedback packet, which starts at r.next. The
+// reference time is taken from the first received packet. If the receive
+// delta of a packet does not fit, the packet is reported by the next
+// feedback packet with a new reference time.
+func (r *recorder) packet() *rtcp.TransportLayerCC {
+	seq := r.next
+	first, ok := r.arrivals[seq]
+	for ; !ok; first, ok = r.arrivals[seq] {
+		seq++
+	}
+	reference := first / referenceTicks
+	last := reference * referenceTicks
+	fb := &rtcp.TransportLayerCC{
+		SenderSSRC:         r.senderSSRC,
+		MediaSSRC:          r.mediaSSRC,
+		BaseSequenceNumber: uint16(r.next),
+		ReferenceTime:      uint32(reference) & 0xFFFFFF,
+		FbPktCount:         r.fbCount,
+	}
+	r.fbCount++
+
+	var statuses []uint16
+	deltaLength := 0
+	for seq = r.next; seq <= r.highest && len(statuses) < maxStatusCount; seq++ {
+		arrival, ok := r.arrivals[seq]
+		if !ok {
+			statuses = append(statuses, rtcp.TypeTCCPacketNotReceived)
+			continue
+		}
+		delta := arrival - last
+		if delta < math.MinInt16 || delta > math.MaxInt16 {
+			break
+		}
+		status := uint16(rtcp.TypeTCCPacketReceivedSmallDelta)
+		deltaLength++
+		if delta < 0 || delta > math.MaxUint8 {
+			status = rtcp.TypeTCCPacketReceivedLargeDelta
+			deltaLength++
+		}
+		statuses = append(statuses, status)
+		fb.RecvDeltas = append(fb.RecvDeltas, &rtcp.RecvDelta{
+			Type:  status,
+			Delta: delta * rtcp.TypeTCCDeltaScaleFactor,
+		})
+		last = arrival
+		delete(r.arrivals, seq)
+	}
+	r.next = seq
+
+	fb.PacketStatusCount = uint16(len(statuses))
+	fb.PacketChunks = chunks(statuses)
+	// RTCP header, SSRCs, base sequence number, status count, reference
+	// time, feedback packet count, chunks and deltas.
+	length := 4 + 16 + 2*len(fb.PacketChunks) + deltaLength
+	fb.Header = rtcp.Header{
+		Padding: length%4 != 0,
+		Count:   rtcp.FormatTCC,
+		Type:    rtcp.TypeTransportSpecificFeedback,
+		Length:  uint16((length+3)/4 - 1),
+	}
+	return fb
+}
+
+// chunks encodes statuses in run length chunks for runs of at least seven
+// equal statuses and in two bit status vector chunks otherwise.
+func chunks(statuses []uint16) []rtcp.PacketStatusChunk {
+	var chunks []rtcp.PacketStatusChunk
+	for i := 0; i < len(statuses); {
+		run := 1
+		for i+run < len(statuses) && statuses[i+run] == statuses[i] && run < 1<<13-1 {
+			run++
+		}
+		if run >= 7 {
+			chunks = append(chunks, &rtcp.RunLengthChunk{
+				Type:               rtcp.TypeTCCRunLengthChunk,
+				PacketStatusSymbol: statuses[i],
+				RunLength:          uint16(run),
+			})
+			i += run
+			continue
+		}
+		// The symbols after the last status are padded with "not
+		// received".
+		symbols := make([]uint16, 7)
+		n := copy(symbols, statuses[i:])
+		chunks = append(chunks, &rtcp.StatusVectorChunk{
+			Type:       rtcp.TypeTCCStatusVectorChunk,
+			SymbolSize: rtcp.TypeTCCSymbolSizeTwoBit,
+			SymbolList: symbols,
+		})
+		i += n
+	}
+	return chunks
+}
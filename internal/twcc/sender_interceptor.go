@@ -0,0 +1,180 @@
+package twcc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// PacketResult is the feedback about a packet sent on a local stream.
+type PacketResult struct {
+	SSRC                    uint32
+	SequenceNumber          uint16
+	TransportSequenceNumber uint16
+	// Size is the size of the RTP packet in bytes.
+	Size      int
+	Departure time.Time
+	Received  bool
+	// Arrival is the arrival time on the clock of the receiver, only the
+	// differences between the arrival times of packets are meaningful.
+	Arrival time.Duration
+}
+
+// sentPacket is a packet in the history of the SenderInterceptor.
+type sentPacket struct {
+	valid                   bool
+	ssrc                    uint32
+	sequenceNumber          uint16
+	transportSequenceNumber uint16
+	size                    int
+	departure               time.Time
+}
+
+// SenderInterceptor adds the transport-wide sequence number header extension
+// to the packets of local streams which support transport-cc feedback and
+// passes the arrival times reported by the feedback to a handler. It should
+// be bound closest to the connection, so that the departure times do not
+// include the time spent in queues of other interceptors.
+type SenderInterceptor struct {
+	interceptor.NoOp
+	handler func([]PacketResult)
+	log     logging.LeveledLogger
+
+	mu      sync.Mutex
+	seq     uint16
+	history []sentPacket
+}
+
+// NewSenderInterceptor returns a new SenderInterceptor.
+func NewSenderInterceptor(opts ...SenderOption) (*SenderInterceptor, error) {
+	s := &SenderInterceptor{
+		log:     logging.NewDefaultLoggerFactory().NewLogger("twcc_sender"),
+		history: make([]sentPacket, 1<<13),
+	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
+// will be called once per rtp packet.
+func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	id, ok := extensionID(info)
+	if !ok {
+		return writer
+	}
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		h := header.Clone()
+		s.mu.Lock()
+		seq := s.seq
+		s.seq++
+		ext, err := (&rtp.TransportCCExtension{TransportSequence: seq}).Marshal()
+		if err == nil {
+			err = h.SetExtension(id, ext)
+		}
+		if err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+		s.history[int(seq)%len(s.history)] = sentPacket{
+			valid:                   true,
+			ssrc:                    h.SSRC,
+			sequenceNumber:          h.SequenceNumber,
+			transportSequenceNumber: seq,
+			size:                    h.MarshalSize() + len(payload),
+			departure:               time.Now(),
+		}
+		s.mu.Unlock()
+		return writer.Write(&h, payload, attributes)
+	})
+}
+
+// BindRTCPReader lets you modify any incoming RTCP packets. It is called once per sender/receiver, however this might
+// change in the future. The returned method will be called once per packet batch.
+func (s *SenderInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkts, err := rtcp.Unmarshal(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, pkt := range pkts {
+			fb, ok := pkt.(*rtcp.TransportLayerCC)
+			if !ok {
+				continue
+			}
+			results := s.results(fb)
+			if len(results) > 0 && s.handler != nil {
+				s.handler(results)
+			}
+		}
+		return i, attr, nil
+	})
+}
+
+// results returns the results of the packets reported by fb which are still
+// in the history.
+func (s *SenderInterceptor) results(fb *rtcp.TransportLayerCC) []PacketResult {
+	results := make([]PacketResult, 0, fb.PacketStatusCount)
+	arrival := time.Duration(fb.ReferenceTime) * 64 * time.Millisecond
+	deltas := fb.RecvDeltas
+	seq := fb.BaseSequenceNumber
+	remaining := int(fb.PacketStatusCount)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report := func(symbol uint16) {
+		received := symbol == rtcp.TypeTCCPacketReceivedSmallDelta || symbol == rtcp.TypeTCCPacketReceivedLargeDelta
+		if received {
+			if len(deltas) == 0 {
+				s.log.Warnf("feedback %v misses receive deltas", fb.FbPktCount)
+				remaining = 0
+				return
+			}
+			arrival += time.Duration(deltas[0].Delta) * time.Microsecond
+			deltas = deltas[1:]
+		}
+		if sent := s.history[int(seq)%len(s.history)]; sent.valid && sent.transportSequenceNumber == seq {
+			result := PacketResult{
+				SSRC:                    sent.ssrc,
+				SequenceNumber:          sent.sequenceNumber,
+				TransportSequenceNumber: seq,
+				Size:                    sent.size,
+				Departure:               sent.departure,
+				Received:                received,
+			}
+			if received {
+				result.Arrival = arrival
+			}
+			results = append(results, result)
+		}
+		seq++
+		remaining--
+	}
+	for _, chunk := range fb.PacketChunks {
+		switch c := chunk.(type) {
+		case *rtcp.RunLengthChunk:
+			for j := uint16(0); j < c.RunLength && remaining > 0; j++ {
+				report(c.PacketStatusSymbol)
+			}
+		case *rtcp.StatusVectorChunk:
+			for _, symbol := range c.SymbolList {
+				if remaining <= 0 {
+					break
+				}
+				report(symbol)
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,25 @@
+package twcc
+
+import "github.com/pion/logging"
+
+// SenderOption can be used to configure SenderInterceptor.
+type SenderOption func(s *SenderInterceptor) error
+
+// SenderHandler sets the function which is called with the results of the
+// packets reported by each feedback packet, e.g. to run a congestion
+// controller on them. It is called on the goroutine which reads the RTCP
+// packets and should not block.
+func SenderHandler(handler func([]PacketResult)) SenderOption {
+	return func(s *SenderInterceptor) error {
+		s.handler = handler
+		return nil
+	}
+}
+
+// SenderLog sets a logger for the interceptor.
+func SenderLog(log logging.LeveledLogger) SenderOption {
+	return func(s *SenderInterceptor) error {
+		s.log = log
+		return nil
+	}
+}
@@ -0,0 +1,40 @@
+// Package twcc provides interceptors for transport-wide congestion control
+// (draft-holmer-rmcat-transport-wide-cc-extensions-01). The sender numbers
+// all outgoing RTP packets with a transport-wide sequence number in a
+// header extension, the receiver reports their arrival times in
+// transport-cc RTCP feedback.
+package twcc
+
+import (
+	"github.com/pion/interceptor"
+)
+
+// TransportCCURI is the URI of the transport-wide sequence number header
+// extension.
+const TransportCCURI = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+
+// Overhead is the number of bytes the SenderInterceptor adds to packets
+// without header extensions: the one-byte header extension header and the
+// two byte sequence number with its ID and length, padded to 32 bits.
+const Overhead = 8
+
+// extensionID returns the ID of the transport-wide sequence number header
+// extension of the stream and whether the stream supports transport-cc
+// feedback.
+func extensionID(info *interceptor.StreamInfo) (uint8, bool) {
+	supported := false
+	for _, fb := range info.RTCPFeedback {
+		if fb.Type == "transport-cc" {
+			supported = true
+		}
+	}
+	if !supported {
+		return 0, false
+	}
+	for _, ext := range info.RTPHeaderExtensions {
+		if ext.URI == TransportCCURI && ext.ID > 0 && ext.ID < 15 {
+			return uint8(ext.ID), true
+		}
+	}
+	return 0, false
+}
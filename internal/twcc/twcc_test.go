@@ -0,0 +1,110 @@
+package twcc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// TestFeedback sends packets through a SenderInterceptor, reports a subset
+// of them with a recorder and checks the results of the marshaled feedback.
+func TestFeedback(t *testing.T) {
+	var results []PacketResult
+	s, err := NewSenderInterceptor(SenderHandler(func(r []PacketResult) {
+		results = append(results, r...)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &interceptor.StreamInfo{
+		SSRC:                1,
+		RTCPFeedback:        []interceptor.RTCPFeedback{{Type: "transport-cc"}},
+		RTPHeaderExtensions: []interceptor.RTPHeaderExtension{{URI: TransportCCURI, ID: 3}},
+	}
+	r := newRecorder(2)
+	start := r.start
+	// Packets 20 to 39 are lost, so that they are reported by a run length
+	// chunk, packet 41 arrives 500ms after packet 40, which needs a large
+	// delta, and packet 42 arrives before packet 41.
+	arrivals := map[uint16]time.Duration{}
+	for seq := uint16(0); seq < 20; seq++ {
+		arrivals[seq] = time.Duration(seq) * time.Millisecond
+	}
+	arrivals[40] = 40 * time.Millisecond
+	arrivals[41] = 540 * time.Millisecond
+	arrivals[42] = 530 * time.Millisecond
+
+	received := map[uint16]bool{}
+	writer := s.BindLocalStream(info, interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+		var ext rtp.TransportCCExtension
+		if err := ext.Unmarshal(header.GetExtension(3)); err != nil {
+			t.Fatalf("failed to parse transport-wide sequence number: %v", err)
+		}
+		if arrival, ok := arrivals[ext.TransportSequence]; ok {
+			r.record(header.SSRC, ext.TransportSequence, start.Add(arrival))
+			received[header.SequenceNumber] = true
+		}
+		return len(payload), nil
+	}))
+	for seq := uint16(0); seq < 43; seq++ {
+		header := &rtp.Header{Version: 2, SSRC: 1, SequenceNumber: 1000 + seq}
+		if _, err := writer.Write(header, make([]byte, 100), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf, err := rtcp.Marshal(r.feedback())
+	if err != nil {
+		t.Fatalf("failed to marshal feedback: %v", err)
+	}
+	reader := s.BindRTCPReader(interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		return copy(b, buf), a, nil
+	}))
+	if _, _, err := reader.Read(make([]byte, 1500), nil); err != nil {
+		t.Fatalf("failed to read feedback: %v", err)
+	}
+
+	if len(results) != 43 {
+		t.Fatalf("got %v results, want 43", len(results))
+	}
+	var first time.Duration
+	for i, result := range results {
+		if result.TransportSequenceNumber != uint16(i) || result.SequenceNumber != 1000+uint16(i) {
+			t.Fatalf("result %v reports packet %v with transport-wide sequence number %v", i, result.SequenceNumber, result.TransportSequenceNumber)
+		}
+		if result.Received != received[result.SequenceNumber] {
+			t.Errorf("packet %v: got received %v", i, result.Received)
+		}
+		if !result.Received {
+			continue
+		}
+		if i == 0 {
+			first = result.Arrival
+		}
+		if got, want := result.Arrival-first, arrivals[uint16(i)]; got != want {
+			t.Errorf("packet %v: arrived %v after the first, want %v", i, got, want)
+		}
+	}
+}
+
+func TestRecorderLateArrival(t *testing.T) {
+	r := newRecorder(2)
+	r.record(1, 65535, r.start)
+	r.record(1, 1, r.start.Add(time.Millisecond))
+	fb := r.feedback()
+	if len(fb) != 1 {
+		t.Fatalf("got %v feedback packets, want 1", len(fb))
+	}
+	cc := fb[0].(*rtcp.TransportLayerCC)
+	if cc.BaseSequenceNumber != 65535 || cc.PacketStatusCount != 3 {
+		t.Errorf("got base %v and count %v, want 65535 and 3", cc.BaseSequenceNumber, cc.PacketStatusCount)
+	}
+	// Packet 0 was reported as lost and is not reported again.
+	r.record(1, 0, r.start.Add(2*time.Millisecond))
+	if fb := r.feedback(); len(fb) != 0 {
+		t.Errorf("got feedback %v for a packet reported as lost", fb)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/lucas-clemente/quic-go/logging"
@@ -43,6 +44,30 @@ func GetCCStatLogWriter() (io.WriteCloser, error) {
 	return getFileLogWriter(logFilename)
 }
 
+func GetPacerLogWriter() (io.WriteCloser, error) {
+	logFilename := os.Getenv("PACERLOGFILE")
+	if len(logFilename) == 0 {
+		return NopCloser{Writer: os.Stdout}, nil
+	}
+	return getFileLogWriter(logFilename)
+}
+
+func GetRTTLogWriter() (io.WriteCloser, error) {
+	logFilename := os.Getenv("RTTLOGFILE")
+	if len(logFilename) == 0 {
+		return NopCloser{Writer: os.Stdout}, nil
+	}
+	return getFileLogWriter(logFilename)
+}
+
+func GetTWCCLogWriter() (io.WriteCloser, error) {
+	logFilename := os.Getenv("TWCCLOGFILE")
+	if len(logFilename) == 0 {
+		return NopCloser{Writer: os.Stdout}, nil
+	}
+	return getFileLogWriter(logFilename)
+}
+
 func GetStreamLogWriter() (io.WriteCloser, error) {
 	logFilename := os.Getenv("STREAMLOGFILE")
 	if len(logFilename) == 0 {
@@ -107,3 +132,21 @@ func GetRTPLogWriter() (func(string) io.WriteCloser, error) {
 		return w
 	}, nil
 }
+
+// SessionFilename inserts the name of a session before the extension of
+// path, so that several sessions served by one process write to different
+// files.
+func SessionFilename(path, session string) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(path, ext), session, ext)
+}
+
+// GetSessionStreamLogWriter is like GetStreamLogWriter, but writes to a
+// separate file for each session.
+func GetSessionStreamLogWriter(session string) (io.WriteCloser, error) {
+	logFilename := os.Getenv("STREAMLOGFILE")
+	if len(logFilename) == 0 {
+		return NopCloser{Writer: os.Stdout}, nil
+	}
+	return getFileLogWriter(SessionFilename(logFilename, session))
+}
@@ -0,0 +1,241 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/rtp"
+)
+
+const (
+	// DefaultPacingFactor is the factor the target bitrate is multiplied by
+	// to get the pacing rate. A factor above one lets the pacer drain queues
+	// built up by frames larger than the average.
+	DefaultPacingFactor = 1.5
+	// DefaultPacingBurst is the number of bytes which may be sent back to
+	// back without pacing.
+	DefaultPacingBurst = 2400
+
+	pacerQueueSize = 10_000
+)
+
+// ErrPacerClosed is returned when writing to a closed PacerInterceptor.
+var ErrPacerClosed = errors.New("pacer closed")
+
+// BitrateSource provides the target bitrate of a stream in bps, usually a
+// congestion controller.
+type BitrateSource interface {
+	GetTargetBitrate(ssrc uint32) (float64, error)
+}
+
+type pacedPacket struct {
+	writer     interceptor.RTPWriter
+	header     rtp.Header
+	payload    []byte
+	attributes interceptor.Attributes
+	enqueued   time.Time
+}
+
+// PacerInterceptor spreads outgoing RTP packets of all local streams over
+// time. Packets are sent at the sum of the target bitrates of the streams
+// multiplied by a pacing factor. The pacer keeps a budget of bytes, which
+// grows at the pacing rate up to the burst allowance, and holds back
+// packets while the budget is negative. As long as the rate is unknown,
+// packets are sent immediately.
+type PacerInterceptor struct {
+	interceptor.NoOp
+
+	source BitrateSource
+	factor float64
+	burst  int
+	logger io.Writer
+
+	close chan struct{}
+	wg    sync.WaitGroup
+	queue chan *pacedPacket
+	log   logging.LeveledLogger
+
+	ssrcsMu sync.Mutex
+	ssrcs   map[uint32]struct{}
+}
+
+// PacerOption can be used to configure PacerInterceptor.
+type PacerOption func(*PacerInterceptor) error
+
+// PacingFactor sets the factor the target bitrate is multiplied by.
+func PacingFactor(factor float64) PacerOption {
+	return func(p *PacerInterceptor) error {
+		if factor <= 0 {
+			return fmt.Errorf("invalid pacing factor: %v", factor)
+		}
+		p.factor = factor
+		return nil
+	}
+}
+
+// PacingBurst sets the number of bytes which may be sent back to back.
+func PacingBurst(bytes int) PacerOption {
+	return func(p *PacerInterceptor) error {
+		if bytes < 0 {
+			return fmt.Errorf("invalid pacing burst: %v", bytes)
+		}
+		p.burst = bytes
+		return nil
+	}
+}
+
+// PacerLog logs a line for every paced packet to w.
+func PacerLog(w io.Writer) PacerOption {
+	return func(p *PacerInterceptor) error {
+		p.logger = w
+		return nil
+	}
+}
+
+// NewPacerInterceptor returns a PacerInterceptor which paces packets at the
+// target bitrate provided by source.
+func NewPacerInterceptor(source BitrateSource, opts ...PacerOption) (*PacerInterceptor, error) {
+	p := &PacerInterceptor{
+		source: source,
+		factor: DefaultPacingFactor,
+		burst:  DefaultPacingBurst,
+		close:  make(chan struct{}),
+		queue:  make(chan *pacedPacket, pacerQueueSize),
+		log:    logging.NewDefaultLoggerFactory().NewLogger("pacer"),
+		ssrcs:  map[uint32]struct{}{},
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	p.wg.Add(1)
+	go p.loop()
+	return p, nil
+}
+
+// BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
+// will be called once per rtp packet.
+func (p *PacerInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	p.ssrcsMu.Lock()
+	p.ssrcs[info.SSRC] = struct{}{}
+	p.ssrcsMu.Unlock()
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		pkt := &pacedPacket{
+			writer:     writer,
+			header:     *header,
+			payload:    payload,
+			attributes: attributes,
+			enqueued:   time.Now(),
+		}
+		select {
+		case p.queue <- pkt:
+		case <-p.close:
+			return 0, ErrPacerClosed
+		}
+		return header.MarshalSize() + len(payload), nil
+	})
+}
+
+// UnbindLocalStream is called when the Stream is removed. It can be used to clean up any data related to that track.
+func (p *PacerInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	p.ssrcsMu.Lock()
+	defer p.ssrcsMu.Unlock()
+	delete(p.ssrcs, info.SSRC)
+}
+
+// Close stops sending packets, packets which are still queued are dropped.
+func (p *PacerInterceptor) Close() error {
+	defer p.wg.Wait()
+	if !p.isClosed() {
+		close(p.close)
+	}
+	return nil
+}
+
+func (p *PacerInterceptor) isClosed() bool {
+	select {
+	case <-p.close:
+		return true
+	default:
+		return false
+	}
+}
+
+// rate returns the pacing rate in bps, or 0 if no stream has a target
+// bitrate yet.
+func (p *PacerInterceptor) rate() float64 {
+	p.ssrcsMu.Lock()
+	defer p.ssrcsMu.Unlock()
+	var sum float64
+	for ssrc := range p.ssrcs {
+		bps, err := p.source.GetTargetBitrate(ssrc)
+		if err != nil || bps <= 0 {
+			continue
+		}
+		sum += bps
+	}
+	return sum * p.factor
+}
+
+func (p *PacerInterceptor) loop() {
+	defer p.wg.Done()
+
+	start := time.Now()
+	budget := float64(p.burst)
+	last := start
+	// refill adds the bytes earned since the last refill at rate to the
+	// budget.
+	refill := func(now time.Time, rate float64) {
+		budget += rate / 8 * now.Sub(last).Seconds()
+		if budget > float64(p.burst) {
+			budget = float64(p.burst)
+		}
+		last = now
+	}
+
+	for {
+		var pkt *pacedPacket
+		select {
+		case pkt = <-p.queue:
+		case <-p.close:
+			return
+		}
+
+		rate := p.rate()
+		refill(time.Now(), rate)
+		var wait time.Duration
+		if rate > 0 && budget < 0 {
+			wait = time.Duration(-budget * 8 / rate * float64(time.Second))
+			select {
+			case <-time.After(wait):
+			case <-p.close:
+				return
+			}
+			refill(time.Now(), rate)
+		}
+		size := pkt.header.MarshalSize() + len(pkt.payload)
+		if rate > 0 {
+			budget -= float64(size)
+		}
+
+		if _, err := pkt.writer.Write(&pkt.header, pkt.payload, pkt.attributes); err != nil {
+			p.log.Warnf("failed sending RTP packet: %v", err)
+		}
+
+		if p.logger != nil {
+			now := time.Now()
+			// time, ssrc, sequence number, size, pacing rate, budget after
+			// sending, wait, time in queue, queue length
+			fmt.Fprintf(p.logger, "%v, %v, %v, %v, %.0f, %.0f, %v, %v, %v\n",
+				now.Sub(start).Milliseconds(), pkt.header.SSRC, pkt.header.SequenceNumber, size,
+				rate, budget, wait.Microseconds(), now.Sub(pkt.enqueued).Microseconds(), len(p.queue))
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mengelbart/rtq-go-endpoint/internal/fec"
+	"github.com/mengelbart/rtq-go-endpoint/internal/nack"
 	"github.com/pion/interceptor"
 	"github.com/pion/logging"
 	"github.com/pion/rtp"
@@ -82,6 +84,24 @@ func (s *SenderInterceptor) initialTargetBitrate() bitrateConfig {
 // BindLocalStream lets you modify any outgoing RTP packets. It is called once for per LocalStream. The returned method
 // will be called once per rtp packet.
 func (s *SenderInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	mediaSSRC, repair := nack.GetRTX(info.Attributes)
+	if !repair {
+		mediaSSRC, repair = fec.GetFEC(info.Attributes)
+	}
+	if repair {
+		// Retransmissions and FEC packets share the queue of their
+		// original stream, so that they count towards its bitrate.
+		s.streamsMu.Lock()
+		ls, ok := s.streams[mediaSSRC]
+		s.streamsMu.Unlock()
+		if ok {
+			return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+				pkt := &rtp.Packet{Header: *header, Payload: payload}
+				ls.queue <- pkt
+				return pkt.MarshalSize(), nil
+			})
+		}
+	}
 
 	ls := localStream{
 		queue:         make(chan *rtp.Packet, 1_000_000),
@@ -0,0 +1,80 @@
+package utils_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/mengelbart/rtq-go-endpoint/transport/loopbacktest"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+const (
+	testSSRC       = 1
+	testPacketSize = 1000
+)
+
+// linkWriter writes to a loopback flow at most at rate bits per second and
+// blocks like the write to a congested transport would. A rate of 0 does
+// not limit the writes.
+type linkWriter struct {
+	flow transport.WriteFlow
+	rate float64
+	next time.Time
+}
+
+func (l *linkWriter) Write(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+	if l.rate > 0 {
+		now := time.Now()
+		if l.next.After(now) {
+			time.Sleep(l.next.Sub(now))
+		} else {
+			l.next = now
+		}
+		l.next = l.next.Add(time.Duration(float64(8*(header.MarshalSize()+len(payload))) / l.rate * float64(time.Second)))
+	}
+	return l.flow.WriteRTP(header, payload)
+}
+
+// runLoopback sends media at the target bitrate of a SenderInterceptor for
+// the given duration over a loopback link limited to rate. It returns the
+// target bitrate at the end.
+func runLoopback(t *testing.T, duration time.Duration, rate float64) float64 {
+	t.Helper()
+	link := loopbacktest.New(t, transport.LoopbackDelay(10*time.Millisecond))
+	s, err := utils.NewSenderInterceptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flow, _ := link.A.Writer(0)
+	writer := s.BindLocalStream(&interceptor.StreamInfo{SSRC: testSSRC}, &linkWriter{flow: flow, rate: rate})
+	reader, _ := link.B.Reader(0)
+	link.Drain(reader)
+
+	loopbacktest.SendMedia(t, writer, s, testSSRC, testPacketSize, duration)
+	bitrate, err := s.GetTargetBitrate(testSSRC)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	link.Close()
+	return bitrate
+}
+
+func TestNaiveAdaptionLoopback(t *testing.T) {
+	bitrate := runLoopback(t, 3*time.Second, 0)
+	t.Logf("target bitrate without limit: %v", bitrate)
+	if bitrate != 1_280_000 {
+		t.Errorf("target bitrate %v did not increase to the highest step without limit", bitrate)
+	}
+
+	bitrate = runLoopback(t, 5*time.Second, 400_000)
+	t.Logf("target bitrate with a 400kbps link: %v", bitrate)
+	if bitrate > 512_000 {
+		t.Errorf("target bitrate %v above the step next to the link rate", bitrate)
+	}
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+)
+
+// ReportRTTInterceptor computes the round trip time from the reception
+// reports which the receiver sends about the local streams (RFC 3550,
+// section 6.4.1). Each report which echoes the timestamp of a sender report
+// yields one sample: the arrival time minus the LSR and DLSR fields. The
+// samples are smoothed as described in RFC 6298.
+type ReportRTTInterceptor struct {
+	interceptor.NoOp
+
+	logger io.Writer
+	start  time.Time
+	now    func() time.Time
+
+	ssrcsMu sync.Mutex
+	ssrcs   map[uint32]struct{}
+
+	lock  sync.Mutex
+	stats RTTStats
+}
+
+// NewReportRTTInterceptor returns a new ReportRTTInterceptor. If logger is
+// not nil, every RTT sample is logged to it.
+func NewReportRTTInterceptor(logger io.Writer) *ReportRTTInterceptor {
+	return &ReportRTTInterceptor{
+		logger: logger,
+		start:  time.Now(),
+		now:    time.Now,
+		ssrcs:  map[uint32]struct{}{},
+	}
+}
+
+// Metrics returns the RTT statistics of all samples seen so far.
+func (r *ReportRTTInterceptor) Metrics() RTTStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stats
+}
+
+// BindLocalStream records the SSRC of the stream, so that reports about it
+// are used for RTT samples.
+func (r *ReportRTTInterceptor) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	r.ssrcsMu.Lock()
+	defer r.ssrcsMu.Unlock()
+	r.ssrcs[info.SSRC] = struct{}{}
+	return writer
+}
+
+// UnbindLocalStream forgets the SSRC of the stream.
+func (r *ReportRTTInterceptor) UnbindLocalStream(info *interceptor.StreamInfo) {
+	r.ssrcsMu.Lock()
+	defer r.ssrcsMu.Unlock()
+	delete(r.ssrcs, info.SSRC)
+}
+
+// BindRTCPReader takes RTT samples from the reception reports of incoming
+// receiver and sender reports.
+func (r *ReportRTTInterceptor) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		i, attr, err := reader.Read(b, a)
+		if err != nil {
+			return 0, nil, err
+		}
+		pkts, err := rtcp.Unmarshal(b[:i])
+		if err != nil {
+			return 0, nil, err
+		}
+		arrival := ntpShortTime(r.now())
+		for _, pkt := range pkts {
+			var reports []rtcp.ReceptionReport
+			switch p := pkt.(type) {
+			case *rtcp.ReceiverReport:
+				reports = p.Reports
+			case *rtcp.SenderReport:
+				reports = p.Reports
+			}
+			for _, report := range reports {
+				r.processReport(arrival, report)
+			}
+		}
+		return i, attr, nil
+	})
+}
+
+func (r *ReportRTTInterceptor) processReport(arrival uint32, report rtcp.ReceptionReport) {
+	if report.LastSenderReport == 0 {
+		// The receiver did not get a sender report yet.
+		return
+	}
+	r.ssrcsMu.Lock()
+	_, ok := r.ssrcs[report.SSRC]
+	r.ssrcsMu.Unlock()
+	if !ok {
+		return
+	}
+	rtt := arrival - report.LastSenderReport - report.Delay
+	if rtt > 1<<31 {
+		// Negative due to clock granularity or a bogus report.
+		return
+	}
+	sample := time.Duration(rtt) * time.Second / (1 << 16)
+	stats := r.update(sample)
+	if r.logger != nil {
+		// time, ssrc, latest rtt, smoothed rtt, min rtt
+		fmt.Fprintf(r.logger, "%v, %v, %v, %v, %v\n", time.Since(r.start).Milliseconds(), report.SSRC, stats.LatestRTT.Milliseconds(), stats.SmoothedRTT.Milliseconds(), stats.MinRTT.Milliseconds())
+	}
+}
+
+func (r *ReportRTTInterceptor) update(sample time.Duration) RTTStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.stats.LatestRTT = sample
+	if r.stats.SmoothedRTT == 0 {
+		r.stats.MinRTT = sample
+		r.stats.SmoothedRTT = sample
+		r.stats.RTTVar = sample / 2
+		return r.stats
+	}
+	if sample < r.stats.MinRTT {
+		r.stats.MinRTT = sample
+	}
+	delta := r.stats.SmoothedRTT - sample
+	if delta < 0 {
+		delta = -delta
+	}
+	r.stats.RTTVar = (3*r.stats.RTTVar + delta) / 4
+	r.stats.SmoothedRTT = (7*r.stats.SmoothedRTT + sample) / 8
+	return r.stats
+}
+
+// ntpShortTime returns the middle 32 bits of the NTP timestamp of t, the
+// format of the LSR field.
+func ntpShortTime(t time.Time) uint32 {
+	seconds := uint64(t.Unix()) + 2208988800
+	fraction := uint64(t.Nanosecond()) << 16 / uint64(time.Second)
+	return uint32(seconds<<16 | fraction)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,9 +11,11 @@ import (
 	"math/rand"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
 	"github.com/mengelbart/rtq-go-endpoint/rtc"
 	"github.com/mengelbart/rtq-go-endpoint/transport"
@@ -27,14 +30,18 @@ const (
 	H264 = "h264"
 	VP8  = "vp8"
 	VP9  = "vp9"
+	H265 = "h265"
+	AV1  = "av1"
+	OPUS = "opus"
 
 	QUIC = "quic"
-	UDP  = "udp"
 
 	NOCC           = "nocc"
 	SCREAM         = "scream"
 	SCREAM_INFER   = "scream-infer"
 	NAIVE_ADAPTION = "naive"
+
+	RMCAT_TRACE = "rmcat"
 )
 
 func main() {
@@ -56,20 +63,68 @@ func main() {
 		rtcc                 string
 		stream               bool
 		inferFromSmoothedRTT bool
+		mapping              string
+		streamDeadline       time.Duration
+		legacyFraming        bool
+		srtpClientKey        string
+		srtpServerKey        string
+		ecn                  string
+		mtu                  int
+		probeMTU             bool
+		emulation            emulationFlags
+		tlsOpts              tlsFlags
+		quicOpts             quicFlags
+		tracks               trackFlags
+		audio                audioFlags
+		feedback             feedbackFlags
 	)
 	for _, fs := range []*flag.FlagSet{sendCmd, receiveCmd} {
 		fs.StringVar(&addr, "addr", ":4242", "addr host the receiver or to connect the sender to")
-		fs.StringVar(&codec, "codec", H264, fmt.Sprintf("Video Codec, options: '%v', '%v', '%v'", H264, VP8, VP9))
-		fs.StringVar(&proto, "transport", QUIC, fmt.Sprintf("Transport to use, options: '%v', '%v'", QUIC, UDP))
+		fs.StringVar(&codec, "codec", H264, fmt.Sprintf("Video Codec, options: '%v', '%v', '%v', '%v', '%v'", H264, VP8, VP9, H265, AV1))
+		fs.StringVar(&proto, "transport", QUIC, fmt.Sprintf("Transport to use, options: '%v'", strings.Join(transport.Names(), "', '")))
 		fs.StringVar(&rtcc, "cc", NOCC, fmt.Sprintf("Real-time Congestion Controller to use, options: '%v', '%v', '%v', '%v'", NOCC, SCREAM, SCREAM_INFER, NAIVE_ADAPTION))
-		fs.BoolVar(&stream, "stream", false, "send data on a QUIC stream in parallel (only effective if proto=quic)")
+		fs.BoolVar(&stream, "stream", false, "send data on a QUIC stream in parallel (only effective if the transport supports streams)")
 		fs.BoolVar(&inferFromSmoothedRTT, "infer-smoothed", false, "infer feedback using smoothed RTT instead of latest RTT sample")
+		fs.StringVar(&mapping, "quic-mapping", transport.DatagramMapping.String(), fmt.Sprintf("How to map RTP packets to QUIC, options: '%v', '%v', '%v'", transport.DatagramMapping, transport.FramePerStream, transport.GOPPerStream))
+		fs.DurationVar(&streamDeadline, "stream-deadline", 200*time.Millisecond, "reset media streams which are not delivered within this deadline, 0 disables resets (only effective if quic-mapping is not 'datagram')")
+		fs.BoolVar(&legacyFraming, "rtq-legacy", false, fmt.Sprintf("only offer the legacy '%v' framing instead of preferring the current RTP over QUIC draft framing '%v'", transport.LegacyALPN, transport.ALPN))
+		fs.StringVar(&srtpClientKey, "srtp-client-key", "", fmt.Sprintf("base64 encoded pre-shared SRTP master key and salt of %v bytes used by the sender, enables SRTP on the udp transport together with -srtp-server-key", transport.SRTPKeyLen))
+		fs.StringVar(&srtpServerKey, "srtp-server-key", "", fmt.Sprintf("base64 encoded pre-shared SRTP master key and salt of %v bytes used by the receiver", transport.SRTPKeyLen))
+		fs.StringVar(&ecn, "ecn", "off", "ECN codepoint of packets sent on the udp transport, options: 'off', 'ect0', 'ect1' or 'l4s' (not supported by scream)")
+		fs.IntVar(&mtu, "mtu", 0, fmt.Sprintf("largest packet sent on udp and tcp and upper bound on quic, 0 uses %v bytes on udp and tcp and the largest datagram on quic", transport.DefaultMTU))
+		fs.BoolVar(&probeMTU, "probe-mtu", false, "probe the path MTU up to -mtu, or the Ethernet MTU if -mtu is 0, when the udp session is established (must be set on both sides)")
+		emulation.register(fs)
+		tlsOpts.register(fs)
+		quicOpts.register(fs)
+		fs.Var(&tracks, "track", fmt.Sprintf("add a video track as codec[:priority], the SCReAM priority in (0, 1] defaults to %v; repeat for several tracks in the same order on both sides, the sender reads each track from the next source file or the test source (default: a single track of -codec)", videoPriority))
+		audio.register(fs)
+		feedback.register(fs)
 	}
+	var reconnect reconnectFlags
+	reconnect.register(sendCmd)
+	var pacing pacingFlags
+	pacing.register(sendCmd)
+	audio.registerSource(sendCmd)
+	feedback.registerSource(sendCmd)
+	var serveSessions bool
+	receiveCmd.BoolVar(&serveSessions, "serve", false, "keep accepting sessions from any number of senders until interrupted instead of receiving a single session")
+
+	gencertCmd := flag.NewFlagSet("gencert", flag.ExitOnError)
+	var (
+		certDir   string
+		certName  string
+		certHosts string
+		certValid time.Duration
+	)
+	gencertCmd.StringVar(&certDir, "dir", ".", "directory to write the CA and certificates to, an existing CA in the directory is reused")
+	gencertCmd.StringVar(&certName, "name", "server", "file name of the leaf certificate without extension")
+	gencertCmd.StringVar(&certHosts, "hosts", "localhost,127.0.0.1,::1", "comma separated host names and IP addresses of the leaf certificate")
+	gencertCmd.DurationVar(&certValid, "valid-for", 365*24*time.Hour, "validity period of new certificates")
 
 	log.Println(os.Args)
 
 	if len(os.Args) < 2 {
-		fmt.Println("expected 'send' or 'receive' subcommands")
+		fmt.Println("expected 'send', 'receive' or 'gencert' subcommands")
 		os.Exit(1)
 	}
 	switch os.Args[1] {
@@ -79,11 +134,73 @@ func main() {
 		}
 		files := sendCmd.Args()
 		log.Printf("src files: %v\n", files)
-		src := "videotestsrc ! video/x-raw,format=I420"
-		if len(files) > 0 {
-			src = fmt.Sprintf("filesrc location=%v ! queue ! decodebin ! videoconvert ", files[0])
+		sendTracks, err := audio.tracks(tracks.tracks(codec))
+		if err != nil {
+			log.Fatal(err)
+		}
+		srcs := make([]string, len(sendTracks))
+		for i, t := range sendTracks {
+			switch {
+			case t.codec == OPUS:
+				srcs[i] = audio.src()
+			case i < len(files):
+				srcs[i] = fmt.Sprintf("filesrc location=%v ! queue ! decodebin ! videoconvert ", files[i])
+			default:
+				srcs[i] = "videotestsrc ! video/x-raw,format=I420"
+			}
+		}
+		n := len(sendTracks)
+		streams := 1
+		if feedback.nack {
+			streams++
+		}
+		if feedback.fec {
+			streams++
+		}
+		ssrcs, err := rtc.RandomSSRCs(streams * n)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ssrcs, repairSSRCs := ssrcs[:n], ssrcs[n:]
+		var rtxSSRCs, fecSSRCs []uint32
+		if feedback.nack {
+			rtxSSRCs, repairSSRCs = repairSSRCs[:n], repairSSRCs[n:]
+		}
+		if feedback.fec {
+			fecSSRCs = repairSSRCs[:n]
+		}
+		for i := range sendTracks {
+			sendTracks[i].ssrc = ssrcs[i]
+			if feedback.nack {
+				sendTracks[i].rtxSSRC = rtxSSRCs[i]
+			}
+			if feedback.fec {
+				sendTracks[i].fecSSRC = fecSSRCs[i]
+			}
+		}
+		opts, err := transportOptions(mapping, sendTracks, srtpClientKey, srtpServerKey, ecn, mtu, probeMTU, streamDeadline, stream, legacyFraming, emulation, tlsOpts, quicOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if mark, _ := transport.ParseECN(ecn); mark == transport.ECT1 && rtcc == SCREAM {
+			// scream-go only exposes the default ScreamTx constructor,
+			// which reacts to CE marks like classic ECN. Marking ECT(1)
+			// would put the flow into L4S queues without the scalable
+			// reaction they expect.
+			log.Fatalf("-ecn %v is not supported with -cc %v, SCReAM has no L4S mode in scream-go", ecn, rtcc)
+		}
+		metadata := map[string]string{"codec": trackCodecs(sendTracks), "ssrcs": formatSSRCs(ssrcs), "cc": rtcc}
+		if feedback.nack {
+			metadata["rtx-ssrcs"] = formatSSRCs(rtxSSRCs)
+		}
+		if feedback.fec {
+			metadata["fec-ssrcs"] = formatSSRCs(fecSSRCs)
 		}
-		if err := send(src, proto, addr, codec, rtcc, stream, inferFromSmoothedRTT); err != nil {
+		opts = append(opts,
+			transport.SessionMetadata(metadata),
+			transport.ControlHandler(controlHandler(sendTracks, nil)),
+		)
+		if err := send(sendTracks, srcs, proto, addr, rtcc, stream, inferFromSmoothedRTT, reconnect, pacing, feedback, opts...); err != nil {
 			log.Fatal(err)
 		}
 	case "receive":
@@ -92,107 +209,509 @@ func main() {
 		}
 		files := receiveCmd.Args()
 		log.Printf("dst file: %v\n", files)
-		dst := "autovideosink"
+		var dstFile string
 		if len(files) > 0 {
-			dst = fmt.Sprintf("matroskamux ! filesink location=%v", files[0])
+			dstFile = files[0]
 		}
-		if err := receive(dst, proto, addr, codec, rtcc, stream); err != nil {
+		receiveTracks, err := audio.tracks(tracks.tracks(codec))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts, err := transportOptions(mapping, receiveTracks, srtpClientKey, srtpServerKey, ecn, mtu, probeMTU, streamDeadline, stream, legacyFraming, emulation, tlsOpts, quicOpts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		announced := newSSRCAnnouncements()
+		opts = append(opts, transport.ControlHandler(controlHandler(receiveTracks, announced)))
+		if serveSessions {
+			err = serve(dstFile, proto, addr, receiveTracks, announced, rtcc, stream, feedback, opts...)
+		} else {
+			err = receive(dstFile, proto, addr, receiveTracks, announced, rtcc, stream, feedback, opts...)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "gencert":
+		if err := gencertCmd.Parse(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		if err := transport.GenerateCertificates(certDir, certName, strings.Split(certHosts, ","), certValid); err != nil {
 			log.Fatal(err)
 		}
 	default:
 		fmt.Printf("unknown command: %v\n", os.Args[1])
-		fmt.Println("expected 'send' or 'receive' subcommands")
+		fmt.Println("expected 'send', 'receive' or 'gencert' subcommands")
 		os.Exit(1)
 	}
 }
 
-func closeErr(closeFn func() error) {
-	if err := closeFn(); err != nil {
-		log.Printf("close failed: %v\n", err)
+func transportOptions(mapping string, tracks []track, srtpClientKey, srtpServerKey, ecn string, mtu int, probeMTU bool, streamDeadline time.Duration, stream, legacyFraming bool, emulation emulationFlags, tlsOpts tlsFlags, quicOpts quicFlags) ([]transport.Option, error) {
+	opts, err := emulation.options()
+	if err != nil {
+		return nil, err
 	}
-}
-
-func send(src, proto, remote, codec, rtcc string, stream, inferFromSmoothedRTT bool) error {
-	start := time.Now()
-
-	var w rtc.RTPWriter
-	var r io.Reader
-	var metricer rtc.Metricer
-
-	switch proto {
-	case QUIC:
-
-		var tracers []logging.Tracer
-		if rtcc == SCREAM_INFER {
-			rttTracer := utils.NewTracer()
-			tracers = append(tracers, rttTracer)
-			metricer = rttTracer
-		}
-		q, err := transport.NewQUICClient(remote, tracers...)
+	opts = append(opts, tlsOpts.options()...)
+	quicOpt, err := quicOpts.option()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, quicOpt)
+	if legacyFraming {
+		opts = append(opts, transport.LegacyFraming())
+	}
+	if len(srtpClientKey) > 0 || len(srtpServerKey) > 0 {
+		clientKey, err := transport.ParseSRTPKey(srtpClientKey)
 		if err != nil {
-			return fmt.Errorf("failed to open RTQ session: %v", err)
+			return nil, fmt.Errorf("failed to parse srtp-client-key: %v", err)
 		}
-		defer closeErr(q.Close)
-
-		writeCloser, err := q.Writer(0)
+		serverKey, err := transport.ParseSRTPKey(srtpServerKey)
 		if err != nil {
-			return fmt.Errorf("failed to open RTQ write flow: %v", err)
+			return nil, fmt.Errorf("failed to parse srtp-server-key: %v", err)
 		}
-		defer closeErr(writeCloser.Close)
-		w = writeCloser
-
-		readCloser, err := q.Reader(1)
-		if err != nil {
-			return fmt.Errorf("failed to open RTQ read flow: %v", err)
+		opts = append(opts, transport.SRTPKeys(clientKey, serverKey))
+	}
+	ecnMark, err := transport.ParseECN(ecn)
+	if err != nil {
+		return nil, err
+	}
+	if ecnMark != transport.NotECT {
+		opts = append(opts, transport.ECNMarking(ecnMark))
+	}
+	if mtu != 0 {
+		opts = append(opts, transport.MTU(mtu))
+	}
+	if probeMTU {
+		opts = append(opts, transport.ProbeMTU())
+	}
+	m, err := transport.ParseStreamMapping(mapping)
+	if err != nil {
+		return nil, err
+	}
+	if m == transport.DatagramMapping {
+		return opts, nil
+	}
+	if stream {
+		return nil, fmt.Errorf("cannot send stream data in parallel to media on streams")
+	}
+	var keyFrame transport.KeyFrameFunc
+	if m == transport.GOPPerStream {
+		for _, t := range tracks[1:] {
+			if t.codec != tracks[0].codec {
+				return nil, fmt.Errorf("quic-mapping %v requires all tracks to use the same codec", m)
+			}
+		}
+		if keyFrame, err = transport.KeyFrameDetector(tracks[0].codec); err != nil {
+			return nil, err
 		}
-		defer closeErr(readCloser.Close)
-		r = readCloser
+	}
+	return append(opts, transport.QUICStreams(m, streamDeadline, keyFrame)), nil
+}
 
-		if stream {
-			l, err := utils.GetStreamLogWriter()
+// controlHandler logs the control messages received from the peer and ends
+// sessions whose peer announced codecs other than the codecs of tracks. If
+// announced is not nil, the SSRCs announced by the peer are stored in it,
+// sessions without valid SSRCs are ended. The SSRCs of RTX and FEC streams
+// are only announced by senders which retransmit packets or send FEC
+// packets.
+func controlHandler(tracks []track, announced *ssrcAnnouncements) func(transport.Session, *transport.ControlMessage) {
+	codecs := trackCodecs(tracks)
+	return func(session transport.Session, m *transport.ControlMessage) {
+		switch m.Type {
+		case transport.ControlMetadata:
+			log.Printf("got session metadata: %v", m.Metadata)
+			if c, ok := m.Metadata["codec"]; ok && c != codecs {
+				rejectSession(session, transport.UnsupportedError, fmt.Sprintf("codec %v, expected %v", c, codecs))
+				return
+			}
+			if announced == nil {
+				return
+			}
+			ssrcs, err := parseSSRCs(m.Metadata["ssrcs"], len(tracks))
 			if err != nil {
-				return fmt.Errorf("failed to get stream log writer: %v", err)
+				rejectSession(session, transport.ProtocolError, err.Error())
+				return
 			}
-			defer closeErr(l.Close)
-
-			ctx, cancelCtx := context.WithCancel(context.Background())
-			go func() {
-				err := sendStreamData(ctx, q, start, l)
-				if err != nil && err.Error() == "Application error 0x0: eos" {
-					log.Printf("stream sender done after EOS")
+			var rtxSSRCs, fecSSRCs []uint32
+			if rtx, ok := m.Metadata["rtx-ssrcs"]; ok {
+				if rtxSSRCs, err = parseRepairSSRCs("RTX", rtx, ssrcs); err != nil {
+					rejectSession(session, transport.ProtocolError, err.Error())
 					return
 				}
-				if err != nil {
-					log.Fatalf("failed to send stream data: %v", err) // TODO: return error to main goroutine
+			}
+			if f, ok := m.Metadata["fec-ssrcs"]; ok {
+				if fecSSRCs, err = parseRepairSSRCs("FEC", f, ssrcs, rtxSSRCs); err != nil {
+					rejectSession(session, transport.ProtocolError, err.Error())
+					return
 				}
-			}()
-			defer cancelCtx()
+			}
+			announced.announce(session, ssrcs, rtxSSRCs, fecSSRCs)
+		case transport.ControlStats:
+			log.Printf("got peer stats: %v", m.Stats)
+		case transport.ControlError:
+			log.Printf("peer ended session: %v: %v", m.Code, m.Reason)
 		}
+	}
+}
 
-	case UDP:
-
-		u, err := transport.NewUDPClient(remote)
+// rejectSession ends session with an error. Control handlers must not block,
+// so the message is sent in the background.
+func rejectSession(session transport.Session, code transport.ErrorCode, reason string) {
+	go func() {
+		err := session.SendControl(&transport.ControlMessage{
+			Type:   transport.ControlError,
+			Code:   code,
+			Reason: reason,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to open UDP session: %v", err)
+			log.Printf("failed to reject session: %v", err)
 		}
-		defer closeErr(u.Close)
+	}()
+}
 
-		writeCloser, err := u.Writer(0)
+// emulationFlags configure the emulated link applied to all packets sent by
+// an endpoint.
+type emulationFlags struct {
+	rate   int
+	trace  string
+	burst  int
+	queue  int
+	delay  time.Duration
+	jitter time.Duration
+	loss   string
+	ce     time.Duration
+	seed   int64
+}
+
+func (e *emulationFlags) register(fs *flag.FlagSet) {
+	fs.IntVar(&e.rate, "emu-rate", 0, "emulated bottleneck capacity in bit/s, 0 disables the bottleneck")
+	fs.StringVar(&e.trace, "emu-trace", "", fmt.Sprintf("file with a time varying bottleneck capacity, or '%v' for the RMCAT variable capacity test case", RMCAT_TRACE))
+	fs.IntVar(&e.burst, "emu-burst", 1500, "emulated bottleneck burst size in bytes")
+	fs.IntVar(&e.queue, "emu-queue", 0, "emulated bottleneck queue limit in bytes, 0 means unlimited")
+	fs.DurationVar(&e.delay, "emu-delay", 0, "emulated one-way delay")
+	fs.DurationVar(&e.jitter, "emu-jitter", 0, "emulated maximum jitter added to the one-way delay")
+	fs.StringVar(&e.loss, "emu-loss", "", "emulated loss, either a loss probability or 'ge:p,r,k,h' for Gilbert-Elliott loss")
+	fs.DurationVar(&e.ce, "emu-ce-threshold", 0, "CE-mark ECN capable packets which waited longer than this in the emulated bottleneck queue, 0 disables marking")
+	fs.Int64Var(&e.seed, "emu-seed", 0, "seed for the random source of the emulated link")
+}
+
+func (e *emulationFlags) enabled() bool {
+	return e.rate > 0 || len(e.trace) > 0 || e.queue > 0 || e.delay > 0 || e.jitter > 0 || len(e.loss) > 0 || e.ce > 0
+}
+
+func (e *emulationFlags) options() ([]transport.Option, error) {
+	if !e.enabled() {
+		return nil, nil
+	}
+	profile := &transport.EmulationProfile{
+		Rate:        e.rate,
+		Burst:       e.burst,
+		QueueLimit:  e.queue,
+		Delay:       e.delay,
+		Jitter:      e.jitter,
+		CEThreshold: e.ce,
+		Seed:        e.seed,
+	}
+	switch e.trace {
+	case "":
+	case RMCAT_TRACE:
+		profile.Trace = transport.RMCATVariableCapacity
+	default:
+		trace, err := transport.LoadCapacityTrace(e.trace)
 		if err != nil {
-			return fmt.Errorf("failed to open UDP write flow: %v", err)
+			return nil, fmt.Errorf("failed to load capacity trace: %v", err)
 		}
-		defer closeErr(writeCloser.Close)
-		w = writeCloser
-
-		readCloser, err := u.Reader(1)
+		profile.Trace = trace
+	}
+	if len(e.loss) > 0 {
+		loss, err := transport.ParseLossModel(e.loss)
 		if err != nil {
-			return fmt.Errorf("failed to open UDP read flow: %v", err)
+			return nil, err
 		}
-		defer closeErr(readCloser.Close)
-		r = readCloser
+		profile.Loss = loss
+	}
+	return []transport.Option{transport.Emulate(profile)}, nil
+}
 
-	default:
-		return fmt.Errorf("unknown transport protocol: %v", proto)
+// tlsFlags configure the TLS handshake of the QUIC transport. The receiver
+// uses the certificate, the sender verifies it.
+type tlsFlags struct {
+	cert     string
+	key      string
+	ca       string
+	pin      string
+	alpn     string
+	insecure bool
+}
+
+func (t *tlsFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.cert, "tls-cert", "", "PEM file with the certificate chain of the receiver, a self-signed certificate is generated if empty")
+	fs.StringVar(&t.key, "tls-key", "", "PEM file with the private key of the receiver")
+	fs.StringVar(&t.ca, "tls-ca", "", "PEM file with the CA certificates used to verify the receiver, the system roots are used if empty")
+	fs.StringVar(&t.pin, "tls-pin", "", "SHA-256 fingerprint in hex of the only accepted receiver certificate")
+	fs.StringVar(&t.alpn, "alpn", "", "comma separated ALPN tokens to offer instead of the default")
+	fs.BoolVar(&t.insecure, "tls-insecure", false, "do not verify the certificate of the receiver")
+}
+
+func (t *tlsFlags) options() []transport.Option {
+	var opts []transport.Option
+	if len(t.cert) > 0 || len(t.key) > 0 {
+		opts = append(opts, transport.TLSCertificate(t.cert, t.key))
+	}
+	if len(t.ca) > 0 {
+		opts = append(opts, transport.TLSRootCAs(t.ca))
+	}
+	if len(t.pin) > 0 {
+		opts = append(opts, transport.TLSPinSHA256(t.pin))
+	}
+	if len(t.alpn) > 0 {
+		opts = append(opts, transport.NextProtos(strings.Split(t.alpn, ",")...))
+	}
+	if t.insecure {
+		opts = append(opts, transport.TLSInsecureSkipVerify())
+	}
+	return opts
+}
+
+// quicFlags configure the connections of the QUIC transport.
+type quicFlags struct {
+	handshakeTimeout time.Duration
+	idleTimeout      time.Duration
+	keepAlive        bool
+	streamWindow     uint64
+	maxStreamWindow  uint64
+	connWindow       uint64
+	maxConnWindow    uint64
+	maxStreams       int64
+	maxUniStreams    int64
+	cc               string
+}
+
+func (q *quicFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&q.handshakeTimeout, "quic-handshake-timeout", 0, "abort the QUIC handshake if the peer does not respond within this time, 0 uses the quic-go default")
+	fs.DurationVar(&q.idleTimeout, "quic-idle-timeout", 0, "close QUIC connections without incoming packets for this time, 0 uses the quic-go default")
+	fs.BoolVar(&q.keepAlive, "quic-keepalive", false, "send QUIC keep-alive packets on idle connections")
+	fs.Uint64Var(&q.streamWindow, "quic-stream-window", 0, "initial QUIC stream receive window in bytes, 0 uses the quic-go default")
+	fs.Uint64Var(&q.maxStreamWindow, "quic-max-stream-window", 0, "maximum QUIC stream receive window in bytes, 0 uses the quic-go default")
+	fs.Uint64Var(&q.connWindow, "quic-conn-window", 0, "initial QUIC connection receive window in bytes, 0 uses the quic-go default")
+	fs.Uint64Var(&q.maxConnWindow, "quic-max-conn-window", 0, "maximum QUIC connection receive window in bytes, 0 uses the quic-go default")
+	fs.Int64Var(&q.maxStreams, "quic-max-streams", 0, "maximum number of concurrent bidirectional QUIC streams opened by the peer, 0 uses the quic-go default")
+	fs.Int64Var(&q.maxUniStreams, "quic-max-uni-streams", 0, "maximum number of concurrent unidirectional QUIC streams opened by the peer, 0 uses the quic-go default")
+	fs.StringVar(&q.cc, "quic-cc", "", fmt.Sprintf("QUIC congestion controller, options: '%v', '%v', '%v', empty uses '%v'", transport.QUICNoCC, transport.QUICNewReno, transport.QUICCubic, transport.QUICNewReno))
+}
+
+func (q *quicFlags) option() (transport.Option, error) {
+	cc, err := transport.ParseQUICCongestionControl(q.cc)
+	if err != nil {
+		return nil, err
+	}
+	return transport.ConfigureQUIC(transport.QUICConfig{
+		HandshakeIdleTimeout:           q.handshakeTimeout,
+		MaxIdleTimeout:                 q.idleTimeout,
+		KeepAlive:                      q.keepAlive,
+		InitialStreamReceiveWindow:     q.streamWindow,
+		MaxStreamReceiveWindow:         q.maxStreamWindow,
+		InitialConnectionReceiveWindow: q.connWindow,
+		MaxConnectionReceiveWindow:     q.maxConnWindow,
+		MaxIncomingStreams:             q.maxStreams,
+		MaxIncomingUniStreams:          q.maxUniStreams,
+		CongestionControl:              cc,
+	}), nil
+}
+
+func closeErr(closeFn func() error) {
+	if err := closeFn(); err != nil {
+		log.Printf("close failed: %v\n", err)
+	}
+}
+
+// senderConn holds the session of a sender and the flows opened on it.
+type senderConn struct {
+	session transport.Session
+	writers []transport.WriteFlow
+	w       rtc.RTPWriter
+	r       transport.ReadFlow
+}
+
+func dialSender(proto, remote string, tracks []track, opts ...transport.Option) (*senderConn, error) {
+	session, err := transport.Dial(proto, remote, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v session: %v", proto, err)
+	}
+	writers, err := trackWriters(session, len(tracks))
+	if err != nil {
+		closeErr(session.Close)
+		return nil, fmt.Errorf("failed to open %v write flow: %v", proto, err)
+	}
+	r, err := session.Reader(trackFlowID(0))
+	if err != nil {
+		for _, w := range writers {
+			closeErr(w.Close)
+		}
+		closeErr(session.Close)
+		return nil, fmt.Errorf("failed to open %v read flow: %v", proto, err)
+	}
+	return &senderConn{session: session, writers: writers, w: trackRTPWriter(tracks, writers), r: r}, nil
+}
+
+func (c *senderConn) close() {
+	closeErr(c.r.Close)
+	for _, w := range c.writers {
+		closeErr(w.Close)
+	}
+	closeErr(c.session.Close)
+}
+
+// reconnectFlags configure if and how fast a sender reconnects after its
+// session failed.
+type reconnectFlags struct {
+	enabled    bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	// feedbackTimeout detects failed sessions on transports which do not
+	// report failures, like UDP.
+	feedbackTimeout time.Duration
+}
+
+func (r *reconnectFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&r.enabled, "reconnect", false, "dial a new session when the session fails instead of stopping")
+	fs.DurationVar(&r.minBackoff, "reconnect-backoff", 250*time.Millisecond, "initial delay before reconnecting, doubled after every failed attempt")
+	fs.DurationVar(&r.maxBackoff, "reconnect-max-backoff", 8*time.Second, "maximum delay between reconnect attempts")
+	fs.DurationVar(&r.feedbackTimeout, "reconnect-feedback-timeout", 2*time.Second, "consider the session failed if no RTCP packet arrived for this long while reading feedback, 0 disables the timeout")
+}
+
+// pacingFlags configure the pacer between the congestion controller and the
+// transport.
+type pacingFlags struct {
+	enabled bool
+	factor  float64
+	burst   int
+}
+
+func (p *pacingFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&p.enabled, "pacing", false, "pace packets at the target bitrate of the congestion controller (requires a cc other than 'nocc')")
+	fs.Float64Var(&p.factor, "pacing-factor", utils.DefaultPacingFactor, "factor the target bitrate is multiplied by to get the pacing rate")
+	fs.IntVar(&p.burst, "pacing-burst", utils.DefaultPacingBurst, "number of bytes which may be sent back to back without pacing")
+}
+
+// feedbackFlags configure the RTCP feedback which is exchanged in addition
+// to the feedback of the congestion controller.
+type feedbackFlags struct {
+	reportInterval time.Duration
+	nack           bool
+	nackHistory    int
+	fec            bool
+	fecColumns     int
+	fecRows        int
+	fecAdaptive    bool
+	// keyFrameRequests is the minimum interval between the key frame
+	// requests of a track.
+	keyFrameRequests time.Duration
+	keyFrameInterval int
+	// twccInterval is the interval of transport-cc feedback.
+	twccInterval time.Duration
+}
+
+func (f *feedbackFlags) register(fs *flag.FlagSet) {
+	fs.DurationVar(&f.reportInterval, "rtcp-reports", 0, "interval of RTCP sender and receiver reports, 0 disables reports (set on both sides to measure the RTT on any transport)")
+	fs.BoolVar(&f.nack, "nack", false, "request lost packets with NACKs and retransmit them on RTX streams (must be set on both sides)")
+	fs.BoolVar(&f.fec, "fec", false, "protect the tracks with FlexFEC packets on FEC streams and recover lost packets from them (must be set on both sides)")
+	fs.DurationVar(&f.keyFrameRequests, "keyframe-requests", 0, "minimum interval between PLI/FIR key frame requests of a video track sent when the decoder loses sync, 0 disables requests (must be set on both sides)")
+	fs.DurationVar(&f.twccInterval, "twcc", 0, "interval of transport-wide congestion control feedback, 0 disables it (must be set on both sides)")
+}
+
+func (f *feedbackFlags) registerSource(fs *flag.FlagSet) {
+	fs.IntVar(&f.nackHistory, "nack-history", 1024, "number of packets of each track kept for retransmissions")
+	fs.IntVar(&f.fecColumns, "fec-columns", 10, "number of consecutive packets protected by a row FEC packet")
+	fs.IntVar(&f.fecRows, "fec-rows", 1, "number of rows of an FEC block, column FEC packets are sent if larger than 1")
+	fs.BoolVar(&f.fecAdaptive, "fec-adaptive", false, "adapt the FEC overhead to the loss rate observed by the congestion controller, using the configured block at high loss rates")
+	fs.IntVar(&f.keyFrameInterval, "keyframe-interval", 0, "maximum number of frames between key frames of the video encoders, 0 uses the default of the codec")
+}
+
+func send(tracks []track, srcs []string, proto, remote, rtcc string, stream, inferFromSmoothedRTT bool, reconnect reconnectFlags, pacing pacingFlags, feedback feedbackFlags, opts ...transport.Option) error {
+	start := time.Now()
+
+	var metricer rtc.Metricer
+	if rtcc == SCREAM_INFER {
+		rttTracer := utils.NewTracer()
+		opts = append(opts, transport.Tracers(rttTracer))
+		metricer = rttTracer
+	}
+
+	conn, err := dialSender(proto, remote, tracks, opts...)
+	if err != nil {
+		return err
+	}
+	session := conn.session
+	var connMu sync.Mutex
+	defer func() {
+		connMu.Lock()
+		defer connMu.Unlock()
+		if conn != nil {
+			conn.close()
+		}
+	}()
+
+	if rtcc == SCREAM_INFER && !transport.Supports(session, transport.Acks) {
+		return fmt.Errorf("cc %v requires a transport which supports %v, but %v does not", rtcc, transport.Acks, proto)
+	}
+
+	senderOpts := []rtc.SenderOption{
+		rtc.SenderMTU(session.MaxPacketSize()),
+		rtc.SenderKeyFrameInterval(feedback.keyFrameInterval),
+	}
+	for i, t := range tracks {
+		senderOpts = append(senderOpts, rtc.SenderTrack(t.ssrc, t.codec, srcs[i], t.priority))
+		if t.rtxSSRC != 0 {
+			senderOpts = append(senderOpts, rtc.SenderRTX(t.ssrc, t.rtxSSRC))
+		}
+		if t.fecSSRC != 0 {
+			senderOpts = append(senderOpts, rtc.SenderFEC(t.ssrc, t.fecSSRC))
+		}
+	}
+	if reconnect.enabled {
+		senderOpts = append(senderOpts, rtc.SenderReconnect(func() (rtc.RTPWriter, io.Reader, error) {
+			connMu.Lock()
+			defer connMu.Unlock()
+			if conn != nil {
+				conn.close()
+				conn = nil
+			}
+			c, err := dialSender(proto, remote, tracks, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			conn = c
+			return c.w, c.r, nil
+		}, reconnect.minBackoff, reconnect.maxBackoff))
+		if reconnect.feedbackTimeout > 0 {
+			senderOpts = append(senderOpts, rtc.SenderFeedbackTimeout(reconnect.feedbackTimeout))
+		}
+	}
+
+	if stream && transport.Supports(session, transport.Streams) {
+		l, err := utils.GetStreamLogWriter()
+		if err != nil {
+			return fmt.Errorf("failed to get stream log writer: %v", err)
+		}
+		defer closeErr(l.Close)
+
+		ctx, cancelCtx := context.WithCancel(context.Background())
+		go func() {
+			err := sendStreamData(ctx, session.(transport.StreamSession), session.MaxPacketSize(), start, l)
+			if transport.IsClosed(err) {
+				log.Printf("stream sender done after EOS")
+				return
+			}
+			if err != nil && reconnect.enabled {
+				// Stream data is only sent on the first session.
+				log.Printf("stream sender stopped: %v", err)
+				return
+			}
+			if err != nil {
+				log.Fatalf("failed to send stream data: %v", err) // TODO: return error to main goroutine
+			}
+		}()
+		defer cancelCtx()
 	}
 
 	rtpLogger, err := utils.GetRTPLogWriter()
@@ -204,12 +723,7 @@ func send(src, proto, remote, codec, rtcc string, stream, inferFromSmoothedRTT b
 	defer closeErr(rtcpInLog.Close)
 	defer closeErr(rtpOutLog.Close)
 
-	sender, err := rtc.NewSender(
-		w,
-		r,
-		rtc.SenderCodec(codec),
-		rtc.SenderSrc(src),
-	)
+	sender, err := rtc.NewSender(conn.w, conn.r, senderOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create RTP sender: %v", err)
 	}
@@ -239,7 +753,7 @@ func send(src, proto, remote, codec, rtcc string, stream, inferFromSmoothedRTT b
 		}
 		defer closeErr(cclog.Close)
 
-		err = sender.ConfigureInferingSCReAMInterceptor(cclog, w.(rtc.AckingRTPWriter), metricer, inferFromSmoothedRTT)
+		err = sender.ConfigureInferingSCReAMInterceptor(cclog, metricer, inferFromSmoothedRTT)
 		if err != nil {
 			return fmt.Errorf("failed to configure inferring SCReAM interceptor: %v", err)
 		}
@@ -259,8 +773,70 @@ func send(src, proto, remote, codec, rtcc string, stream, inferFromSmoothedRTT b
 		log.Printf("unknown cc: %v\n", rtcc)
 	}
 
+	if pacing.enabled {
+		var pacerLog io.WriteCloser
+		if pacerLog, err = utils.GetPacerLogWriter(); err != nil {
+			return fmt.Errorf("failed to get pacer log writer: %v", err)
+		}
+		defer closeErr(pacerLog.Close)
+		if err = sender.ConfigurePacer(pacing.factor, pacing.burst, pacerLog); err != nil {
+			return fmt.Errorf("failed to configure pacer: %v", err)
+		}
+	}
+
+	if feedback.reportInterval > 0 {
+		var rttLog io.WriteCloser
+		if rttLog, err = utils.GetRTTLogWriter(); err != nil {
+			return fmt.Errorf("failed to get RTT log writer: %v", err)
+		}
+		defer closeErr(rttLog.Close)
+		if err = sender.ConfigureRTCPReports(feedback.reportInterval, rttLog); err != nil {
+			return fmt.Errorf("failed to configure RTCP reports: %v", err)
+		}
+	}
+
+	if feedback.nack {
+		if err = sender.ConfigureNACK(feedback.nackHistory); err != nil {
+			return fmt.Errorf("failed to configure NACK interceptor: %v", err)
+		}
+	}
+
+	if feedback.fec {
+		if err = sender.ConfigureFEC(feedback.fecColumns, feedback.fecRows, feedback.fecAdaptive); err != nil {
+			return fmt.Errorf("failed to configure FEC interceptor: %v", err)
+		}
+	}
+
+	if feedback.keyFrameRequests > 0 {
+		if err = sender.ConfigureKeyFrameRequests(); err != nil {
+			return fmt.Errorf("failed to configure key frame requests: %v", err)
+		}
+	}
+
+	if feedback.twccInterval > 0 {
+		var twccLog io.WriteCloser
+		if twccLog, err = utils.GetTWCCLogWriter(); err != nil {
+			return fmt.Errorf("failed to get TWCC log writer: %v", err)
+		}
+		defer closeErr(twccLog.Close)
+		if err = sender.ConfigureTWCC(twccLog); err != nil {
+			return fmt.Errorf("failed to configure TWCC interceptor: %v", err)
+		}
+	}
+
 	sender.ConfigureRTPLogInterceptor(rtcpInLog, ioutil.Discard, ioutil.Discard, rtpOutLog)
 
+	stopStats := make(chan struct{})
+	defer close(stopStats)
+	go sendStats(sender, func() transport.Session {
+		connMu.Lock()
+		defer connMu.Unlock()
+		if conn == nil {
+			return nil
+		}
+		return conn.session
+	}, stopStats)
+
 	done := make(chan struct{})
 	errChan := make(chan error)
 	go func() {
@@ -289,117 +865,302 @@ func send(src, proto, remote, codec, rtcc string, stream, inferFromSmoothedRTT b
 	return nil
 }
 
-func receive(dst, proto, remote, codec, rtcc string, stream bool) error {
-	start := time.Now()
-
-	var w rtc.RTCPWriter
-	var r io.Reader
+// statsInterval is the time between the ControlStats messages sent by
+// senders.
+const statsInterval = time.Second
+
+// sendStats sends the statistics of the congestion controller of sender in a
+// ControlStats message to the receiver on the current session every
+// statsInterval until stop is closed. Nothing is sent if the sender has no
+// congestion controller.
+func sendStats(sender *rtc.Sender, session func() transport.Session, stop <-chan struct{}) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+		stats := sender.Stats()
+		if stats == nil {
+			return
+		}
+		s := session()
+		if s == nil {
+			continue
+		}
+		err := s.SendControl(&transport.ControlMessage{Type: transport.ControlStats, Stats: stats})
+		if errors.Is(err, transport.ErrControlUnsupported) {
+			return
+		}
+		if err != nil && !transport.IsClosed(err) {
+			log.Printf("failed to send stats: %v", err)
+		}
+	}
+}
 
-	switch proto {
-	case QUIC:
+func receive(dstFile, proto, remote string, tracks []track, announced *ssrcAnnouncements, rtcc string, stream bool, feedback feedbackFlags, opts ...transport.Option) error {
+	session, err := transport.Listen(proto, remote, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to open %v session: %v", proto, err)
+	}
+	defer closeErr(session.Close)
 
-		q, err := transport.NewQUICServer(remote)
-		if err != nil {
-			return fmt.Errorf("failed to open RTQ session: %v", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			log.Printf("got signal: %v, closing receiver", sig)
+			cancel()
+		case <-ctx.Done():
 		}
-		defer closeErr(q.Close)
+	}()
 
-		readCloser, err := q.Reader(0)
-		if err != nil {
-			return fmt.Errorf("failed to open RTQ read flow: %v", err)
+	return receiveSession(ctx, session, "", dstFile, proto, tracks, announced, rtcc, stream, feedback)
+}
+
+// serve accepts sessions until it receives an interrupt and runs a receiver
+// for each session. If dstFile is not empty, each session is written to a
+// separate file named after dstFile and the session.
+func serve(dstFile, proto, remote string, tracks []track, announced *ssrcAnnouncements, rtcc string, stream bool, feedback feedbackFlags, opts ...transport.Option) error {
+	listener, err := transport.NewListener(proto, remote, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to listen for %v sessions: %v", proto, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			log.Printf("got signal: %v, closing all sessions", sig)
+			cancel()
+		case <-ctx.Done():
 		}
-		defer closeErr(readCloser.Close)
-		r = readCloser
+	}()
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+		closeErr(listener.Close)
+	}()
 
-		writeCloser, err := q.Writer(1)
+	for i := 0; ; i++ {
+		session, err := listener.Accept(ctx)
 		if err != nil {
-			return fmt.Errorf("failed to open RTQ write flow: %v", err)
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to accept %v session: %v", proto, err)
 		}
-		defer closeErr(writeCloser.Close)
-		w = writeCloser
+		name := strconv.Itoa(i)
+		log.Printf("accepted session %v", name)
 
-		if stream {
-			l, err := utils.GetStreamLogWriter()
-			if err != nil {
-				return fmt.Errorf("failed to get stream log writer: %v", err)
+		sessionFile := dstFile
+		if len(dstFile) > 0 {
+			sessionFile = utils.SessionFilename(dstFile, name)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer closeErr(session.Close)
+			if err := receiveSession(ctx, session, name, sessionFile, proto, tracks, announced, rtcc, stream, feedback); err != nil {
+				log.Printf("session %v failed: %v", name, err)
+				return
 			}
-			defer closeErr(l.Close)
+			log.Printf("session %v done", name)
+		}()
+	}
+}
 
-			ctx, cancelCtx := context.WithCancel(context.Background())
-			go func() {
-				if err := receiveStreamData(ctx, q, start, l); err != nil {
-					log.Fatalf("failed to receive stream data: %v", err) // TODO: return error to main goroutine
-				}
-			}()
-			defer cancelCtx()
-		}
+// receiveDst returns the GStreamer sink which writes to file, or plays the
+// track encoded with codec if file is empty.
+func receiveDst(file, codec string) string {
+	if len(file) == 0 && codec == OPUS {
+		return "autoaudiosink"
+	}
+	if len(file) == 0 {
+		return "autovideosink"
+	}
+	return fmt.Sprintf("matroskamux ! filesink location=%v", file)
+}
 
-	case UDP:
+// receiveSession receives media on session until the stream ends or ctx is
+// done. If name is not empty, it is used to separate the log files of
+// concurrent sessions. If there are several tracks, each track is written
+// to a separate file named after dstFile and the track. A track is created
+// when the first packet with the SSRC announced for it arrives, packets of
+// other SSRCs are dropped.
+func receiveSession(ctx context.Context, session transport.Session, name, dstFile, proto string, tracks []track, announced *ssrcAnnouncements, rtcc string, stream bool, feedback feedbackFlags) error {
+	start := time.Now()
+	defer announced.remove(session)
 
-		u, err := transport.NewUDPServer(remote)
-		if err != nil {
-			return fmt.Errorf("failed to open UDP session: %v", err)
-		}
-		defer closeErr(u.Close)
+	readers, err := trackReaders(session, len(tracks))
+	if err != nil {
+		return fmt.Errorf("failed to open %v read flow: %v", proto, err)
+	}
+	for _, r := range readers {
+		defer closeErr(r.Close)
+	}
 
-		readCloser, err := u.Reader(0)
-		if err != nil {
-			return fmt.Errorf("failed to open UDP read flow: %v", err)
+	w, err := session.Writer(trackFlowID(0))
+	if err != nil {
+		return fmt.Errorf("failed to open %v write flow: %v", proto, err)
+	}
+	defer closeErr(w.Close)
+
+	if stream && transport.Supports(session, transport.Streams) {
+		var l io.WriteCloser
+		if len(name) > 0 {
+			l, err = utils.GetSessionStreamLogWriter(name)
+		} else {
+			l, err = utils.GetStreamLogWriter()
 		}
-		defer closeErr(readCloser.Close)
-		r = readCloser
-
-		writeCloser, err := u.Writer(1)
 		if err != nil {
-			return fmt.Errorf("failed to open UDP write flow: %v", err)
+			return fmt.Errorf("failed to get stream log writer: %v", err)
 		}
-		defer closeErr(writeCloser.Close)
-		w = writeCloser
-
-	default:
-		return fmt.Errorf("unknown transport protocol: %v", proto)
+		defer closeErr(l.Close)
+
+		ctx, cancelCtx := context.WithCancel(ctx)
+		go func() {
+			err := receiveStreamData(ctx, session.(transport.StreamSession), session.MaxPacketSize(), start, l)
+			if transport.IsClosed(err) {
+				log.Printf("stream receiver done after EOS")
+				return
+			}
+			if err != nil {
+				log.Fatalf("failed to receive stream data: %v", err) // TODO: return error to main goroutine
+			}
+		}()
+		defer cancelCtx()
 	}
 
 	rtpLogger, err := utils.GetRTPLogWriter()
 	if err != nil {
 		return fmt.Errorf("failed to get RTP log writer: %v", err)
 	}
-	rtcpOutLog := rtpLogger("rtcp_out")
-	rtpInLog := rtpLogger("rtp_in")
+	logPrefix := ""
+	if len(name) > 0 {
+		logPrefix = name + "_"
+	}
+	rtcpOutLog := rtpLogger(logPrefix + "rtcp_out")
+	rtpInLog := rtpLogger(logPrefix + "rtp_in")
 	defer closeErr(rtcpOutLog.Close)
 	defer closeErr(rtpInLog.Close)
 
-	recv, err := rtc.NewReceiver(r, w, rtc.ReceiverDst(dst), rtc.ReceiverCodec(codec))
+	recvOpts := []rtc.ReceiverOption{
+		rtc.ReceiverMTU(session.MaxPacketSize()),
+	}
+	for _, r := range readers[1:] {
+		recvOpts = append(recvOpts, rtc.ReceiverFlow(r))
+	}
+	var recv *rtc.Receiver
+	recvOpts = append(recvOpts, rtc.ReceiverUnknownSSRC(func(ssrc uint32) {
+		if mediaSSRC, ok := announced.rtxTrack(session, ssrc); ok {
+			if err := recv.AddRTXTrack(ssrc, mediaSSRC); err != nil {
+				log.Printf("failed to add RTX track with SSRC %v: %v", ssrc, err)
+				return
+			}
+			log.Printf("receiving retransmissions of SSRC %v with SSRC %v", mediaSSRC, ssrc)
+			return
+		}
+		if mediaSSRC, ok := announced.fecTrack(session, ssrc); ok {
+			if err := recv.AddFECTrack(ssrc, mediaSSRC); err != nil {
+				log.Printf("failed to add FEC track with SSRC %v: %v", ssrc, err)
+				return
+			}
+			log.Printf("receiving FEC packets for SSRC %v with SSRC %v", mediaSSRC, ssrc)
+			return
+		}
+		i, ok := announced.track(session, ssrc)
+		if !ok {
+			return
+		}
+		file := dstFile
+		if len(dstFile) > 0 && len(tracks) > 1 {
+			file = utils.SessionFilename(dstFile, "track"+strconv.Itoa(i))
+		}
+		if err := recv.AddTrack(ssrc, tracks[i].codec, receiveDst(file, tracks[i].codec)); err != nil {
+			log.Printf("failed to add track %v with SSRC %v: %v", i, ssrc, err)
+			return
+		}
+		log.Printf("receiving track %v with SSRC %v", i, ssrc)
+	}))
+	recv, err = rtc.NewReceiver(readers[0], w, recvOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to create RTP receiver: %v", err)
 	}
 
 	recv.ConfigureRTPLogInterceptor(ioutil.Discard, rtcpOutLog, rtpInLog, ioutil.Discard)
 
+	// The NACK generator is configured before the FEC receiver, so that
+	// recovered packets are not requested. The congestion controller and
+	// the reports only see the packets which were actually received.
+	if feedback.nack {
+		if err = recv.ConfigureNACK(); err != nil {
+			return fmt.Errorf("failed to configure NACK interceptor: %v", err)
+		}
+	}
+
+	if feedback.fec {
+		if err = recv.ConfigureFEC(); err != nil {
+			return fmt.Errorf("failed to configure FEC interceptor: %v", err)
+		}
+	}
+
 	if rtcc == SCREAM {
 		if err = recv.ConfigureSCReAMInterceptor(); err != nil {
 			return fmt.Errorf("failed to configure SCReAM interceptor: %v", err)
 		}
 	}
 
+	if feedback.reportInterval > 0 {
+		if err = recv.ConfigureRTCPReports(feedback.reportInterval); err != nil {
+			return fmt.Errorf("failed to configure RTCP reports: %v", err)
+		}
+	}
+
+	if feedback.keyFrameRequests > 0 {
+		if err = recv.ConfigureKeyFrameRequests(feedback.keyFrameRequests); err != nil {
+			return fmt.Errorf("failed to configure key frame requests: %v", err)
+		}
+	}
+
+	if feedback.twccInterval > 0 {
+		if err = recv.ConfigureTWCC(feedback.twccInterval); err != nil {
+			return fmt.Errorf("failed to configure TWCC interceptor: %v", err)
+		}
+	}
+
 	done := make(chan struct{})
-	errChan := make(chan error)
+	errChan := make(chan error, 1)
 
 	go func() {
-		err = recv.Receive()
-		if err != nil {
+		if err := recv.Receive(); err != nil {
 			errChan <- fmt.Errorf("failed to start RTP receiver: %v", err)
 			return
 		}
 		close(done)
 	}()
 
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Interrupt)
-
 	select {
-	case sig := <-signals:
-		log.Printf("got signal: %v, closing receiver", sig)
+	case <-ctx.Done():
+		log.Printf("closing receiver")
+		closeErr(recv.Close)
+		select {
+		case <-done:
+		case err := <-errChan:
+			return err
+		}
 
 	case <-done:
 		log.Printf("reached EOS, closing receiver")
@@ -411,13 +1172,13 @@ func receive(dst, proto, remote, codec, rtcc string, stream bool) error {
 	return nil
 }
 
-func receiveStreamData(ctx context.Context, q *transport.QUIC, start time.Time, logger io.Writer) error {
+func receiveStreamData(ctx context.Context, q transport.StreamSession, packetLength int, start time.Time, logger io.Writer) error {
 	stream, err := q.AcceptUniStream(ctx)
 	if err != nil {
 		return err
 	}
 
-	buffer := make([]byte, streamDataPacketLength)
+	buffer := make([]byte, packetLength)
 	for {
 		select {
 		case <-ctx.Done():
@@ -432,18 +1193,14 @@ func receiveStreamData(ctx context.Context, q *transport.QUIC, start time.Time,
 	}
 }
 
-const streamDataPacketLength = 1200
-
-//const streamDataPacketLength = 64_000
-
-func sendStreamData(ctx context.Context, q *transport.QUIC, start time.Time, logger io.Writer) error {
+func sendStreamData(ctx context.Context, q transport.StreamSession, packetLength int, start time.Time, logger io.Writer) error {
 	stream, err := q.OpenUniStream()
 	if err != nil {
 		return err
 	}
 	defer stream.Close()
 
-	buffer := make([]byte, streamDataPacketLength)
+	buffer := make([]byte, packetLength)
 
 	for {
 		select {
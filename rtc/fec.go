@@ -0,0 +1,99 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/fec"
+	"github.com/pion/interceptor"
+)
+
+// ConfigureFEC protects each track with XOR parity packets sent on the FEC
+// stream set by SenderFEC. The packets are protected in blocks of columns x
+// rows packets, see fec.SenderInterceptor. If adaptive is set, the overhead
+// follows the loss rate observed by the congestion controller and the
+// block is only used at high loss rates. The FEC packets pass the
+// congestion controller as packets of the FEC stream, so it must be
+// configured before.
+func (s *Sender) ConfigureFEC(columns, rows int, adaptive bool) error {
+	opts := []fec.SenderOption{fec.SenderBlock(columns, rows)}
+	if adaptive {
+		errNoLossSource := errors.New("adaptive FEC requires a congestion controller which observes the loss rate")
+		if s.cc == nil {
+			return errNoLossSource
+		}
+		if _, ok := s.cc.get().(fec.LossSource); !ok {
+			return errNoLossSource
+		}
+		opts = append(opts, fec.SenderLossSource(s.cc))
+	}
+	if err := s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return fec.NewSenderInterceptor(opts...)
+	}); err != nil {
+		return err
+	}
+	s.protect = true
+	return nil
+}
+
+// ConfigureFEC recovers lost packets of each track from the FEC packets
+// received on FEC tracks added by AddFECTrack, before they are passed to
+// the pipeline of the track. Interceptors configured later do not see the
+// recovered packets.
+func (r *Receiver) ConfigureFEC() error {
+	receiver, err := fec.NewReceiverInterceptor()
+	if err != nil {
+		return err
+	}
+	r.ir.Add(receiver)
+	return nil
+}
+
+// AddFECTrack adds a track which receives the FEC packets protecting the
+// track with SSRC mediaSSRC on the FEC stream with SSRC fecSSRC.
+func (r *Receiver) AddFECTrack(fecSSRC, mediaSSRC uint32) error {
+	r.tracksMu.Lock()
+	defer r.tracksMu.Unlock()
+	if r.stopped {
+		return ErrReceiverStopped
+	}
+	media, ok := r.tracks[mediaSSRC]
+	if !ok || media.media != nil {
+		return fmt.Errorf("no track with SSRC %v", mediaSSRC)
+	}
+	return r.insertTrack(&receiverTrack{
+		ssrc:  fecSSRC,
+		codec: media.codec,
+		media: media,
+		fec:   true,
+	})
+}
+
+// startFECTrack binds the stream of the FEC track t to the interceptors,
+// which recover the packets of the protected track. The FEC packets are
+// dropped afterwards.
+func (r *Receiver) startFECTrack(t *receiverTrack) {
+	t.streamInfo = &interceptor.StreamInfo{
+		SSRC:                t.ssrc,
+		ClockRate:           clockRate(t.codec),
+		Attributes:          fec.SetFEC(nil, t.media.ssrc),
+		RTCPFeedback:        withoutNACK(r.rtcpFeedback),
+		RTPHeaderExtensions: r.rtpHeaderExtensions,
+	}
+	t.rtpReader = r.i.BindRemoteStream(t.streamInfo, interceptor.RTPReaderFunc(func(in []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
+		return len(in), nil, nil
+	}))
+}
+
+// withoutNACK returns feedback without generic NACKs, which are not used
+// for FEC streams.
+func withoutNACK(feedback []interceptor.RTCPFeedback) []interceptor.RTCPFeedback {
+	filtered := make([]interceptor.RTCPFeedback, 0, len(feedback))
+	for _, fb := range feedback {
+		if fb.Type == "nack" && fb.Parameter == "" {
+			continue
+		}
+		filtered = append(filtered, fb)
+	}
+	return filtered
+}
@@ -0,0 +1,10 @@
+package rtc
+
+import "testing"
+
+func TestConfigureAdaptiveFECWithoutCongestionControl(t *testing.T) {
+	s := &Sender{}
+	if err := s.ConfigureFEC(4, 4, true); err == nil {
+		t.Error("adaptive FEC configured without a congestion controller")
+	}
+}
@@ -1,8 +1,8 @@
 package rtc
 
 import (
+	"errors"
 	"log"
-	"net"
 	"sort"
 	"time"
 
@@ -78,6 +78,9 @@ func (f *fbInferer) buffer(cancel chan struct{}) {
 				continue
 			}
 			sort.Slice(buf, func(i, j int) bool {
+				if buf[i].ssrc != buf[j].ssrc {
+					return buf[i].ssrc < buf[j].ssrc
+				}
 				return buf[i].seqNr < buf[j].seqNr
 			})
 
@@ -96,6 +99,8 @@ func (f *fbInferer) buffer(cancel chan struct{}) {
 
 				//lastTS2 := f.ntpTime(pkt.sentTS.Add(metrics.MinRTT / 2))
 				//fmt.Printf("t=%v, t2=%v, diff=%v\n", lastTS, lastTS2, lastTS-lastTS2)
+				// QUIC acks only carry ECN counters, not the codepoint of
+				// each packet, so inferred feedback never reports CE.
 				f.rx.Receive(lastTS, pkt.ssrc, pkt.size, pkt.seqNr, 0)
 			}
 			buf = []ackedPkt{}
@@ -128,7 +133,7 @@ func (f *fbInferer) rtpWriterFunc(header *rtp.Header, payload []byte, attributes
 	})
 
 	if err != nil {
-		if netErr, ok := err.(net.Error); ok && !netErr.Temporary() || err.Error() == "Application error 0x0: eos" {
+		if isConnError(err) || errors.Is(err, ErrNotConnected) {
 			return n, err
 		}
 		log.Printf("failed to write to rtpWriter: %T: %v\n", err, err)
@@ -0,0 +1,101 @@
+package rtc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/scream"
+	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/mengelbart/rtq-go-endpoint/transport/loopbacktest"
+	screamcgo "github.com/mengelbart/scream-go"
+	"github.com/pion/interceptor"
+)
+
+type staticMetricer utils.RTTStats
+
+func (m staticMetricer) Metrics() utils.RTTStats {
+	return utils.RTTStats(m)
+}
+
+// runInferredSCReAM sends media at the target bitrate of SCReAM for the
+// given duration over a loopback link, feeding SCReAM with the feedback
+// inferred from the acks of the link. It returns the target bitrate and
+// loss rate at the end.
+func runInferredSCReAM(t *testing.T, duration time.Duration, opts ...transport.LoopbackOption) (float64, float64) {
+	t.Helper()
+	const (
+		ssrc       = 1
+		packetSize = 100
+	)
+	link := loopbacktest.New(t, append([]transport.LoopbackOption{transport.LoopbackDelay(10 * time.Millisecond)}, opts...)...)
+	s, err := scream.NewSenderInterceptor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, _ := link.B.Reader(0)
+	link.Drain(reader)
+
+	flow, _ := link.A.Writer(0)
+	cancel := make(chan struct{})
+	fbc := make(chan []byte, 1000)
+	fbi := newFBInferer(flow.(AckingRTPWriter), screamcgo.NewRx(0), fbc, staticMetricer{LatestRTT: 20 * time.Millisecond}, false)
+	go fbi.buffer(cancel)
+
+	info := &interceptor.StreamInfo{
+		SSRC:         ssrc,
+		RTCPFeedback: []interceptor.RTCPFeedback{{Type: "ack", Parameter: "ccfb"}},
+	}
+	writer := s.BindLocalStream(info, interceptor.RTPWriterFunc(fbi.rtpWriterFunc))
+	rtcpReader := s.BindRTCPReader(interceptor.RTCPReaderFunc(func(buf []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		select {
+		case fb := <-fbc:
+			return copy(buf, fb), a, nil
+		case <-cancel:
+			return 0, nil, errors.New("closed")
+		}
+	}))
+	buf := make([]byte, 1500)
+	link.Go(func() error {
+		_, _, err := rtcpReader.Read(buf, nil)
+		return err
+	})
+
+	loopbacktest.SendMedia(t, writer, s, ssrc, packetSize, duration)
+	bitrate, err := s.GetTargetBitrate(ssrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loss := s.LossRate()
+
+	close(cancel)
+	link.Close()
+	s.Close()
+	return bitrate, loss
+}
+
+func TestFeedbackInfererLoopback(t *testing.T) {
+	bitrate, loss := runInferredSCReAM(t, 3*time.Second)
+	t.Logf("target bitrate without loss: %v, loss rate %v", bitrate, loss)
+	if bitrate <= 100_000 {
+		t.Errorf("target bitrate %v did not increase from the start bitrate without loss", bitrate)
+	}
+	// Acks are passed to the buffer by separate goroutines, so an ack may
+	// miss its batch and its packet is reported as lost first.
+	if loss > 0.05 {
+		t.Errorf("loss rate %v without loss", loss)
+	}
+
+	lossyBitrate, loss := runInferredSCReAM(t, 3*time.Second,
+		transport.LoopbackLoss(0.1),
+		transport.LoopbackSeed(7),
+	)
+	t.Logf("target bitrate with 10%% loss: %v, loss rate %v", lossyBitrate, loss)
+	if lossyBitrate >= bitrate {
+		t.Errorf("target bitrate %v with loss is not below %v without loss", lossyBitrate, bitrate)
+	}
+	if loss < 0.03 || loss > 0.2 {
+		t.Errorf("loss rate %v, want about 0.1", loss)
+	}
+}
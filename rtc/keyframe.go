@@ -0,0 +1,64 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/keyframe"
+	"github.com/pion/interceptor"
+)
+
+// SenderKeyFrameInterval sets the maximum number of frames between two key
+// frames of the video encoders. If it is 0, the default interval of each
+// codec is used. A long interval saves bandwidth if the receiver requests
+// key frames after losses, see ConfigureKeyFrameRequests.
+func SenderKeyFrameInterval(frames int) SenderOption {
+	return func(s *Sender) error {
+		if frames < 0 {
+			return fmt.Errorf("invalid key frame interval: %v", frames)
+		}
+		s.keyFrameInterval = frames
+		return nil
+	}
+}
+
+// ConfigureKeyFrameRequests asks the encoder of a track for a key frame
+// when the receiver sends a picture loss indication or full intra request
+// for it.
+func (s *Sender) ConfigureKeyFrameRequests() error {
+	if s.conn.r == nil {
+		return errors.New("cannot read key frame requests with nil reader")
+	}
+	if err := s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return keyframe.NewResponderInterceptor(s.forceKeyFrame)
+	}); err != nil {
+		return err
+	}
+	s.acceptFeedback = true
+	return nil
+}
+
+// forceKeyFrame asks the encoder of the track with the given SSRC for a key
+// frame.
+func (s *Sender) forceKeyFrame(ssrc uint32) {
+	for _, t := range s.tracks {
+		if t.ssrc == ssrc && t.pipeline != nil {
+			t.pipeline.ForceKeyFrame()
+			return
+		}
+	}
+}
+
+// ConfigureKeyFrameRequests sends a picture loss indication or full intra
+// request for a video track when its depayloader or decoder needs a key
+// frame, at most once per interval.
+func (r *Receiver) ConfigureKeyFrameRequests(interval time.Duration) error {
+	generator, err := keyframe.NewGeneratorInterceptor(keyframe.GeneratorInterval(interval))
+	if err != nil {
+		return err
+	}
+	r.ir.Add(generator)
+	r.keyFrames = generator
+	return nil
+}
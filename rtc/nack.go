@@ -0,0 +1,44 @@
+package rtc
+
+import (
+	"errors"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/nack"
+	"github.com/pion/interceptor"
+)
+
+// ConfigureNACK keeps a history of the last history packets of each track
+// and retransmits the packets requested by generic NACKs on the RTX stream
+// set by SenderRTX. The retransmissions pass the congestion controller as
+// packets of the RTX stream, so it must be configured before.
+func (s *Sender) ConfigureNACK(history int) error {
+	if s.conn.r == nil {
+		return errors.New("cannot read nacks with nil reader")
+	}
+	if err := s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return nack.NewResponderInterceptor(nack.ResponderSize(history))
+	}); err != nil {
+		return err
+	}
+	s.rtcpFeedback = append(s.rtcpFeedback, interceptor.RTCPFeedback{
+		Type: "nack",
+	})
+	s.retransmit = true
+	s.acceptFeedback = true
+	return nil
+}
+
+// ConfigureNACK requests the packets missing in the sequence of each track
+// with generic NACKs. Retransmissions are received on RTX tracks added by
+// AddRTXTrack.
+func (r *Receiver) ConfigureNACK() error {
+	generator, err := nack.NewGeneratorInterceptor()
+	if err != nil {
+		return err
+	}
+	r.rtcpFeedback = append(r.rtcpFeedback, interceptor.RTCPFeedback{
+		Type: "nack",
+	})
+	r.ir.Add(generator)
+	return nil
+}
@@ -1,45 +1,118 @@
 package rtc
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	gstsink "github.com/mengelbart/rtq-go-endpoint/internal/gstreamer-sink"
+	"github.com/mengelbart/rtq-go-endpoint/internal/keyframe"
+	"github.com/mengelbart/rtq-go-endpoint/internal/nack"
 	"github.com/mengelbart/rtq-go-endpoint/internal/scream"
 	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
+	"github.com/mengelbart/rtq-go-endpoint/transport"
 	"github.com/pion/interceptor"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 )
 
 type RTCPWriter interface {
 	WriteRTCP(pkts []rtcp.Packet) (int, error)
 }
 
+// ErrReceiverStopped is returned when adding a track to a stopped receiver.
+var ErrReceiverStopped = errors.New("receiver stopped")
+
 type Receiver struct {
 	codec string
 	dst   string
 	mtu   int
 
-	rtcpConn RTCPWriter
-	rtpConn  io.Reader
-
-	streamInfo *interceptor.StreamInfo
-	ir         interceptor.Registry
-	i          interceptor.Interceptor
+	tracksMu sync.Mutex
+	tracks   map[uint32]*receiverTrack
+	// rejected holds the unknown SSRCs whose packets were dropped.
+	rejected    map[uint32]struct{}
+	unknownSSRC func(ssrc uint32)
+	receiving   bool
+	stopped     bool
 
-	rtpReader interceptor.RTCPReader
+	rtcpConn   RTCPWriter
+	rtpConns   []io.Reader
+	rtcpReader interceptor.RTCPReader
 
-	pipeline *gstsink.Pipeline
+	rtcpFeedback        []interceptor.RTCPFeedback
+	rtpHeaderExtensions []interceptor.RTPHeaderExtension
+	ir                  interceptor.Registry
+	i                   interceptor.Interceptor
+	keyFrames           *keyframe.GeneratorInterceptor
 
 	packet chan []byte
 	closeC chan struct{}
 }
 
+// receiverTrack is a media stream received by a Receiver.
+type receiverTrack struct {
+	ssrc  uint32
+	codec string
+	dst   string
+	// media is the track whose retransmissions or FEC packets are
+	// received on this track if it is an RTX or FEC track.
+	media *receiverTrack
+	fec   bool
+	// payloadType is the payload type of the last packet of the track,
+	// or -1. It is used to restore retransmitted packets.
+	payloadType int32
+
+	streamInfo *interceptor.StreamInfo
+	rtpReader  interceptor.RTPReader
+	pipeline   *gstsink.Pipeline
+	eosC       chan struct{}
+	// loss requests key frames after packet loss if the pipeline does not
+	// request them, nil otherwise.
+	loss *keyframe.LossDetector
+}
+
+// keyFrameLossTimeout is the time after which a packet which was neither
+// retransmitted nor recovered is considered lost by the LossDetector of a
+// track. It is longer than retransmissions usually take.
+const keyFrameLossTimeout = 500 * time.Millisecond
+
 type ReceiverOption func(*Receiver) error
 
+// ReceiverTrack adds a track which receives the RTP packets with the given
+// SSRC, decodes them with codec and passes them to the GStreamer sink dst.
+func ReceiverTrack(ssrc uint32, codec, dst string) ReceiverOption {
+	return func(r *Receiver) error {
+		return r.AddTrack(ssrc, codec, dst)
+	}
+}
+
+// ReceiverUnknownSSRC sets the handler which is called for packets whose
+// SSRC belongs to no track. The handler can create a new track for the SSRC
+// with AddTrack, otherwise the packet is dropped. If neither tracks nor a
+// handler are configured, the first SSRC received creates a track using the
+// codec and sink set by ReceiverCodec and ReceiverDst, and all other SSRCs
+// are rejected.
+func ReceiverUnknownSSRC(handler func(ssrc uint32)) ReceiverOption {
+	return func(r *Receiver) error {
+		r.unknownSSRC = handler
+		return nil
+	}
+}
+
+// ReceiverFlow adds another reader of RTP packets, e.g. a separate flow for
+// each track. The packets of all readers are demultiplexed by their SSRC.
+func ReceiverFlow(rtpConn io.Reader) ReceiverOption {
+	return func(r *Receiver) error {
+		r.rtpConns = append(r.rtpConns, rtpConn)
+		return nil
+	}
+}
+
 func ReceiverCodec(codec string) ReceiverOption {
 	return func(r *Receiver) error {
 		r.codec = codec
@@ -54,19 +127,30 @@ func ReceiverDst(dst string) ReceiverOption {
 	}
 }
 
+// ReceiverMTU sets the size of the RTP read buffer, larger packets are
+// dropped.
+func ReceiverMTU(mtu int) ReceiverOption {
+	return func(r *Receiver) error {
+		if mtu <= 0 {
+			return fmt.Errorf("invalid MTU: %v", mtu)
+		}
+		r.mtu = mtu
+		return nil
+	}
+}
+
 func NewReceiver(r io.Reader, w RTCPWriter, opts ...ReceiverOption) (*Receiver, error) {
 	recv := &Receiver{
 		codec:    "h264",
 		dst:      "autovideosink",
 		mtu:      1200,
-		rtpConn:  r,
+		tracks:   map[uint32]*receiverTrack{},
+		rejected: map[uint32]struct{}{},
+		rtpConns: []io.Reader{r},
 		rtcpConn: w,
-		streamInfo: &interceptor.StreamInfo{
-			SSRC: 0,
-		},
-		ir:     interceptor.Registry{},
-		packet: make(chan []byte, 1000),
-		closeC: make(chan struct{}),
+		ir:       interceptor.Registry{},
+		packet:   make(chan []byte, 1000),
+		closeC:   make(chan struct{}),
 	}
 	for _, opt := range opts {
 		err := opt(recv)
@@ -74,6 +158,9 @@ func NewReceiver(r io.Reader, w RTCPWriter, opts ...ReceiverOption) (*Receiver,
 			return nil, err
 		}
 	}
+	if len(recv.tracks) == 0 && recv.unknownSSRC == nil {
+		recv.unknownSSRC = recv.acceptFirstSSRC
+	}
 	return recv, nil
 }
 
@@ -82,7 +169,7 @@ func (r *Receiver) ConfigureSCReAMInterceptor() error {
 	if err != nil {
 		return err
 	}
-	r.streamInfo.RTCPFeedback = append(r.streamInfo.RTCPFeedback, interceptor.RTCPFeedback{
+	r.rtcpFeedback = append(r.rtcpFeedback, interceptor.RTCPFeedback{
 		Type:      "ack",
 		Parameter: "ccfb",
 	})
@@ -95,70 +182,303 @@ func (r *Receiver) ConfigureRTPLogInterceptor(rtcpIn, rtcpOut, rtpIn, rtpOut io.
 	r.ir.Add(i)
 }
 
-func (r *Receiver) Receive() error {
-	i := r.ir.Build()
-	r.i = i
+// AddTrack adds a track which receives the RTP packets with the given SSRC,
+// decodes them with codec and passes them to the GStreamer sink dst. Tracks
+// added while the receiver is running are started immediately.
+func (r *Receiver) AddTrack(ssrc uint32, codec, dst string) error {
+	r.tracksMu.Lock()
+	defer r.tracksMu.Unlock()
+	return r.addTrack(ssrc, codec, dst)
+}
 
-	pipeline, err := gstsink.NewPipeline(r.codec, r.dst)
+// addTrack adds a track, r.tracksMu must be held.
+func (r *Receiver) addTrack(ssrc uint32, codec, dst string) error {
+	if r.stopped {
+		return ErrReceiverStopped
+	}
+	return r.insertTrack(&receiverTrack{
+		ssrc:        ssrc,
+		codec:       codec,
+		dst:         dst,
+		payloadType: -1,
+	})
+}
+
+// AddRTXTrack adds a track which receives the retransmissions of the track
+// with SSRC mediaSSRC on the RTX stream with SSRC rtxSSRC. Retransmitted
+// packets are passed to the pipeline of the original track.
+func (r *Receiver) AddRTXTrack(rtxSSRC, mediaSSRC uint32) error {
+	r.tracksMu.Lock()
+	defer r.tracksMu.Unlock()
+	if r.stopped {
+		return ErrReceiverStopped
+	}
+	media, ok := r.tracks[mediaSSRC]
+	if !ok || media.media != nil {
+		return fmt.Errorf("no track with SSRC %v", mediaSSRC)
+	}
+	return r.insertTrack(&receiverTrack{
+		ssrc:  rtxSSRC,
+		codec: media.codec,
+		media: media,
+	})
+}
+
+// insertTrack adds t and starts it if the receiver is running, r.tracksMu
+// must be held.
+func (r *Receiver) insertTrack(t *receiverTrack) error {
+	if _, ok := r.tracks[t.ssrc]; ok {
+		return fmt.Errorf("duplicate track SSRC: %v", t.ssrc)
+	}
+	if r.receiving {
+		if err := r.startTrack(t); err != nil {
+			return err
+		}
+	}
+	r.tracks[t.ssrc] = t
+	delete(r.rejected, t.ssrc)
+	return nil
+}
+
+// acceptFirstSSRC creates the default track for the first SSRC received.
+func (r *Receiver) acceptFirstSSRC(ssrc uint32) {
+	r.tracksMu.Lock()
+	defer r.tracksMu.Unlock()
+	if len(r.tracks) > 0 {
+		return
+	}
+	if err := r.addTrack(ssrc, r.codec, r.dst); err != nil {
+		log.Printf("failed to add track for SSRC %v: %v", ssrc, err)
+		return
+	}
+	log.Printf("receiving SSRC %v", ssrc)
+}
+
+// startTrack creates and starts the pipeline of t and binds its stream to
+// the interceptors.
+func (r *Receiver) startTrack(t *receiverTrack) error {
+	if t.media != nil && t.fec {
+		r.startFECTrack(t)
+		return nil
+	}
+	if t.media != nil {
+		r.startRTXTrack(t)
+		return nil
+	}
+	pipeline, err := gstsink.NewPipeline(t.codec, t.dst)
 	if err != nil {
 		return err
 	}
-	r.pipeline = pipeline
-
-	eosC := make(chan struct{})
-	gstsink.HandleSinkEOS(func() {
-		close(eosC)
+	t.eosC = make(chan struct{})
+	pipeline.HandleEOS(func() {
+		close(t.eosC)
 	})
+	requestKeyFrames := r.keyFrames != nil && t.codec != "opus"
+	if requestKeyFrames {
+		keyFrames, ssrc := r.keyFrames, t.ssrc
+		pipeline.HandleKeyFrameRequest(func(full bool) {
+			go keyFrames.RequestKeyFrame(ssrc, full)
+		})
+	}
+	t.pipeline = pipeline
 
-	r.rtpReader = r.i.BindRemoteStream(r.streamInfo, interceptor.RTCPReaderFunc(func(in []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
-		r.pipeline.Push(in)
+	t.streamInfo = &interceptor.StreamInfo{
+		SSRC:                t.ssrc,
+		RTCPFeedback:        r.rtcpFeedback,
+		RTPHeaderExtensions: r.rtpHeaderExtensions,
+	}
+	t.rtpReader = r.i.BindRemoteStream(t.streamInfo, interceptor.RTPReaderFunc(func(in []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
+		atomic.StoreInt32(&t.payloadType, int32(in[1]&0x7F))
+		r.push(t, in)
 		return len(in), nil, nil
 	}))
+	pipeline.Start()
+	if requestKeyFrames && !pipeline.RequestsKeyFrames() {
+		log.Printf("requesting key frames for SSRC %v when packets are missing for %v", t.ssrc, keyFrameLossTimeout)
+		t.loss = keyframe.NewLossDetector(keyFrameLossTimeout)
+	}
+	return nil
+}
+
+// push passes the RTP packet pkt of the media track t to its pipeline. If
+// the pipeline does not request key frames, they are requested when the
+// LossDetector of t notices a lost packet.
+func (r *Receiver) push(t *receiverTrack, pkt []byte) {
+	if t.loss != nil && len(pkt) >= 4 {
+		seq := uint16(pkt[2])<<8 | uint16(pkt[3])
+		if t.loss.Push(seq, time.Now()) {
+			go r.keyFrames.RequestKeyFrame(t.ssrc, false)
+		}
+	}
+	t.pipeline.Push(pkt)
+}
+
+// startRTXTrack binds the stream of the RTX track t to the interceptors.
+// The retransmitted packets are restored and passed to the pipeline of the
+// original track.
+func (r *Receiver) startRTXTrack(t *receiverTrack) {
+	media := t.media
+	t.streamInfo = &interceptor.StreamInfo{
+		SSRC:                t.ssrc,
+		ClockRate:           clockRate(t.codec),
+		Attributes:          nack.SetRTX(nil, media.ssrc),
+		RTCPFeedback:        r.rtcpFeedback,
+		RTPHeaderExtensions: r.rtpHeaderExtensions,
+	}
+	t.rtpReader = r.i.BindRemoteStream(t.streamInfo, interceptor.RTPReaderFunc(func(in []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
+		payloadType := atomic.LoadInt32(&media.payloadType)
+		if payloadType < 0 || media.pipeline == nil {
+			// Nothing to restore the packet for yet.
+			return len(in), nil, nil
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(in); err != nil {
+			return 0, nil, err
+		}
+		if err := nack.UnwrapRTX(&pkt, media.ssrc, uint8(payloadType)); err != nil {
+			return 0, nil, err
+		}
+		buf, err := pkt.Marshal()
+		if err != nil {
+			return 0, nil, err
+		}
+		r.push(media, buf)
+		return len(in), nil, nil
+	}))
+}
+
+// track returns the track of ssrc. If there is none, the handler for
+// unknown SSRCs is asked to create it.
+func (r *Receiver) track(ssrc uint32) (*receiverTrack, bool) {
+	r.tracksMu.Lock()
+	t, ok := r.tracks[ssrc]
+	r.tracksMu.Unlock()
+	if ok {
+		return t, true
+	}
+	if r.unknownSSRC != nil {
+		r.unknownSSRC(ssrc)
+	}
+
+	r.tracksMu.Lock()
+	defer r.tracksMu.Unlock()
+	if t, ok = r.tracks[ssrc]; ok {
+		return t, true
+	}
+	if _, ok := r.rejected[ssrc]; !ok {
+		r.rejected[ssrc] = struct{}{}
+		log.Printf("dropping packets of unknown SSRC %v", ssrc)
+	}
+	return nil, false
+}
+
+func (r *Receiver) Receive() error {
+	i := r.ir.Build()
+	r.i = i
 
 	_ = r.i.BindRTCPWriter(interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attributes interceptor.Attributes) (int, error) {
 		return r.rtcpConn.WriteRTCP(pkts)
 	}))
+	r.rtcpReader = r.i.BindRTCPReader(interceptor.RTCPReaderFunc(func(in []byte, _ interceptor.Attributes) (int, interceptor.Attributes, error) {
+		return len(in), nil, nil
+	}))
 
-	connErrC := make(chan error)
-	go func() {
-		for buffer := make([]byte, r.mtu); ; {
-			n, err := r.rtpConn.Read(buffer)
-			if err != nil {
-				connErrC <- err
-				return
-			}
-			if res := bytes.Compare(buffer[:n], []byte("eos")); res == 0 {
-				connErrC <- fmt.Errorf("connection got EOS")
-				return
-			}
-			if _, _, err := r.rtpReader.Read(buffer[:n], nil); err != nil {
-				connErrC <- fmt.Errorf("rtpReader failed to read received buffer: %w", err)
-				return
-			}
+	r.tracksMu.Lock()
+	for _, t := range r.tracks {
+		if err := r.startTrack(t); err != nil {
+			r.tracksMu.Unlock()
+			return err
 		}
-	}()
-
-	r.pipeline.Start()
+	}
+	r.receiving = true
+	r.tracksMu.Unlock()
 	go gstsink.StartMainLoop()
 
+	connErrC := make(chan error, len(r.rtpConns))
+	for _, rtpConn := range r.rtpConns {
+		go r.read(rtpConn, connErrC)
+	}
+
 	select {
 	case err := <-connErrC:
-		log.Printf("got error from connection reader: %v\n", err)
-		r.pipeline.Stop()
+		if transport.IsClosed(err) {
+			log.Printf("connection got EOS")
+		} else {
+			log.Printf("got error from connection reader: %v\n", err)
+		}
 
 	case <-r.closeC:
-		r.pipeline.Stop()
 	}
+
+	r.tracksMu.Lock()
+	r.stopped = true
+	tracks := make([]*receiverTrack, 0, len(r.tracks))
+	for _, t := range r.tracks {
+		if t.pipeline != nil {
+			t.pipeline.Stop()
+			tracks = append(tracks, t)
+		}
+	}
+	r.tracksMu.Unlock()
+
 	r.i.Close()
-	select {
-	case <-eosC:
-	case <-time.After(3 * time.Second):
-		log.Printf("timeout")
+	timeout := time.After(3 * time.Second)
+	for _, t := range tracks {
+		select {
+		case <-t.eosC:
+		case <-timeout:
+			log.Printf("timeout")
+		}
+		t.pipeline.Destroy()
 	}
 
 	return nil
 }
 
+// read passes the RTP packets read from rtpConn to the track of their SSRC
+// and the RTCP packets of the sender to the interceptors until reading
+// fails.
+func (r *Receiver) read(rtpConn io.Reader, connErrC chan<- error) {
+	ecnReader, readECN := rtpConn.(transport.ECNReader)
+	for buffer := make([]byte, r.mtu); ; {
+		var n int
+		var ecn transport.ECN
+		var err error
+		if readECN {
+			n, ecn, err = ecnReader.ReadECN(buffer)
+		} else {
+			n, err = rtpConn.Read(buffer)
+		}
+		if errors.Is(err, io.ErrShortBuffer) {
+			log.Printf("dropping packet larger than MTU of %v bytes", r.mtu)
+			continue
+		}
+		if err != nil {
+			connErrC <- err
+			return
+		}
+		if transport.IsRTCP(buffer[:n]) {
+			if _, _, err := r.rtcpReader.Read(buffer[:n], interceptor.Attributes{}); err != nil {
+				log.Printf("dropping invalid RTCP packet: %v", err)
+			}
+			continue
+		}
+		var header rtp.Header
+		if _, err := header.Unmarshal(buffer[:n]); err != nil {
+			log.Printf("dropping invalid RTP packet: %v", err)
+			continue
+		}
+		t, ok := r.track(header.SSRC)
+		if !ok {
+			continue
+		}
+		if _, _, err := t.rtpReader.Read(buffer[:n], scream.SetECN(nil, uint8(ecn))); err != nil {
+			connErrC <- fmt.Errorf("rtpReader failed to read received buffer: %w", err)
+			return
+		}
+	}
+}
+
 func (r *Receiver) Close() error {
 	close(r.closeC)
 	return nil
@@ -0,0 +1,307 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+var (
+	// ErrNotConnected is returned when writing while the sender is
+	// reconnecting.
+	ErrNotConnected = errors.New("sender is not connected")
+	// ErrFeedbackTimeout is reported as the failure of a connection on
+	// which no RTCP packet arrived for the timeout set by
+	// SenderFeedbackTimeout.
+	ErrFeedbackTimeout = errors.New("feedback timeout")
+
+	errSenderStopped = errors.New("sender stopped")
+)
+
+// DialFunc opens a new connection to the receiver. It returns the writer
+// for RTP packets and the reader for RTCP packets of the new connection.
+type DialFunc func() (RTPWriter, io.Reader, error)
+
+// SenderReconnect makes the sender dial a new connection using dial when
+// the current connection fails, instead of stopping. Failed dials are
+// retried with an exponential backoff between minBackoff and maxBackoff.
+// The encoder keeps running while the sender is disconnected, packets are
+// dropped until the new connection is up and a key frame is requested.
+// The interceptors of the failed connection are closed and replaced by new
+// ones, so that the congestion controller starts over on the new path.
+func SenderReconnect(dial DialFunc, minBackoff, maxBackoff time.Duration) SenderOption {
+	return func(s *Sender) error {
+		if minBackoff <= 0 || maxBackoff < minBackoff {
+			return fmt.Errorf("invalid reconnect backoff: min %v, max %v", minBackoff, maxBackoff)
+		}
+		s.dial = dial
+		s.minBackoff = minBackoff
+		s.maxBackoff = maxBackoff
+		return nil
+	}
+}
+
+// SenderFeedbackTimeout makes the sender consider its connection failed if
+// no RTCP packet was read from it for timeout, since transports without
+// connection state like UDP do not report failures. It only applies if the
+// sender reads feedback, the receiver must send RTCP packets more often
+// than timeout.
+func SenderFeedbackTimeout(timeout time.Duration) SenderOption {
+	return func(s *Sender) error {
+		if timeout <= 0 {
+			return fmt.Errorf("invalid feedback timeout: %v", timeout)
+		}
+		s.feedbackTimeout = timeout
+		return nil
+	}
+}
+
+// connection is a connection of the sender to the receiver.
+type connection struct {
+	w RTPWriter
+	r io.Reader
+	// lastRTCP is the time in nanoseconds since the epoch at which the
+	// last RTCP packet was read, or the connection was created. It is
+	// accessed atomically.
+	lastRTCP int64
+}
+
+func newConnection(w RTPWriter, r io.Reader) *connection {
+	return &connection{w: w, r: r, lastRTCP: time.Now().UnixNano()}
+}
+
+// sinceRTCP returns the time since the last RTCP packet was read from c.
+func (c *connection) sinceRTCP() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRTCP)))
+}
+
+// connError reports the failure of a connection.
+type connError struct {
+	conn *connection
+	err  error
+}
+
+func (s *Sender) currentConn() *connection {
+	s.connMu.RLock()
+	defer s.connMu.RUnlock()
+	return s.conn
+}
+
+func (s *Sender) setConn(c *connection) {
+	s.connMu.Lock()
+	defer s.connMu.Unlock()
+	s.conn = c
+}
+
+// connFailed reports that c failed. Failures of connections which were
+// already replaced are ignored.
+func (s *Sender) connFailed(c *connection, err error) {
+	s.connMu.Lock()
+	if s.conn != c {
+		s.connMu.Unlock()
+		return
+	}
+	s.conn = nil
+	s.connMu.Unlock()
+
+	select {
+	case s.connErrC <- connError{conn: c, err: err}:
+	case <-s.closeC:
+	}
+}
+
+// isConnError reports whether err means that the connection is unusable.
+func isConnError(err error) bool {
+	var sessionErr *transport.SessionError
+	if transport.IsClosed(err) || errors.As(err, &sessionErr) {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && !netErr.Temporary() {
+		return true
+	}
+	return errors.Is(err, io.EOF)
+}
+
+// readRTCP reads RTCP packets from c until it fails. If the sender accepts
+// feedback, the packets are passed to the interceptors, otherwise they are
+// only read to notice the end of the connection.
+func (s *Sender) readRTCP(c *connection) {
+	defer log.Println("finish reading rtcp")
+	for buffer := make([]byte, s.mtu); ; {
+		n, err := c.r.Read(buffer)
+		if errors.Is(err, io.ErrShortBuffer) {
+			log.Printf("dropping rtcp packet larger than MTU of %v bytes", s.mtu)
+			continue
+		}
+		if err != nil {
+			s.connFailed(c, err)
+			return
+		}
+		atomic.StoreInt64(&c.lastRTCP, time.Now().UnixNano())
+		if !s.acceptFeedback {
+			continue
+		}
+		if s.currentConn() != c {
+			// Late packets of a connection which was replaced.
+			continue
+		}
+		if err := s.readFeedback(buffer[:n]); err != nil {
+			select {
+			case s.feedbackErrC <- err:
+			case <-s.closeC:
+				return
+			}
+		}
+	}
+}
+
+// watchFeedback reports the failure of c if no RTCP packet was read from c
+// for the feedback timeout.
+func (s *Sender) watchFeedback(c *connection) {
+	if s.feedbackTimeout == 0 || !s.acceptFeedback {
+		return
+	}
+	ticker := time.NewTicker(s.feedbackTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.closeC:
+			return
+		}
+		if s.currentConn() != c {
+			return
+		}
+		if since := c.sinceRTCP(); since > s.feedbackTimeout {
+			s.connFailed(c, fmt.Errorf("%w: no RTCP packet for %v", ErrFeedbackTimeout, since.Round(time.Millisecond)))
+			return
+		}
+	}
+}
+
+// rebuildInterceptors closes the interceptors of the failed connection and
+// binds all streams to new interceptors, so that no state of the failed
+// connection like the congestion window or the packets queued for it is
+// used on the new connection.
+func (s *Sender) rebuildInterceptors() error {
+	s.interceptorsMu.Lock()
+	defer s.interceptorsMu.Unlock()
+	if s.stopped {
+		return errSenderStopped
+	}
+	if err := s.i.Close(); err != nil {
+		log.Printf("failed to close interceptors: %v", err)
+	}
+	ir := interceptor.Registry{}
+	for _, newInterceptor := range s.newInterceptors {
+		i, err := newInterceptor()
+		if err != nil {
+			return err
+		}
+		ir.Add(i)
+	}
+	var twcc, pacer interceptor.Interceptor
+	var err error
+	if s.newTWCC != nil {
+		if twcc, err = s.newTWCC(); err != nil {
+			return err
+		}
+	}
+	if s.newPacer != nil {
+		if pacer, err = s.newPacer(); err != nil {
+			return err
+		}
+	}
+	s.bindInterceptors(chainInterceptors(&ir, twcc, pacer))
+	return nil
+}
+
+// reconnect dials until a new connection is up or the sender is closed.
+func (s *Sender) reconnect() {
+	backoff := s.minBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-s.closeC:
+			return
+		}
+		w, r, err := s.dial()
+		if err != nil {
+			if backoff *= 2; backoff > s.maxBackoff {
+				backoff = s.maxBackoff
+			}
+			log.Printf("failed to reconnect, retrying in %v: %v", backoff, err)
+			continue
+		}
+		if err := s.rebuildInterceptors(); err != nil {
+			log.Printf("failed to rebuild interceptors: %v", err)
+			return
+		}
+		c := newConnection(w, r)
+		s.setConn(c)
+		go s.readRTCP(c)
+		go s.watchFeedback(c)
+		s.forceKeyFrames()
+		log.Printf("reconnected")
+		return
+	}
+}
+
+// connWriter writes to the current connection of a Sender and reports
+// connection failures.
+type connWriter struct {
+	s *Sender
+}
+
+func (w connWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	c := w.s.currentConn()
+	if c == nil {
+		return 0, ErrNotConnected
+	}
+	n, err := c.w.WriteRTP(header, payload)
+	if err != nil && isConnError(err) {
+		w.s.connFailed(c, err)
+	}
+	return n, err
+}
+
+func (w connWriter) WriteRTPNotify(header *rtp.Header, payload []byte, notify func(bool)) (int, error) {
+	c := w.s.currentConn()
+	if c == nil {
+		return 0, ErrNotConnected
+	}
+	aw, ok := c.w.(AckingRTPWriter)
+	if !ok {
+		return 0, errors.New("connection does not support acks")
+	}
+	n, err := aw.WriteRTPNotify(header, payload, notify)
+	if err != nil && isConnError(err) {
+		w.s.connFailed(c, err)
+	}
+	return n, err
+}
+
+func (w connWriter) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	c := w.s.currentConn()
+	if c == nil {
+		return 0, ErrNotConnected
+	}
+	rw, ok := c.w.(RTCPWriter)
+	if !ok {
+		return 0, errors.New("connection cannot write rtcp")
+	}
+	n, err := rw.WriteRTCP(pkts)
+	if err != nil && isConnError(err) {
+		w.s.connFailed(c, err)
+	}
+	return n, err
+}
@@ -0,0 +1,60 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/report"
+)
+
+// clockRate returns the RTP clock rate of codec.
+func clockRate(codec string) uint32 {
+	if codec == "opus" {
+		return 48000
+	}
+	return 90000
+}
+
+// ConfigureRTCPReports sends a sender report for each track every interval,
+// which maps the RTP timestamps of the track to the NTP wallclock. The
+// round trip time is computed from the receiver reports which echo the
+// sender reports and logged to rttLogger, if it is not nil. The RTT does
+// not depend on the transport, unlike the RTT of a QUIC connection.
+func (s *Sender) ConfigureRTCPReports(interval time.Duration, rttLogger io.Writer) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid report interval: %v", interval)
+	}
+	if s.conn.r == nil {
+		return errors.New("cannot read receiver reports with nil reader")
+	}
+	if err := s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return report.NewSenderInterceptor(report.SenderInterval(interval))
+	}); err != nil {
+		return err
+	}
+	_ = s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return utils.NewReportRTTInterceptor(rttLogger), nil
+	})
+	s.acceptFeedback = true
+	return nil
+}
+
+// ConfigureRTCPReports sends a receiver report for each track every
+// interval, which carries the fraction and number of lost packets, the
+// interarrival jitter and the timestamp of the last sender report with the
+// delay since it arrived.
+func (r *Receiver) ConfigureRTCPReports(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid report interval: %v", interval)
+	}
+	rr, err := report.NewReceiverInterceptor(report.ReceiverInterval(interval))
+	if err != nil {
+		return err
+	}
+	r.ir.Add(rr)
+	return nil
+}
@@ -1,17 +1,24 @@
 package rtc
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/mengelbart/rtq-go-endpoint/internal/fec"
 	gstsrc "github.com/mengelbart/rtq-go-endpoint/internal/gstreamer-src"
+	"github.com/mengelbart/rtq-go-endpoint/internal/nack"
 	"github.com/mengelbart/rtq-go-endpoint/internal/scream"
+	"github.com/mengelbart/rtq-go-endpoint/internal/twcc"
 	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
 	screamcgo "github.com/mengelbart/scream-go"
 	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 )
 
@@ -24,29 +31,160 @@ type AckingRTPWriter interface {
 }
 
 type Sender struct {
-	codec string
-	src   string
-	mtu   int
+	codec  string
+	src    string
+	mtu    int
+	tracks []*senderTrack
 
 	writeRTP interceptor.RTPWriterFunc
 
-	rtcpConn io.Reader
+	connMu         sync.RWMutex
+	conn           *connection
+	connErrC       chan connError
+	acceptFeedback bool
+
+	dial       DialFunc
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	feedbackTimeout time.Duration
+
+	rtcpFeedback        []interceptor.RTCPFeedback
+	rtpHeaderExtensions []interceptor.RTPHeaderExtension
+	// ir, twcc and pacer are the interceptors of the first connection.
+	// Later connections use new interceptors created by newInterceptors,
+	// newTWCC and newPacer, since closed interceptors cannot be reused.
+	ir              interceptor.Registry
+	twcc            interceptor.Interceptor
+	pacer           interceptor.Interceptor
+	newInterceptors []newInterceptorFunc
+	newTWCC         newInterceptorFunc
+	newPacer        newInterceptorFunc
+	cc              *ccHandle
+	retransmit      bool
+	protect         bool
+
+	keyFrameInterval int
+
+	// interceptorsMu guards the interceptors of the current connection and
+	// the readers and writers bound to them.
+	interceptorsMu sync.RWMutex
+	i              interceptor.Interceptor
+	rtcpReader     interceptor.RTCPReader
+	stopped        bool
 
-	streamInfo *interceptor.StreamInfo
-	ir         interceptor.Registry
-	i          interceptor.Interceptor
+	closeC       chan struct{}
+	feedbackErrC chan error
+}
+
+// senderTrack is a media stream sent by a Sender.
+type senderTrack struct {
+	ssrc     uint32
+	codec    string
+	src      string
+	priority float64
+	// rtxSSRC is the SSRC of the retransmissions, or 0 if the track is
+	// not retransmitted.
+	rtxSSRC uint32
+	// fecSSRC is the SSRC of the FEC packets, or 0 if the track is not
+	// protected by FEC.
+	fecSSRC uint32
 
+	streamInfo *interceptor.StreamInfo
 	rtpWriter  interceptor.RTPWriter
-	rtcpReader interceptor.RTCPReader
+	pipeline   *gstsrc.Pipeline
+	bitrate    uint
+}
 
-	pipeline *gstsrc.Pipeline
+// Opus tracks are limited to a bitrate range which is useful for speech and
+// music, so that congestion controllers leave the rest to video tracks.
+const (
+	opusMinBitrate   = 6_000
+	opusStartBitrate = 32_000
+	opusMaxBitrate   = 128_000
+)
 
-	closeC       chan struct{}
-	feedbackErrC chan error
+// attributes returns the attributes of the stream of t.
+func (t *senderTrack) attributes() interceptor.Attributes {
+	attributes := scream.SetPriority(nil, t.priority)
+	if t.codec == "opus" {
+		attributes = scream.SetBitrateRange(attributes, opusMinBitrate, opusStartBitrate, opusMaxBitrate)
+	}
+	return attributes
 }
 
 type SenderOption func(*Sender) error
 
+// SenderTrack adds a track which encodes the GStreamer source src with codec
+// and sends it with the given SSRC. Congestion controllers which support
+// several streams share the bandwidth between the tracks according to
+// their priority, which ranges from 0 (exclusive) to 1. If no track is
+// added, the sender sends a single track with a random SSRC and priority 1,
+// using the codec and source set by SenderCodec and SenderSrc.
+func SenderTrack(ssrc uint32, codec, src string, priority float64) SenderOption {
+	return func(s *Sender) error {
+		if priority <= 0 || priority > 1 {
+			return fmt.Errorf("invalid priority of track %v: %v", ssrc, priority)
+		}
+		for _, t := range s.tracks {
+			if t.ssrc == ssrc {
+				return fmt.Errorf("duplicate track SSRC: %v", ssrc)
+			}
+		}
+		s.tracks = append(s.tracks, &senderTrack{
+			ssrc:     ssrc,
+			codec:    codec,
+			src:      src,
+			priority: priority,
+		})
+		return nil
+	}
+}
+
+// SenderRTX sets the SSRC of the RTX stream on which the packets of the
+// track with the given SSRC are retransmitted if ConfigureNACK was called.
+// The track must have been added by SenderTrack before.
+func SenderRTX(ssrc, rtxSSRC uint32) SenderOption {
+	return func(s *Sender) error {
+		var track *senderTrack
+		for _, t := range s.tracks {
+			if t.ssrc == rtxSSRC || t.rtxSSRC == rtxSSRC || t.fecSSRC == rtxSSRC {
+				return fmt.Errorf("duplicate RTX SSRC: %v", rtxSSRC)
+			}
+			if t.ssrc == ssrc {
+				track = t
+			}
+		}
+		if track == nil {
+			return fmt.Errorf("no track with SSRC %v", ssrc)
+		}
+		track.rtxSSRC = rtxSSRC
+		return nil
+	}
+}
+
+// SenderFEC sets the SSRC of the FEC stream which protects the track with
+// the given SSRC if ConfigureFEC was called. The track must have been added
+// by SenderTrack before.
+func SenderFEC(ssrc, fecSSRC uint32) SenderOption {
+	return func(s *Sender) error {
+		var track *senderTrack
+		for _, t := range s.tracks {
+			if t.ssrc == fecSSRC || t.rtxSSRC == fecSSRC || t.fecSSRC == fecSSRC {
+				return fmt.Errorf("duplicate FEC SSRC: %v", fecSSRC)
+			}
+			if t.ssrc == ssrc {
+				track = t
+			}
+		}
+		if track == nil {
+			return fmt.Errorf("no track with SSRC %v", ssrc)
+		}
+		track.fecSSRC = fecSSRC
+		return nil
+	}
+}
+
 func SenderCodec(codec string) SenderOption {
 	return func(s *Sender) error {
 		s.codec = codec
@@ -61,49 +199,74 @@ func SenderSrc(src string) SenderOption {
 	}
 }
 
+// SenderMTU sets the largest RTP packet written to the connection and the
+// size of the RTCP read buffer. The payloaders produce smaller packets if
+// interceptors add to the packets, see packetOverhead.
+func SenderMTU(mtu int) SenderOption {
+	return func(s *Sender) error {
+		if mtu <= 0 {
+			return fmt.Errorf("invalid MTU: %v", mtu)
+		}
+		s.mtu = mtu
+		return nil
+	}
+}
+
 func NewSender(w RTPWriter, r io.Reader, opts ...SenderOption) (*Sender, error) {
 	s := &Sender{
-		codec:    "h264",
-		src:      "videotestsrc",
-		mtu:      1200,
-		writeRTP: defaultRTPWriterFunc(w),
-		rtcpConn: r,
-		streamInfo: &interceptor.StreamInfo{
-			SSRC: 0,
-		},
-		ir: interceptor.Registry{},
+		codec: "h264",
+		src:   "videotestsrc",
+		mtu:   1200,
+		conn:  newConnection(w, r),
+		ir:    interceptor.Registry{},
 
+		connErrC:     make(chan connError),
 		feedbackErrC: make(chan error),
 		closeC:       make(chan struct{}),
 	}
+	s.writeRTP = defaultRTPWriterFunc(connWriter{s: s})
 	for _, opt := range opts {
 		err := opt(s)
 		if err != nil {
 			return nil, err
 		}
 	}
+	if len(s.tracks) == 0 {
+		ssrcs, err := RandomSSRCs(1)
+		if err != nil {
+			return nil, err
+		}
+		s.tracks = []*senderTrack{{
+			ssrc:     ssrcs[0],
+			codec:    s.codec,
+			src:      s.src,
+			priority: 1,
+		}}
+	}
 	return s, nil
 }
 
-func (s *Sender) ConfigureInferingSCReAMInterceptor(statsLogger io.Writer, w AckingRTPWriter, m Metricer, inferFromSmoothedRTT bool) error {
+// ConfigureInferingSCReAMInterceptor runs SCReAM on feedback inferred from
+// the acks of the connection, which must implement AckingRTPWriter.
+func (s *Sender) ConfigureInferingSCReAMInterceptor(statsLogger io.Writer, m Metricer, inferFromSmoothedRTT bool) error {
+	if _, ok := s.conn.w.(AckingRTPWriter); !ok {
+		return fmt.Errorf("cannot infer feedback from connection without acks")
+	}
 	fbc := make(chan []byte, 1_000_000)
 	s.inferFeedback(fbc)
 
-	fbi := newFBInferer(w, screamcgo.NewRx(0), fbc, m, inferFromSmoothedRTT)
+	fbi := newFBInferer(connWriter{s: s}, screamcgo.NewRx(0), fbc, m, inferFromSmoothedRTT)
 	s.writeRTP = fbi.rtpWriterFunc
 	go fbi.buffer(s.closeC)
 
-	tx := screamcgo.NewTx()
-	cc, err := scream.NewSenderInterceptor(scream.Tx(tx))
-	if err != nil {
+	if err := s.addCC(newSCReAM); err != nil {
 		return err
 	}
-	s.streamInfo.RTCPFeedback = append(s.streamInfo.RTCPFeedback, interceptor.RTCPFeedback{
+	s.rtcpFeedback = append(s.rtcpFeedback, interceptor.RTCPFeedback{
 		Type:      "ack",
 		Parameter: "ccfb",
 	})
-	s.ir.Add(cc)
-	go s.runSCReAMStats(statsLogger, cc)
+	go s.runSCReAMStats(statsLogger, s.cc)
 	return nil
 }
 
@@ -113,7 +276,7 @@ func (s *Sender) inferFeedback(fbc <-chan []byte) {
 		for {
 			select {
 			case buffer := <-fbc:
-				if _, _, err := s.rtcpReader.Read(buffer, interceptor.Attributes{}); err != nil {
+				if err := s.readFeedback(buffer); err != nil {
 					s.feedbackErrC <- err
 				}
 			case <-s.closeC:
@@ -124,46 +287,65 @@ func (s *Sender) inferFeedback(fbc <-chan []byte) {
 }
 
 func (s *Sender) ConfigureNaiveBitrateAdaption(statsLogger io.Writer) error {
-	i, err := utils.NewSenderInterceptor()
-	if err != nil {
+	if err := s.addCC(func() (ccInterceptor, error) {
+		return utils.NewSenderInterceptor()
+	}); err != nil {
 		return err
 	}
-	s.ir.Add(i)
-	go s.runSCReAMStats(statsLogger, i)
+	go s.runSCReAMStats(statsLogger, s.cc)
 	return nil
 }
 
 func (s *Sender) ConfigureSCReAMInterceptor(statsLogger io.Writer) error {
-	tx := screamcgo.NewTx()
-	cc, err := scream.NewSenderInterceptor(scream.Tx(tx))
-	if err != nil {
+	if err := s.addCC(newSCReAM); err != nil {
 		return err
 	}
-	s.streamInfo.RTCPFeedback = append(s.streamInfo.RTCPFeedback, interceptor.RTCPFeedback{
+	s.rtcpFeedback = append(s.rtcpFeedback, interceptor.RTCPFeedback{
 		Type:      "ack",
 		Parameter: "ccfb",
 	})
-	s.ir.Add(cc)
-	go s.runSCReAMStats(statsLogger, cc)
+	go s.runSCReAMStats(statsLogger, s.cc)
 	return nil
 }
 
+func newSCReAM() (ccInterceptor, error) {
+	return scream.NewSenderInterceptor(scream.Tx(screamcgo.NewTx()))
+}
+
+// ConfigurePacer paces the packets sent by the congestion controller at its
+// target bitrate times factor, allowing bursts of up to burst bytes. It
+// must be called after configuring a congestion controller. If pacerLogger
+// is not nil, every paced packet is logged to it.
+func (s *Sender) ConfigurePacer(factor float64, burst int, pacerLogger io.Writer) error {
+	if s.cc == nil {
+		return errors.New("pacing requires a congestion controller")
+	}
+	opts := []utils.PacerOption{
+		utils.PacingFactor(factor),
+		utils.PacingBurst(burst),
+	}
+	if pacerLogger != nil {
+		opts = append(opts, utils.PacerLog(pacerLogger))
+	}
+	newPacer := func() (interceptor.Interceptor, error) {
+		return utils.NewPacerInterceptor(s.cc, opts...)
+	}
+	p, err := newPacer()
+	if err != nil {
+		return err
+	}
+	s.pacer = p
+	s.newPacer = newPacer
+	return nil
+}
+
+// AcceptFeedback passes the RTCP packets read from the connection to the
+// interceptors once the sender is started.
 func (s *Sender) AcceptFeedback() error {
-	if s.rtcpConn == nil {
+	if s.conn.r == nil {
 		return fmt.Errorf("cannot read rtcp with nil reader")
 	}
-	go func() {
-		defer log.Println("finish accepting feedback")
-		for buffer := make([]byte, s.mtu); ; {
-			n, err := s.rtcpConn.Read(buffer)
-			if err != nil {
-				s.feedbackErrC <- err
-			}
-			if _, _, err := s.rtcpReader.Read(buffer[:n], interceptor.Attributes{}); err != nil {
-				s.feedbackErrC <- err
-			}
-		}
-	}()
+	s.acceptFeedback = true
 	return nil
 }
 
@@ -172,30 +354,127 @@ type congestionController interface {
 	GetStatistics() string
 }
 
+// ccInterceptor is an interceptor which runs a congestion controller.
+type ccInterceptor interface {
+	interceptor.Interceptor
+	congestionController
+}
+
+// ccHandle refers to the congestion controller of the current connection.
+// The pacer, adaptive FEC and the statistics keep the handle, while the
+// congestion controller is replaced when the sender reconnects.
+type ccHandle struct {
+	mu sync.Mutex
+	cc congestionController
+}
+
+func (h *ccHandle) get() congestionController {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.cc
+}
+
+func (h *ccHandle) set(cc congestionController) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.cc = cc
+}
+
+func (h *ccHandle) GetTargetBitrate(ssrc uint32) (float64, error) {
+	return h.get().GetTargetBitrate(ssrc)
+}
+
+func (h *ccHandle) GetStatistics() string {
+	return h.get().GetStatistics()
+}
+
+// LossRate returns the loss rate observed by the congestion controller, or 0
+// if it does not observe losses.
+func (h *ccHandle) LossRate() float64 {
+	if loss, ok := h.get().(fec.LossSource); ok {
+		return loss.LossRate()
+	}
+	return 0
+}
+
+// newInterceptorFunc creates an interceptor of the sender.
+type newInterceptorFunc func() (interceptor.Interceptor, error)
+
+// addInterceptor adds the interceptor created by newInterceptor to the
+// registry of the first connection. newInterceptor is called again for
+// every later connection.
+func (s *Sender) addInterceptor(newInterceptor newInterceptorFunc) error {
+	i, err := newInterceptor()
+	if err != nil {
+		return err
+	}
+	s.ir.Add(i)
+	s.newInterceptors = append(s.newInterceptors, newInterceptor)
+	return nil
+}
+
+// addCC adds the congestion controller created by newCC, which is
+// available through s.cc afterwards.
+func (s *Sender) addCC(newCC func() (ccInterceptor, error)) error {
+	handle := &ccHandle{}
+	if err := s.addInterceptor(func() (interceptor.Interceptor, error) {
+		cc, err := newCC()
+		if err != nil {
+			return nil, err
+		}
+		handle.set(cc)
+		return cc, nil
+	}); err != nil {
+		return err
+	}
+	s.cc = handle
+	return nil
+}
+
+// Stats returns a snapshot of the state of the congestion controller: the
+// target bitrate of each track, keyed by "target-bitrate-" and the SSRC of
+// the track, and the observed "loss-rate". It returns nil if no congestion
+// controller is configured.
+func (s *Sender) Stats() map[string]float64 {
+	if s.cc == nil {
+		return nil
+	}
+	stats := map[string]float64{"loss-rate": s.cc.LossRate()}
+	for _, track := range s.tracks {
+		if bps, err := s.cc.GetTargetBitrate(track.ssrc); err == nil {
+			stats[fmt.Sprintf("target-bitrate-%v", track.ssrc)] = bps
+		}
+	}
+	return stats
+}
+
 func (s *Sender) runSCReAMStats(statsLogger io.Writer, cc congestionController) {
 	ticker := time.NewTicker(20 * time.Millisecond)
 	start := time.Now()
-	var lastBitrate uint
+	bitrates := make([]string, len(s.tracks))
 	for {
 		select {
 		case <-ticker.C:
-			bps, err := cc.GetTargetBitrate(0)
-			if err != nil {
-				log.Printf("failed to get target bitrate: %v\n", err)
+			for i, track := range s.tracks {
+				bps, err := cc.GetTargetBitrate(track.ssrc)
+				if err != nil {
+					log.Printf("failed to get target bitrate of SSRC %v: %v\n", track.ssrc, err)
+				}
+				if bps > 0 && track.pipeline != nil && track.bitrate != uint(bps) {
+					track.bitrate = uint(bps)
+					track.pipeline.SetBitRate(track.bitrate)
+				}
+				bitrates[i] = strconv.FormatUint(uint64(track.bitrate/1000), 10)
 			}
 			t := time.Since(start).Milliseconds()
-			if bps > 0 && s.pipeline != nil && lastBitrate != uint(bps) {
-				lastBitrate = uint(bps)
-				s.pipeline.SetBitRate(lastBitrate)
-			}
 			if statsLogger != nil {
 				// queueDelay, queueDelayMax, queueDelayMinAvg, sRtt, cwnd,
 				// bytesInFlight, rateTransmitted, isInFastStart,
 				// rtpQueueDelay, targetBitrate, rateRtp, rateTransmitted,
 				// rateAcked, rateLost, rateCe, hiSeqAck
 				stats := cc.GetStatistics()
-				// time, bitrate, stats
-				fmt.Fprintf(statsLogger, "%v, %v,\t%v\n", t, lastBitrate/1000, stats)
+				// time, bitrate of each track, stats
+				fmt.Fprintf(statsLogger, "%v, %v,\t%v\n", t, strings.Join(bitrates, ", "), stats)
 			}
 		case <-s.closeC:
 			return
@@ -204,17 +483,34 @@ func (s *Sender) runSCReAMStats(statsLogger io.Writer, cc congestionController)
 }
 
 func (s *Sender) ConfigureRTPLogInterceptor(rtcpIn, rtcpOut, rtpIn, rtpOut io.Writer) {
-	i := utils.NewRTPLogInterceptor(rtcpIn, rtcpOut, rtpIn, rtpOut)
-	s.ir.Add(i)
+	_ = s.addInterceptor(func() (interceptor.Interceptor, error) {
+		return utils.NewRTPLogInterceptor(rtcpIn, rtcpOut, rtpIn, rtpOut), nil
+	})
+}
+
+// trackWriter passes the RTP packets produced by the pipeline of a track to
+// the interceptors.
+type trackWriter struct {
+	s     *Sender
+	track *senderTrack
 }
 
-func (s *Sender) Write(p []byte) (n int, err error) {
+func (w trackWriter) Write(p []byte) (n int, err error) {
+	if w.s.currentConn() == nil {
+		// Drop the packets produced while reconnecting.
+		return len(p), nil
+	}
 	var pkt rtp.Packet
 	err = pkt.Unmarshal(p)
 	if err != nil {
 		return 0, err
 	}
-	_, err = s.rtpWriter.Write(&pkt.Header, pkt.Payload, nil)
+	w.s.interceptorsMu.RLock()
+	defer w.s.interceptorsMu.RUnlock()
+	if w.s.stopped {
+		return len(p), nil
+	}
+	_, err = w.track.rtpWriter.Write(&pkt.Header, pkt.Payload, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -226,7 +522,7 @@ func defaultRTPWriterFunc(w RTPWriter) interceptor.RTPWriterFunc {
 		n, err := w.WriteRTP(header, payload)
 
 		if err != nil {
-			if netErr, ok := err.(net.Error); ok && !netErr.Temporary() || err.Error() == "Application error 0x0: eos" {
+			if isConnError(err) || errors.Is(err, ErrNotConnected) {
 				return n, err
 			}
 			log.Printf("failed to write to rtpWriter: %T: %v\n", err, err)
@@ -236,47 +532,174 @@ func defaultRTPWriterFunc(w RTPWriter) interceptor.RTPWriterFunc {
 	}
 }
 
-func (s *Sender) Start() error {
-	i := s.ir.Build()
+// packetOverhead returns the number of bytes the interceptors add to the
+// largest packet of a payloader. Retransmissions carry the original
+// sequence number in front of the payload, FEC packets add their headers to
+// the longest protected packet. The transport-wide sequence number is added
+// to all packets.
+func (s *Sender) packetOverhead() int {
+	overhead := 0
+	if s.retransmit {
+		overhead = nack.RTXOverhead
+	}
+	if s.protect && fec.Overhead > overhead {
+		overhead = fec.Overhead
+	}
+	if s.twcc != nil {
+		overhead += twcc.Overhead
+	}
+	return overhead
+}
+
+// chainInterceptors returns the interceptors of a connection. The TWCC
+// interceptor and the pacer are bound first, so that the congestion
+// controller writes to the pacer and the paced packets are numbered right
+// before they are written to the connection. twcc and pacer may be nil.
+func chainInterceptors(ir *interceptor.Registry, twcc, pacer interceptor.Interceptor) interceptor.Interceptor {
+	i := ir.Build()
+	var chain []interceptor.Interceptor
+	if twcc != nil {
+		chain = append(chain, twcc)
+	}
+	if pacer != nil {
+		chain = append(chain, pacer)
+	}
+	if len(chain) > 0 {
+		i = interceptor.NewChain(append(chain, i))
+	}
+	return i
+}
+
+// bindInterceptors binds the streams of all tracks and the RTCP reader and
+// writer to the interceptors i. The caller must hold interceptorsMu.
+func (s *Sender) bindInterceptors(i interceptor.Interceptor) {
 	s.i = i
+	for _, t := range s.tracks {
+		t.streamInfo = &interceptor.StreamInfo{
+			SSRC:                t.ssrc,
+			ClockRate:           clockRate(t.codec),
+			Attributes:          t.attributes(),
+			RTCPFeedback:        s.rtcpFeedback,
+			RTPHeaderExtensions: s.rtpHeaderExtensions,
+		}
+		t.rtpWriter = s.i.BindLocalStream(t.streamInfo, interceptor.RTPWriterFunc(s.writeRTP))
+	}
+	if s.retransmit {
+		// Retransmissions are written to the RTX streams by the
+		// interceptors, the writers returned for them are not used.
+		for _, t := range s.tracks {
+			if t.rtxSSRC == 0 {
+				continue
+			}
+			_ = s.i.BindLocalStream(&interceptor.StreamInfo{
+				SSRC:                t.rtxSSRC,
+				ClockRate:           clockRate(t.codec),
+				Attributes:          nack.SetRTX(t.attributes(), t.ssrc),
+				RTCPFeedback:        s.rtcpFeedback,
+				RTPHeaderExtensions: s.rtpHeaderExtensions,
+			}, interceptor.RTPWriterFunc(s.writeRTP))
+		}
+	}
 
-	s.rtpWriter = s.i.BindLocalStream(s.streamInfo, interceptor.RTPWriterFunc(s.writeRTP))
+	if s.protect {
+		// FEC packets are written to the FEC streams by the
+		// interceptors, the writers returned for them are not used.
+		for _, t := range s.tracks {
+			if t.fecSSRC == 0 {
+				continue
+			}
+			_ = s.i.BindLocalStream(&interceptor.StreamInfo{
+				SSRC:                t.fecSSRC,
+				ClockRate:           clockRate(t.codec),
+				Attributes:          fec.SetFEC(t.attributes(), t.ssrc),
+				RTCPFeedback:        withoutNACK(s.rtcpFeedback),
+				RTPHeaderExtensions: s.rtpHeaderExtensions,
+			}, interceptor.RTPWriterFunc(s.writeRTP))
+		}
+	}
+
+	_ = s.i.BindRTCPWriter(interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, _ interceptor.Attributes) (int, error) {
+		return connWriter{s: s}.WriteRTCP(pkts)
+	}))
 
 	s.rtcpReader = s.i.BindRTCPReader(interceptor.RTCPReaderFunc(func(in []byte, attributes interceptor.Attributes) (int, interceptor.Attributes, error) {
 		return len(in), nil, nil
 	}))
+}
 
-	errC := make(chan error)
-
-	pipeline, err := gstsrc.NewPipeline(s.codec, s.src, s)
-	if err != nil {
-		return err
+// readFeedback passes an RTCP packet to the interceptors of the current
+// connection.
+func (s *Sender) readFeedback(buf []byte) error {
+	s.interceptorsMu.RLock()
+	defer s.interceptorsMu.RUnlock()
+	if s.stopped {
+		return nil
 	}
-	s.pipeline = pipeline
+	_, _, err := s.rtcpReader.Read(buf, interceptor.Attributes{})
+	return err
+}
+
+func (s *Sender) Start() error {
+	s.interceptorsMu.Lock()
+	s.bindInterceptors(chainInterceptors(&s.ir, s.twcc, s.pacer))
+	s.interceptorsMu.Unlock()
 
+	// eosC is closed when the pipelines of all tracks reached the end of
+	// the stream.
 	eosC := make(chan struct{})
-	gstsrc.HandleSrcEOS(func() {
+	var eosWG sync.WaitGroup
+	for _, t := range s.tracks {
+		pipeline, err := gstsrc.NewPipeline(t.codec, t.src, s.mtu-s.packetOverhead(), s.keyFrameInterval, trackWriter{s: s, track: t})
+		if err != nil {
+			return err
+		}
+		eosWG.Add(1)
+		pipeline.HandleEOS(eosWG.Done)
+		pipeline.SetSSRC(uint(t.ssrc))
+		t.pipeline = pipeline
+	}
+	go func() {
+		eosWG.Wait()
 		close(eosC)
-	})
+	}()
+
+	if c := s.currentConn(); c.r != nil {
+		go s.readRTCP(c)
+		go s.watchFeedback(c)
+	}
 
-	s.pipeline.SetSSRC(uint(s.streamInfo.SSRC))
-	s.pipeline.Start()
+	for _, t := range s.tracks {
+		t.pipeline.Start()
+	}
 
 	go gstsrc.StartMainLoop()
 
-	select {
-	case <-eosC:
-		log.Println("eos")
-	case err := <-errC:
-		log.Printf("got error from interceptorWriter: %v\n", err)
-		s.pipeline.Stop()
-	case err := <-s.feedbackErrC:
-		log.Printf("got error from feedback Acceptor: %v\n", err)
-		s.pipeline.Stop()
-	case <-s.closeC:
-		s.pipeline.Stop()
+loop:
+	for {
+		select {
+		case <-eosC:
+			log.Println("eos")
+			break loop
+		case ce := <-s.connErrC:
+			log.Printf("connection failed: %v\n", ce.err)
+			if s.dial == nil {
+				s.stopPipelines()
+				break loop
+			}
+			go s.reconnect()
+		case err := <-s.feedbackErrC:
+			log.Printf("got error from feedback Acceptor: %v\n", err)
+			s.stopPipelines()
+			break loop
+		case <-s.closeC:
+			s.stopPipelines()
+			break loop
+		}
 	}
+	s.interceptorsMu.Lock()
+	s.stopped = true
 	s.i.Close()
+	s.interceptorsMu.Unlock()
 	select {
 	case <-eosC:
 	case <-time.After(3 * time.Second):
@@ -286,6 +709,19 @@ func (s *Sender) Start() error {
 	return nil
 }
 
+func (s *Sender) stopPipelines() {
+	for _, t := range s.tracks {
+		t.pipeline.Stop()
+	}
+}
+
+// forceKeyFrames asks the encoders of all tracks for a key frame.
+func (s *Sender) forceKeyFrames() {
+	for _, t := range s.tracks {
+		t.pipeline.ForceKeyFrame()
+	}
+}
+
 func (s *Sender) Close() error {
 	close(s.closeC)
 	return nil
@@ -0,0 +1,38 @@
+package rtc
+
+import (
+	"testing"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+func TestSenderStats(t *testing.T) {
+	s := &Sender{ir: interceptor.Registry{}, tracks: []*senderTrack{{ssrc: 1}, {ssrc: 2}}}
+	if stats := s.Stats(); stats != nil {
+		t.Errorf("stats %v without congestion controller", stats)
+	}
+
+	if err := s.addCC(func() (ccInterceptor, error) {
+		return utils.NewSenderInterceptor()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	cc := s.cc.get().(*utils.SenderInterceptor)
+	defer cc.Close()
+	cc.BindLocalStream(&interceptor.StreamInfo{SSRC: 1}, interceptor.RTPWriterFunc(func(*rtp.Header, []byte, interceptor.Attributes) (int, error) {
+		return 0, nil
+	}))
+
+	stats := s.Stats()
+	if _, ok := stats["loss-rate"]; !ok {
+		t.Errorf("stats %v without loss rate", stats)
+	}
+	if stats["target-bitrate-1"] <= 0 {
+		t.Errorf("stats %v without target bitrate of the bound track", stats)
+	}
+	if _, ok := stats["target-bitrate-2"]; ok {
+		t.Errorf("stats %v with target bitrate of a track unknown to the congestion controller", stats)
+	}
+}
@@ -0,0 +1,26 @@
+package rtc
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// RandomSSRCs returns n distinct random SSRCs as recommended by RFC 3550.
+func RandomSSRCs(n int) ([]uint32, error) {
+	ssrcs := make([]uint32, 0, n)
+	seen := make(map[uint32]struct{}, n)
+	buf := make([]byte, 4)
+	for len(ssrcs) < n {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate SSRC: %w", err)
+		}
+		ssrc := binary.BigEndian.Uint32(buf)
+		if _, ok := seen[ssrc]; ok {
+			continue
+		}
+		seen[ssrc] = struct{}{}
+		ssrcs = append(ssrcs, ssrc)
+	}
+	return ssrcs, nil
+}
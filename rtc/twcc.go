@@ -0,0 +1,74 @@
+package rtc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/internal/twcc"
+	"github.com/pion/interceptor"
+)
+
+// transportCCFeedback and transportCCExtension announce transport-wide
+// congestion control for all streams. Both sides use the same extension ID,
+// since it is not negotiated.
+var (
+	transportCCFeedback  = interceptor.RTCPFeedback{Type: "transport-cc"}
+	transportCCExtension = interceptor.RTPHeaderExtension{URI: twcc.TransportCCURI, ID: 1}
+)
+
+// ConfigureTWCC numbers all packets with a transport-wide sequence number
+// and reads the transport-cc feedback of the receiver, which reports the
+// arrival time of each packet. It is an alternative to the RFC 8888
+// feedback used by SCReAM. If logger is not nil, the result of every
+// reported packet is logged to it. The sequence numbers are added right
+// before the packets are written to the connection, after pacing.
+func (s *Sender) ConfigureTWCC(logger io.Writer) error {
+	if s.conn.r == nil {
+		return errors.New("cannot read transport-cc feedback with nil reader")
+	}
+	start := time.Now()
+	handler := twcc.SenderHandler(func(results []twcc.PacketResult) {
+		if logger == nil {
+			return
+		}
+		now := time.Since(start).Milliseconds()
+		for _, r := range results {
+			arrival := int64(-1)
+			if r.Received {
+				arrival = r.Arrival.Microseconds()
+			}
+			// time, ssrc, sequence number, transport sequence number, size, departure, arrival
+			fmt.Fprintf(logger, "%v, %v, %v, %v, %v, %v, %v\n", now, r.SSRC, r.SequenceNumber, r.TransportSequenceNumber, r.Size, r.Departure.Sub(start).Microseconds(), arrival)
+		}
+	})
+	newTWCC := func() (interceptor.Interceptor, error) {
+		return twcc.NewSenderInterceptor(handler)
+	}
+	t, err := newTWCC()
+	if err != nil {
+		return err
+	}
+	s.twcc = t
+	s.newTWCC = newTWCC
+	s.rtcpFeedback = append(s.rtcpFeedback, transportCCFeedback)
+	s.rtpHeaderExtensions = append(s.rtpHeaderExtensions, transportCCExtension)
+	s.acceptFeedback = true
+	return nil
+}
+
+// ConfigureTWCC sends transport-cc feedback every interval, which reports
+// the arrival times of the packets received since the last feedback. It
+// should be configured after all other interceptors, so that the arrival
+// times are taken when the packets are read from the connection.
+func (r *Receiver) ConfigureTWCC(interval time.Duration) error {
+	t, err := twcc.NewReceiverInterceptor(twcc.ReceiverInterval(interval))
+	if err != nil {
+		return err
+	}
+	r.ir.Add(t)
+	r.rtcpFeedback = append(r.rtcpFeedback, transportCCFeedback)
+	r.rtpHeaderExtensions = append(r.rtpHeaderExtensions, transportCCExtension)
+	return nil
+}
@@ -0,0 +1,37 @@
+package congestion
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/internal/protocol"
+)
+
+// noCongestionControl never limits sending, so that the application is
+// responsible for congestion control.
+type noCongestionControl struct{}
+
+var _ SendAlgorithmWithDebugInfos = noCongestionControl{}
+
+// NewNoCongestionControl makes a SendAlgorithm which neither limits nor paces
+// the packets sent.
+func NewNoCongestionControl() SendAlgorithmWithDebugInfos {
+	return noCongestionControl{}
+}
+
+func (noCongestionControl) TimeUntilSend(protocol.ByteCount) time.Time { return time.Time{} }
+func (noCongestionControl) HasPacingBudget() bool                      { return true }
+func (noCongestionControl) OnPacketSent(time.Time, protocol.ByteCount, protocol.PacketNumber, protocol.ByteCount, bool) {
+}
+func (noCongestionControl) CanSend(protocol.ByteCount) bool { return true }
+func (noCongestionControl) MaybeExitSlowStart()             {}
+func (noCongestionControl) OnPacketAcked(protocol.PacketNumber, protocol.ByteCount, protocol.ByteCount, time.Time) {
+}
+func (noCongestionControl) OnPacketLost(protocol.PacketNumber, protocol.ByteCount, protocol.ByteCount) {
+}
+func (noCongestionControl) OnRetransmissionTimeout(bool)          {}
+func (noCongestionControl) SetMaxDatagramSize(protocol.ByteCount) {}
+func (noCongestionControl) InSlowStart() bool                     { return false }
+func (noCongestionControl) InRecovery() bool                      { return false }
+func (noCongestionControl) GetCongestionWindow() protocol.ByteCount {
+	return protocol.MaxByteCount
+}
@@ -6,12 +6,24 @@ set -e
 
 mkdir -p /logs/qlog
 
+# The certificates are shared by both endpoints, so CERTS must be a volume
+# mounted into both containers.
+CERTS=${CERTS:-/certs}
+RECEIVER_HOST=${RECEIVER%:*}
+
 if [ "$ROLE" == "sender" ]; then
     # Wait for the simulator to start up.
     #/wait-for-it.sh sim:57832 -s -t 10
+    echo "Waiting for the certificate of the receiver..."
+    for i in $(seq 1 100); do
+        [ -f "$CERTS/receiver.pem" ] && break
+        sleep 0.1
+    done
     echo "Starting RTQ sender..."
-    QUIC_GO_LOG_LEVEL=error ./rtq send -addr $RECEIVER $SENDER_PARAMS $VIDEOS
+    QUIC_GO_LOG_LEVEL=error ./rtq send -addr $RECEIVER -tls-ca "$CERTS/ca.pem" $SENDER_PARAMS $VIDEOS
 else
+    echo "Generating the certificate of the receiver..."
+    ./rtq gencert -dir "$CERTS" -name receiver -hosts "localhost,127.0.0.1,::1,$RECEIVER_HOST"
     echo "Running RTQ receiver."
-    QUIC_GO_LOG_LEVEL=error ./rtq receive $RECEIVER_PARAMS $DESTINATION
+    QUIC_GO_LOG_LEVEL=error ./rtq receive -tls-cert "$CERTS/receiver.pem" -tls-key "$CERTS/receiver-key.pem" $RECEIVER_PARAMS $DESTINATION
 fi
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mengelbart/rtq-go-endpoint/rtc"
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+const (
+	// videoPriority is the default SCReAM priority of video tracks. It is
+	// lower than audioPriority, so that audio is served first.
+	videoPriority = 0.5
+	// audioPriority is the default SCReAM priority of audio tracks.
+	audioPriority = 1.0
+)
+
+// track is a media stream configured by a -track or -audio flag.
+type track struct {
+	codec    string
+	priority float64
+	// ssrc is the random SSRC of a sent track.
+	ssrc uint32
+	// rtxSSRC is the random SSRC of the retransmissions of a sent track,
+	// or 0 if it is not retransmitted.
+	rtxSSRC uint32
+	// fecSSRC is the random SSRC of the FEC packets of a sent track, or 0
+	// if it is not protected by FEC.
+	fecSSRC uint32
+}
+
+// trackFlags collect the tracks of repeated -track flags. Sender and
+// receiver must be given the same tracks in the same order, the position
+// of a track determines its flow.
+type trackFlags []track
+
+func (t *trackFlags) String() string {
+	if t == nil {
+		return ""
+	}
+	specs := make([]string, 0, len(*t))
+	for _, tr := range *t {
+		specs = append(specs, fmt.Sprintf("%v:%v", tr.codec, tr.priority))
+	}
+	return strings.Join(specs, ",")
+}
+
+// Set adds a video track given as codec[:priority].
+func (t *trackFlags) Set(v string) error {
+	codec, priority := v, strconv.FormatFloat(videoPriority, 'g', -1, 64)
+	if i := strings.IndexByte(v, ':'); i >= 0 {
+		codec, priority = v[:i], v[i+1:]
+	}
+	switch codec {
+	case H264, VP8, VP9, H265, AV1:
+	default:
+		return fmt.Errorf("invalid video codec %q, options: '%v', '%v', '%v', '%v', '%v'", codec, H264, VP8, VP9, H265, AV1)
+	}
+	p, err := strconv.ParseFloat(priority, 64)
+	if err != nil || p <= 0 || p > 1 {
+		return fmt.Errorf("invalid priority %q, must be in (0, 1]", priority)
+	}
+	*t = append(*t, track{codec: codec, priority: p})
+	return nil
+}
+
+// tracks returns the configured video tracks, or a single track of codec if
+// no -track flag was given.
+func (t trackFlags) tracks(codec string) []track {
+	if len(t) == 0 {
+		return []track{{codec: codec, priority: videoPriority}}
+	}
+	return append([]track(nil), t...)
+}
+
+// audioFlags configure the Opus audio track, which is sent after the video
+// tracks.
+type audioFlags struct {
+	enabled  bool
+	priority float64
+	file     string
+}
+
+func (a *audioFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&a.enabled, "audio", false, "add an Opus audio track after the video tracks (must be set on both sides)")
+}
+
+func (a *audioFlags) registerSource(fs *flag.FlagSet) {
+	fs.Float64Var(&a.priority, "audio-priority", audioPriority, "SCReAM priority of the audio track in (0, 1]")
+	fs.StringVar(&a.file, "audio-file", "", "file to read the audio track from instead of the test source")
+}
+
+// tracks appends the audio track to tracks if it is enabled.
+func (a *audioFlags) tracks(tracks []track) ([]track, error) {
+	if !a.enabled {
+		return tracks, nil
+	}
+	if a.priority <= 0 || a.priority > 1 {
+		return nil, fmt.Errorf("invalid audio priority %v, must be in (0, 1]", a.priority)
+	}
+	return append(tracks, track{codec: OPUS, priority: a.priority}), nil
+}
+
+// src returns the GStreamer source of the audio track.
+func (a *audioFlags) src() string {
+	if len(a.file) > 0 {
+		return fmt.Sprintf("filesrc location=%v ! queue ! decodebin ! audioconvert ", a.file)
+	}
+	return "audiotestsrc"
+}
+
+// trackCodecs returns the comma separated codecs of tracks, which are
+// announced in the session metadata.
+func trackCodecs(tracks []track) string {
+	codecs := make([]string, 0, len(tracks))
+	for _, t := range tracks {
+		codecs = append(codecs, t.codec)
+	}
+	return strings.Join(codecs, ",")
+}
+
+// formatSSRCs returns the comma separated SSRCs of the tracks, which are
+// announced in the session metadata.
+func formatSSRCs(ssrcs []uint32) string {
+	s := make([]string, 0, len(ssrcs))
+	for _, ssrc := range ssrcs {
+		s = append(s, strconv.FormatUint(uint64(ssrc), 10))
+	}
+	return strings.Join(s, ",")
+}
+
+// parseSSRCs parses the SSRCs announced by a sender of n tracks.
+func parseSSRCs(s string, n int) ([]uint32, error) {
+	if len(s) == 0 {
+		return nil, errors.New("no SSRCs announced")
+	}
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("got %v SSRCs for %v tracks", len(fields), n)
+	}
+	ssrcs := make([]uint32, 0, n)
+	seen := make(map[uint32]struct{}, n)
+	for _, f := range fields {
+		ssrc, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSRC %q", f)
+		}
+		if _, ok := seen[uint32(ssrc)]; ok {
+			return nil, fmt.Errorf("SSRC collision: %v is announced twice", ssrc)
+		}
+		seen[uint32(ssrc)] = struct{}{}
+		ssrcs = append(ssrcs, uint32(ssrc))
+	}
+	return ssrcs, nil
+}
+
+// parseRepairSSRCs parses the SSRCs of the RTX or FEC streams, named by
+// kind, announced by a sender of tracks with the given SSRCs. They must not
+// collide with the SSRCs of the tracks or of the streams in taken.
+func parseRepairSSRCs(kind, s string, ssrcs []uint32, taken ...[]uint32) ([]uint32, error) {
+	repairSSRCs, err := parseSSRCs(s, len(ssrcs))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", kind, err)
+	}
+	for _, repair := range repairSSRCs {
+		for _, ssrc := range ssrcs {
+			if repair == ssrc {
+				return nil, fmt.Errorf("SSRC collision: %v is announced for a track and an %v stream", ssrc, kind)
+			}
+		}
+		for _, other := range taken {
+			for _, ssrc := range other {
+				if repair == ssrc {
+					return nil, fmt.Errorf("SSRC collision: %v is announced for an %v stream and another stream", ssrc, kind)
+				}
+			}
+		}
+	}
+	return repairSSRCs, nil
+}
+
+// ssrcAnnouncement holds the SSRCs of the tracks, RTX streams and FEC
+// streams of a session, indexed by track.
+type ssrcAnnouncement struct {
+	ssrcs    []uint32
+	rtxSSRCs []uint32
+	fecSSRCs []uint32
+}
+
+// ssrcAnnouncements holds the SSRCs announced by the senders of sessions.
+type ssrcAnnouncements struct {
+	mu    sync.Mutex
+	ssrcs map[transport.Session]ssrcAnnouncement
+}
+
+func newSSRCAnnouncements() *ssrcAnnouncements {
+	return &ssrcAnnouncements{ssrcs: map[transport.Session]ssrcAnnouncement{}}
+}
+
+// announce stores the SSRCs of the tracks of session and of their RTX and
+// FEC streams, rtxSSRCs is nil if the sender does not retransmit and
+// fecSSRCs is nil if it does not send FEC packets.
+func (a *ssrcAnnouncements) announce(session transport.Session, ssrcs, rtxSSRCs, fecSSRCs []uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.ssrcs[session] = ssrcAnnouncement{ssrcs: ssrcs, rtxSSRCs: rtxSSRCs, fecSSRCs: fecSSRCs}
+}
+
+func (a *ssrcAnnouncements) remove(session transport.Session) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.ssrcs, session)
+}
+
+// track returns the index of the track which the sender of session
+// announced ssrc for.
+func (a *ssrcAnnouncements) track(session transport.Session, ssrc uint32) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, s := range a.ssrcs[session].ssrcs {
+		if s == ssrc {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// rtxTrack returns the SSRC of the track whose retransmissions the sender of
+// session announced ssrc for.
+func (a *ssrcAnnouncements) rtxTrack(session transport.Session, ssrc uint32) (uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	announcement := a.ssrcs[session]
+	return announcement.mediaSSRC(announcement.rtxSSRCs, ssrc)
+}
+
+// fecTrack returns the SSRC of the track which the sender of session
+// announced the FEC stream ssrc for.
+func (a *ssrcAnnouncements) fecTrack(session transport.Session, ssrc uint32) (uint32, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	announcement := a.ssrcs[session]
+	return announcement.mediaSSRC(announcement.fecSSRCs, ssrc)
+}
+
+// mediaSSRC returns the SSRC of the track whose stream in repairSSRCs has
+// the given SSRC.
+func (a ssrcAnnouncement) mediaSSRC(repairSSRCs []uint32, ssrc uint32) (uint32, bool) {
+	for i, s := range repairSSRCs {
+		if s == ssrc {
+			return a.ssrcs[i], true
+		}
+	}
+	return 0, false
+}
+
+// trackFlowID returns the flow of the i-th track. Flow IDs are even, since
+// the legacy framing sends the RTCP packets of a flow on the next odd ID.
+// The RTCP packets of all tracks are sent on the flow of the first track.
+func trackFlowID(i int) uint64 {
+	return uint64(2 * i)
+}
+
+// trackWriters opens the write flows of n tracks on session. If the session
+// does not keep flows apart, all tracks share the flow of the first track.
+func trackWriters(session transport.Session, n int) ([]transport.WriteFlow, error) {
+	if !transport.Supports(session, transport.Flows) {
+		n = 1
+	}
+	writers := make([]transport.WriteFlow, 0, n)
+	for i := 0; i < n; i++ {
+		w, err := session.Writer(trackFlowID(i))
+		if err != nil {
+			for _, w := range writers {
+				closeErr(w.Close)
+			}
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+	return writers, nil
+}
+
+// trackReaders opens the read flows of n tracks on session. If the session
+// does not keep flows apart, the packets of all tracks are read from the
+// flow of the first track.
+func trackReaders(session transport.Session, n int) ([]transport.ReadFlow, error) {
+	if !transport.Supports(session, transport.Flows) {
+		n = 1
+	}
+	readers := make([]transport.ReadFlow, 0, n)
+	for i := 0; i < n; i++ {
+		r, err := session.Reader(trackFlowID(i))
+		if err != nil {
+			for _, r := range readers {
+				closeErr(r.Close)
+			}
+			return nil, err
+		}
+		readers = append(readers, r)
+	}
+	return readers, nil
+}
+
+// trackRTPWriter returns the writer which sends the RTP packets,
+// retransmissions and FEC packets of each track on the flow of the track
+// and RTCP packets on the flow of the first track.
+func trackRTPWriter(tracks []track, writers []transport.WriteFlow) rtc.RTPWriter {
+	if len(writers) == 1 {
+		return writers[0]
+	}
+	w := ssrcWriter{flows: map[uint32]transport.WriteFlow{}, rtcp: writers[0]}
+	for i, t := range tracks {
+		w.flows[t.ssrc] = writers[i]
+		if t.rtxSSRC != 0 {
+			w.flows[t.rtxSSRC] = writers[i]
+		}
+		if t.fecSSRC != 0 {
+			w.flows[t.fecSSRC] = writers[i]
+		}
+	}
+	return w
+}
+
+// ssrcWriter writes RTP packets to the flow of the track of their SSRC.
+type ssrcWriter struct {
+	flows map[uint32]transport.WriteFlow
+	rtcp  transport.WriteFlow
+}
+
+func (w ssrcWriter) flow(ssrc uint32) (transport.WriteFlow, error) {
+	flow, ok := w.flows[ssrc]
+	if !ok {
+		return nil, fmt.Errorf("no flow for SSRC %v", ssrc)
+	}
+	return flow, nil
+}
+
+func (w ssrcWriter) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	flow, err := w.flow(header.SSRC)
+	if err != nil {
+		return 0, err
+	}
+	return flow.WriteRTP(header, payload)
+}
+
+func (w ssrcWriter) WriteRTPNotify(header *rtp.Header, payload []byte, notify func(bool)) (int, error) {
+	flow, err := w.flow(header.SSRC)
+	if err != nil {
+		return 0, err
+	}
+	aw, ok := flow.(transport.AckingWriteFlow)
+	if !ok {
+		return 0, errors.New("flow does not support acks")
+	}
+	return aw.WriteRTPNotify(header, payload, notify)
+}
+
+func (w ssrcWriter) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	return w.rtcp.WriteRTCP(pkts)
+}
@@ -0,0 +1,259 @@
+package transport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// ControlType identifies the kind of a ControlMessage.
+type ControlType uint8
+
+const (
+	// ControlEOS ends the session cleanly.
+	ControlEOS ControlType = iota + 1
+	// ControlError ends the session with an error code.
+	ControlError
+	// ControlStats carries a snapshot of statistics of the sending endpoint.
+	ControlStats
+	// ControlMetadata describes the session. Dialers send their metadata
+	// when the session is established.
+	ControlMetadata
+	// ControlProbe is a padded probe packet sent by UDP sessions to
+	// discover the path MTU.
+	ControlProbe
+	// ControlProbeAck acknowledges a ControlProbe of the given size.
+	ControlProbeAck
+	// ControlMetadataAck acknowledges the ControlMetadata of a UDP client,
+	// which retransmits it until it is acknowledged.
+	ControlMetadataAck
+)
+
+func (t ControlType) String() string {
+	switch t {
+	case ControlEOS:
+		return "eos"
+	case ControlError:
+		return "error"
+	case ControlStats:
+		return "stats"
+	case ControlMetadata:
+		return "metadata"
+	case ControlProbe:
+		return "probe"
+	case ControlProbeAck:
+		return "probe-ack"
+	case ControlMetadataAck:
+		return "metadata-ack"
+	default:
+		return fmt.Sprintf("control(%d)", uint8(t))
+	}
+}
+
+// ErrorCode is carried by ControlError messages. On QUIC, it is also used as
+// the application error code when the connection is closed.
+type ErrorCode uint64
+
+const (
+	// NoError is used when a session ends cleanly.
+	NoError ErrorCode = iota
+	// InternalError signals a failure of the endpoint.
+	InternalError
+	// ProtocolError signals that the peer violated the protocol.
+	ProtocolError
+	// UnsupportedError signals that the endpoint cannot handle the media
+	// described by the metadata of the peer.
+	UnsupportedError
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case NoError:
+		return "no error"
+	case InternalError:
+		return "internal error"
+	case ProtocolError:
+		return "protocol error"
+	case UnsupportedError:
+		return "unsupported"
+	default:
+		return fmt.Sprintf("error code %d", uint64(c))
+	}
+}
+
+// ControlMessage is sent on the control channel of a session. On QUIC the
+// control channel is the first bidirectional stream, which is opened by the
+// dialer. On UDP and TCP, control messages are sent as packets starting
+// with a zero byte, which cannot be confused with RTP or RTCP packets
+// starting with version 2.
+type ControlMessage struct {
+	Type ControlType `json:"-"`
+	// Code and Reason are set on ControlError messages.
+	Code   ErrorCode `json:"code,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	// Stats is set on ControlStats messages.
+	Stats map[string]float64 `json:"stats,omitempty"`
+	// Metadata is set on ControlMetadata messages.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Size is the size of the acknowledged probe on ControlProbeAck
+	// messages.
+	Size int `json:"size,omitempty"`
+}
+
+// terminal reports whether the message ends the session.
+func (m *ControlMessage) terminal() bool {
+	return m.Type == ControlEOS || m.Type == ControlError
+}
+
+// err returns the error returned by the flows of a session whose peer sent
+// the terminal message m.
+func (m *ControlMessage) err() error {
+	if m.Type == ControlError && m.Code != NoError {
+		return &SessionError{Code: m.Code, Reason: m.Reason, Remote: true}
+	}
+	return ErrEndOfStream
+}
+
+// localErr returns the error returned by the flows of a session which was
+// ended by sending the terminal message m.
+func (m *ControlMessage) localErr() error {
+	if m.Type == ControlError && m.Code != NoError {
+		return &SessionError{Code: m.Code, Reason: m.Reason}
+	}
+	return ErrSessionClosed
+}
+
+// marshal encodes the message as its type followed by the JSON encoding of
+// its fields.
+func (m *ControlMessage) marshal() ([]byte, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{byte(m.Type)}, body...), nil
+}
+
+func unmarshalControlMessage(buf []byte) (*ControlMessage, error) {
+	if len(buf) < 1 {
+		return nil, errors.New("empty control message")
+	}
+	m := &ControlMessage{Type: ControlType(buf[0])}
+	if err := json.Unmarshal(buf[1:], m); err != nil {
+		return nil, fmt.Errorf("invalid %v control message: %w", m.Type, err)
+	}
+	return m, nil
+}
+
+// controlPacketMarker is the first byte of control packets on transports
+// which send them in line with the media packets.
+const controlPacketMarker = 0x00
+
+func isControlPacket(buf []byte) bool {
+	return len(buf) > 0 && buf[0] == controlPacketMarker
+}
+
+func marshalControlPacket(m *ControlMessage) ([]byte, error) {
+	buf, err := m.marshal()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{controlPacketMarker}, buf...), nil
+}
+
+func unmarshalControlPacket(buf []byte) (*ControlMessage, error) {
+	return unmarshalControlMessage(buf[1:])
+}
+
+var (
+	// ErrEndOfStream is returned by the flows of a session after the peer
+	// ended the session cleanly.
+	ErrEndOfStream = errors.New("end of stream")
+	// ErrSessionClosed is returned by the flows of a session after it was
+	// closed locally.
+	ErrSessionClosed = errors.New("session closed")
+	// ErrControlUnsupported is returned by SendControl if the session has no
+	// control channel.
+	ErrControlUnsupported = errors.New("control channel not supported by peer")
+)
+
+// SessionError is returned by the flows of a session which was ended with an
+// error code.
+type SessionError struct {
+	Code   ErrorCode
+	Reason string
+	// Remote is set if the peer ended the session.
+	Remote bool
+}
+
+func (e *SessionError) Error() string {
+	side := "locally"
+	if e.Remote {
+		side = "by peer"
+	}
+	if len(e.Reason) == 0 {
+		return fmt.Sprintf("session closed %v: %v", side, e.Code)
+	}
+	return fmt.Sprintf("session closed %v: %v: %v", side, e.Code, e.Reason)
+}
+
+// IsClosed reports whether err was caused by the clean end of the session by
+// either side. It also recognizes the errors returned by the QUIC streams of
+// a StreamSession.
+func IsClosed(err error) bool {
+	if errors.Is(err, ErrEndOfStream) || errors.Is(err, ErrSessionClosed) {
+		return true
+	}
+	var appErr *quic.ApplicationError
+	return errors.As(err, &appErr) && ErrorCode(appErr.ErrorCode) == NoError
+}
+
+// quicSessionError converts the errors returned by a closed QUIC session to
+// the errors of this package.
+func quicSessionError(err error) error {
+	var appErr *quic.ApplicationError
+	if !errors.As(err, &appErr) {
+		return err
+	}
+	code := ErrorCode(appErr.ErrorCode)
+	switch {
+	case code != NoError:
+		return &SessionError{Code: code, Reason: appErr.ErrorMessage, Remote: appErr.Remote}
+	case appErr.Remote:
+		return ErrEndOfStream
+	default:
+		return ErrSessionClosed
+	}
+}
+
+// ControlHandler is called for every control message received by a session.
+// EOS and error messages are passed to the handler before the flows of the
+// session return the corresponding error. The handler must not block.
+func ControlHandler(handler func(Session, *ControlMessage)) Option {
+	return func(c *Config) error {
+		c.ControlHandler = handler
+		return nil
+	}
+}
+
+// SessionMetadata sets the metadata which dialers send to the listener
+// when the session is established.
+func SessionMetadata(metadata map[string]string) Option {
+	return func(c *Config) error {
+		c.Metadata = metadata
+		return nil
+	}
+}
+
+func (c *Config) handleControl(s Session, m *ControlMessage) {
+	if c.ControlHandler != nil {
+		c.ControlHandler(s, m)
+	}
+}
+
+// metadataMessage returns the message which dialers send when the session is
+// established.
+func (c *Config) metadataMessage() *ControlMessage {
+	return &ControlMessage{Type: ControlMetadata, Metadata: c.Metadata}
+}
@@ -0,0 +1,91 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ECN is an Explicit Congestion Notification codepoint (RFC 3168) as carried
+// in the two least significant bits of the IPv4 TOS or IPv6 traffic class
+// field.
+type ECN uint8
+
+const (
+	// NotECT marks packets of transports which do not support ECN.
+	NotECT ECN = 0x00
+	// ECT1 marks ECN capable packets which use the L4S service (RFC 9331).
+	ECT1 ECN = 0x01
+	// ECT0 marks ECN capable packets which use classic ECN.
+	ECT0 ECN = 0x02
+	// CE marks packets which experienced congestion.
+	CE ECN = 0x03
+
+	ecnMask = 0x03
+)
+
+func (e ECN) String() string {
+	switch e {
+	case NotECT:
+		return "not-ect"
+	case ECT1:
+		return "ect1"
+	case ECT0:
+		return "ect0"
+	case CE:
+		return "ce"
+	default:
+		return fmt.Sprintf("ecn(%d)", uint8(e))
+	}
+}
+
+// ParseECN parses the codepoint used to mark outgoing packets: 'off',
+// 'ect0' or 'ect1'. 'l4s' is an alias for 'ect1'.
+func ParseECN(s string) (ECN, error) {
+	switch strings.ToLower(s) {
+	case "", "off", NotECT.String():
+		return NotECT, nil
+	case ECT0.String():
+		return ECT0, nil
+	case ECT1.String(), "l4s":
+		return ECT1, nil
+	default:
+		return NotECT, fmt.Errorf("invalid ECN codepoint %q, options: 'off', 'ect0', 'ect1', 'l4s'", s)
+	}
+}
+
+// ECNMarking marks all RTP and RTCP packets sent on UDP sessions with the
+// ECN codepoint ecn. Received codepoints are reported by ReadECN regardless
+// of this option.
+func ECNMarking(ecn ECN) Option {
+	return func(c *Config) error {
+		if ecn == CE {
+			return errors.New("cannot mark outgoing packets as CE")
+		}
+		c.ECN = ecn
+		return nil
+	}
+}
+
+// ECNReader is implemented by ReadFlows which report the ECN codepoint of
+// the received packets.
+type ECNReader interface {
+	// ReadECN reads the next packet like Read and returns the ECN codepoint
+	// it was received with.
+	ReadECN(p []byte) (int, ECN, error)
+}
+
+// errECNUnsupported is returned on platforms which cannot set or read ECN
+// codepoints.
+var errECNUnsupported = errors.New("ECN is not supported on this platform")
+
+// udpConn returns the UDP socket of conn, which may be wrapped in an
+// EmulatedConn.
+func udpConn(conn net.PacketConn) (*net.UDPConn, bool) {
+	if e, ok := conn.(*EmulatedConn); ok {
+		conn = e.PacketConn
+	}
+	c, ok := conn.(*net.UDPConn)
+	return c, ok
+}
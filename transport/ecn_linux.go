@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ecnOOBSize is large enough for a single TOS or traffic class control
+// message.
+const ecnOOBSize = 64
+
+// setupECN enables receiving the ECN codepoint of incoming packets on conn
+// and marks outgoing packets with mark unless it is NotECT. Like quic-go,
+// both IPv4 and IPv6 options are set, since a socket may carry both.
+func setupECN(conn *net.UDPConn, mark ECN) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errRecv4, errRecv6, errMark4, errMark6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		errRecv4 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_RECVTOS, 1)
+		errRecv6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1)
+		if mark != NotECT {
+			errMark4 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, int(mark))
+			errMark6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int(mark))
+		}
+	}); err != nil {
+		return err
+	}
+	if errRecv4 != nil && errRecv6 != nil {
+		return errors.New("failed to enable receiving ECN for both IPv4 and IPv6")
+	}
+	if errMark4 != nil && errMark6 != nil {
+		return errors.New("failed to enable ECN marking for both IPv4 and IPv6")
+	}
+	return nil
+}
+
+// readECN reads a packet from conn and returns the ECN codepoint it was
+// received with.
+func readECN(conn *net.UDPConn, p []byte) (int, net.Addr, ECN, error) {
+	var oob [ecnOOBSize]byte
+	n, oobn, _, addr, err := conn.ReadMsgUDP(p, oob[:])
+	if err != nil {
+		return n, nil, NotECT, err
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, addr, NotECT, nil
+	}
+	for _, msg := range msgs {
+		if len(msg.Data) == 0 {
+			continue
+		}
+		switch {
+		case msg.Header.Level == unix.IPPROTO_IP && msg.Header.Type == unix.IP_TOS,
+			msg.Header.Level == unix.IPPROTO_IPV6 && msg.Header.Type == unix.IPV6_TCLASS:
+			return n, addr, ECN(msg.Data[0] & ecnMask), nil
+		}
+	}
+	return n, addr, NotECT, nil
+}
+
+// writeECN writes p to addr on conn with the ECN codepoint ecn, overriding
+// the marking of the socket.
+func writeECN(conn *net.UDPConn, p []byte, addr net.Addr, ecn ECN) (int, error) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return conn.WriteTo(p, addr)
+	}
+	var oob []byte
+	if udpAddr.IP.To4() != nil {
+		oob = controlMessage(unix.IPPROTO_IP, unix.IP_TOS, int32(ecn))
+	} else {
+		oob = controlMessage(unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int32(ecn))
+	}
+	n, _, err := conn.WriteMsgUDP(p, oob, udpAddr)
+	return n, err
+}
+
+// controlMessage returns a socket control message carrying a single int.
+func controlMessage(level, typ int, value int32) []byte {
+	buf := make([]byte, unix.CmsgSpace(4))
+	h := (*unix.Cmsghdr)(unsafe.Pointer(&buf[0]))
+	h.Level = int32(level)
+	h.Type = int32(typ)
+	h.SetLen(unix.CmsgLen(4))
+	*(*int32)(unsafe.Pointer(&buf[unix.CmsgLen(0)])) = value
+	return buf
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package transport
+
+import "net"
+
+func setupECN(conn *net.UDPConn, mark ECN) error {
+	return errECNUnsupported
+}
+
+func readECN(conn *net.UDPConn, p []byte) (int, net.Addr, ECN, error) {
+	n, addr, err := conn.ReadFrom(p)
+	return n, addr, NotECT, err
+}
+
+func writeECN(conn *net.UDPConn, p []byte, addr net.Addr, ecn ECN) (int, error) {
+	return conn.WriteTo(p, addr)
+}
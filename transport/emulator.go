@@ -0,0 +1,459 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LossModel decides which packets are dropped by the emulated link.
+type LossModel interface {
+	// Drop is called once per packet leaving the bottleneck and reports
+	// whether the packet should be dropped.
+	Drop(r *rand.Rand) bool
+}
+
+// BernoulliLoss drops each packet independently with probability P.
+type BernoulliLoss struct {
+	P float64
+}
+
+func (l *BernoulliLoss) Drop(r *rand.Rand) bool {
+	return l.P > 0 && r.Float64() < l.P
+}
+
+// GilbertElliottLoss is a two state Markov loss model. In the good state,
+// packets are dropped with probability 1-K and in the bad state with
+// probability 1-H. P is the probability to move from the good to the bad
+// state and R the probability to move back, evaluated once per packet.
+type GilbertElliottLoss struct {
+	P, R, K, H float64
+
+	bad bool
+}
+
+func (l *GilbertElliottLoss) Drop(r *rand.Rand) bool {
+	if l.bad {
+		if r.Float64() < l.R {
+			l.bad = false
+		}
+	} else if r.Float64() < l.P {
+		l.bad = true
+	}
+	if l.bad {
+		return r.Float64() >= l.H
+	}
+	return r.Float64() >= l.K
+}
+
+// ParseLossModel parses a loss model from a string. A single number is
+// interpreted as the loss probability of BernoulliLoss, the format
+// 'ge:p,r,k,h' creates a GilbertElliottLoss.
+func ParseLossModel(s string) (LossModel, error) {
+	if !strings.HasPrefix(s, "ge:") {
+		p, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid loss probability %q: %w", s, err)
+		}
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("loss probability must be in [0, 1], got %v", p)
+		}
+		return &BernoulliLoss{P: p}, nil
+	}
+	fields := strings.Split(strings.TrimPrefix(s, "ge:"), ",")
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("invalid Gilbert-Elliott parameters %q, expected 'ge:p,r,k,h'", s)
+	}
+	var params [4]float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Gilbert-Elliott parameter %q: %w", f, err)
+		}
+		if v < 0 || v > 1 {
+			return nil, fmt.Errorf("Gilbert-Elliott parameters must be in [0, 1], got %v", v)
+		}
+		params[i] = v
+	}
+	return &GilbertElliottLoss{P: params[0], R: params[1], K: params[2], H: params[3]}, nil
+}
+
+// CapacityTrace describes a time varying link capacity. The capacity of a
+// step is valid from its offset until the offset of the next step. The last
+// step is valid until the end of the emulation.
+type CapacityTrace struct {
+	steps []capacityStep
+}
+
+type capacityStep struct {
+	offset time.Duration
+	rate   int
+}
+
+// RMCATVariableCapacity is the capacity trace of the variable available
+// capacity test case with a single flow (RFC 8867, Section 5.1).
+var RMCATVariableCapacity = &CapacityTrace{
+	steps: []capacityStep{
+		{offset: 0, rate: 1_000_000},
+		{offset: 40 * time.Second, rate: 2_500_000},
+		{offset: 60 * time.Second, rate: 600_000},
+		{offset: 80 * time.Second, rate: 1_000_000},
+	},
+}
+
+// ParseCapacityTrace reads a capacity trace. Each line holds the offset from
+// the start of the emulation in milliseconds and the capacity from this
+// offset on in bits per second, separated by whitespace or a comma. Empty
+// lines and lines starting with '#' are ignored.
+func ParseCapacityTrace(r io.Reader) (*CapacityTrace, error) {
+	var steps []capacityStep
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(text, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %v: expected offset and capacity, got %q", line, text)
+		}
+		offset, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid offset: %w", line, err)
+		}
+		rate, err := strconv.ParseUint(fields[1], 10, 63)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: invalid capacity: %w", line, err)
+		}
+		steps = append(steps, capacityStep{
+			offset: time.Duration(offset) * time.Millisecond,
+			rate:   int(rate),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("empty capacity trace")
+	}
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].offset < steps[j].offset
+	})
+	return &CapacityTrace{steps: steps}, nil
+}
+
+// LoadCapacityTrace reads a capacity trace from the file at path, see
+// ParseCapacityTrace for the format.
+func LoadCapacityTrace(path string) (*CapacityTrace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseCapacityTrace(f)
+}
+
+// Rate returns the capacity in bits per second at offset d from the start
+// of the trace.
+func (t *CapacityTrace) Rate(d time.Duration) int {
+	i := sort.Search(len(t.steps), func(i int) bool {
+		return t.steps[i].offset > d
+	})
+	if i == 0 {
+		return t.steps[0].rate
+	}
+	return t.steps[i-1].rate
+}
+
+// EmulationProfile describes the link emulated for outgoing packets.
+type EmulationProfile struct {
+	// Rate is the bottleneck capacity in bits per second. Zero disables the
+	// bottleneck. Ignored if Trace is set.
+	Rate int
+	// Trace replays a time varying bottleneck capacity.
+	Trace *CapacityTrace
+	// Burst is the size of the token bucket in bytes, i.e. the number of
+	// bytes which may pass the bottleneck at once after an idle period.
+	Burst int
+	// QueueLimit is the maximum number of bytes waiting in front of the
+	// bottleneck. Packets exceeding the limit are dropped. Zero means
+	// unlimited.
+	QueueLimit int
+	// Delay is the one-way propagation delay added to each packet.
+	Delay time.Duration
+	// Jitter is the maximum random variation added to Delay. Packets are
+	// never reordered by jitter.
+	Jitter time.Duration
+	// Loss drops packets after they passed the bottleneck.
+	Loss LossModel
+	// CEThreshold marks ECN capable packets as CE if they waited longer
+	// than CEThreshold in front of the bottleneck, like the step marking of
+	// an L4S queue. Zero disables marking.
+	CEThreshold time.Duration
+	// Seed seeds the random source for jitter and losses.
+	Seed int64
+}
+
+func (p *EmulationProfile) rate(d time.Duration) int {
+	if p.Trace != nil {
+		return p.Trace.Rate(d)
+	}
+	return p.Rate
+}
+
+type emulatedPacket struct {
+	data     []byte
+	addr     net.Addr
+	enqueued time.Time
+	deliver  time.Time
+	ce       bool
+}
+
+// EmulatedConn is a net.PacketConn which passes all written packets through
+// an emulated bottleneck link before sending them on the wrapped connection.
+// Reads are passed through unchanged.
+type EmulatedConn struct {
+	net.PacketConn
+	// ecn is the codepoint of the written packets. Only ECN capable packets
+	// are CE marked.
+	ecn ECN
+
+	profile *EmulationProfile
+	rand    *rand.Rand
+	start   time.Time
+
+	mu          sync.Mutex
+	queue       []*emulatedPacket
+	queuedBytes int
+	delayLine   []*emulatedPacket
+	tokens      float64
+	lastRefill  time.Time
+	lastDeliver time.Time
+
+	wake      chan struct{}
+	closing   chan struct{}
+	drained   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// emulatedConnDrainTimeout limits how long Close waits for packets which are
+// still in the emulated link.
+const emulatedConnDrainTimeout = 2 * time.Second
+
+// NewEmulatedConn wraps conn with the emulated link described by profile.
+func NewEmulatedConn(conn net.PacketConn, profile *EmulationProfile) *EmulatedConn {
+	now := time.Now()
+	c := &EmulatedConn{
+		PacketConn: conn,
+		profile:    profile,
+		rand:       rand.New(rand.NewSource(profile.Seed)),
+		start:      now,
+		tokens:     float64(profile.Burst),
+		lastRefill: now,
+		wake:       make(chan struct{}, 1),
+		closing:    make(chan struct{}),
+		drained:    make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go c.loop()
+	return c
+}
+
+// WriteTo enqueues p for transmission to addr. Packets dropped by the
+// emulated link are reported as written.
+func (c *EmulatedConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closing:
+		return 0, net.ErrClosed
+	default:
+	}
+
+	c.mu.Lock()
+	if c.profile.QueueLimit > 0 && c.queuedBytes+len(p) > c.profile.QueueLimit {
+		c.mu.Unlock()
+		return len(p), nil
+	}
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	c.queue = append(c.queue, &emulatedPacket{data: buf, addr: addr, enqueued: time.Now()})
+	c.queuedBytes += len(buf)
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// Close waits until all packets left the emulated link, so that packets
+// written right before closing still reach the peer, and then closes the
+// wrapped connection. Packets which are still in the link after
+// emulatedConnDrainTimeout are discarded.
+func (c *EmulatedConn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+		select {
+		case <-c.drained:
+		case <-time.After(emulatedConnDrainTimeout):
+		}
+		close(c.done)
+	})
+	return c.PacketConn.Close()
+}
+
+// refill adds the tokens earned since the last refill to the token bucket
+// and returns the current bottleneck rate.
+func (c *EmulatedConn) refill(now time.Time) int {
+	rate := c.profile.rate(now.Sub(c.start))
+	elapsed := now.Sub(c.lastRefill).Seconds()
+	c.lastRefill = now
+	c.tokens += elapsed * float64(rate) / 8
+	limit := float64(c.profile.Burst)
+	if len(c.queue) > 0 && float64(len(c.queue[0].data)) > limit {
+		limit = float64(len(c.queue[0].data))
+	}
+	if c.tokens > limit {
+		c.tokens = limit
+	}
+	return rate
+}
+
+// dequeue moves all packets which may pass the bottleneck at now to the delay
+// line and returns how long to wait for the next packet to pass. It returns a
+// negative duration if the queue is empty.
+func (c *EmulatedConn) dequeue(now time.Time) time.Duration {
+	rate := c.refill(now)
+	for len(c.queue) > 0 {
+		pkt := c.queue[0]
+		size := float64(len(pkt.data))
+		if rate > 0 && c.tokens < size {
+			return time.Duration((size - c.tokens) * 8 / float64(rate) * float64(time.Second))
+		}
+		if rate == 0 && c.profile.Trace != nil {
+			// A trace step with zero capacity stalls the link.
+			return time.Millisecond
+		}
+		if rate > 0 {
+			c.tokens -= size
+		}
+		c.queue = c.queue[1:]
+		c.queuedBytes -= len(pkt.data)
+
+		if c.profile.Loss != nil && c.profile.Loss.Drop(c.rand) {
+			continue
+		}
+		if c.profile.CEThreshold > 0 && c.ecn != NotECT && now.Sub(pkt.enqueued) > c.profile.CEThreshold {
+			pkt.ce = true
+		}
+		delay := c.profile.Delay
+		if c.profile.Jitter > 0 {
+			delay += time.Duration(c.rand.Int63n(int64(c.profile.Jitter)))
+		}
+		pkt.deliver = now.Add(delay)
+		if pkt.deliver.Before(c.lastDeliver) {
+			pkt.deliver = c.lastDeliver
+		}
+		c.lastDeliver = pkt.deliver
+		c.delayLine = append(c.delayLine, pkt)
+	}
+	return -1
+}
+
+// due removes the packets from the delay line which have to be sent at now
+// and returns them together with the time to wait for the next packet.
+func (c *EmulatedConn) due(now time.Time) ([]*emulatedPacket, time.Duration) {
+	i := 0
+	for ; i < len(c.delayLine); i++ {
+		if c.delayLine[i].deliver.After(now) {
+			break
+		}
+	}
+	pkts := c.delayLine[:i]
+	c.delayLine = c.delayLine[i:]
+	if len(c.delayLine) == 0 {
+		return pkts, -1
+	}
+	return pkts, c.delayLine[0].deliver.Sub(now)
+}
+
+func (c *EmulatedConn) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	closing := c.closing
+	for {
+		now := time.Now()
+		c.mu.Lock()
+		waitQueue := c.dequeue(now)
+		pkts, waitDelay := c.due(now)
+		c.mu.Unlock()
+
+		for _, pkt := range pkts {
+			if _, err := c.write(pkt); err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+			}
+		}
+
+		wait := waitQueue
+		if wait < 0 || (waitDelay >= 0 && waitDelay < wait) {
+			wait = waitDelay
+		}
+		if wait < 0 && c.isClosing() {
+			close(c.drained)
+			return
+		}
+		var timeout <-chan time.Time
+		if wait >= 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-c.wake:
+		case <-timeout:
+		case <-closing:
+			// Wake up once to check whether the link is already drained.
+			closing = nil
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write sends pkt on the wrapped connection. CE marks are only applied if
+// the wrapped connection is a UDP socket.
+func (c *EmulatedConn) write(pkt *emulatedPacket) (int, error) {
+	if conn, ok := c.PacketConn.(*net.UDPConn); ok && pkt.ce {
+		return writeECN(conn, pkt.data, pkt.addr, CE)
+	}
+	return c.PacketConn.WriteTo(pkt.data, pkt.addr)
+}
+
+func (c *EmulatedConn) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
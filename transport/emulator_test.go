@@ -0,0 +1,281 @@
+package transport
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBernoulliLoss(t *testing.T) {
+	const n = 10000
+	r := rand.New(rand.NewSource(1))
+	for _, p := range []float64{0, 0.3, 1} {
+		l := &BernoulliLoss{P: p}
+		dropped := 0
+		for i := 0; i < n; i++ {
+			if l.Drop(r) {
+				dropped++
+			}
+		}
+		if rate := float64(dropped) / n; rate < p-0.02 || rate > p+0.02 {
+			t.Errorf("P=%v dropped %v of packets", p, rate)
+		}
+	}
+}
+
+func TestGilbertElliottLoss(t *testing.T) {
+	const n = 100000
+	r := rand.New(rand.NewSource(1))
+
+	// All packets are dropped in the bad state and none in the good state,
+	// so that losses occur in bursts with a mean length of 1/R.
+	l := &GilbertElliottLoss{P: 0.01, R: 0.1, K: 1, H: 0}
+	dropped, bursts := 0, 0
+	last := false
+	for i := 0; i < n; i++ {
+		drop := l.Drop(r)
+		if drop {
+			dropped++
+			if !last {
+				bursts++
+			}
+		}
+		last = drop
+	}
+	want := l.P / (l.P + l.R)
+	if rate := float64(dropped) / n; rate < want-0.02 || rate > want+0.02 {
+		t.Errorf("dropped %v of packets, want %v", rate, want)
+	}
+	if mean := float64(dropped) / float64(bursts); mean < 8 || mean > 12 {
+		t.Errorf("mean burst length %v, want 10", mean)
+	}
+
+	l = &GilbertElliottLoss{P: 0.5, R: 0.5, K: 1, H: 1}
+	for i := 0; i < 1000; i++ {
+		if l.Drop(r) {
+			t.Fatal("dropped packet with K and H of 1")
+		}
+	}
+}
+
+func TestParseLossModel(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want LossModel
+	}{
+		{in: "0", want: &BernoulliLoss{P: 0}},
+		{in: "0.1", want: &BernoulliLoss{P: 0.1}},
+		{in: "ge:0.01,0.2,1,0.5", want: &GilbertElliottLoss{P: 0.01, R: 0.2, K: 1, H: 0.5}},
+		{in: "ge:0.01, 0.2, 1, 0.5", want: &GilbertElliottLoss{P: 0.01, R: 0.2, K: 1, H: 0.5}},
+	} {
+		got, err := ParseLossModel(tc.in)
+		if err != nil {
+			t.Errorf("failed to parse %q: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parsed %q as %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+	for _, in := range []string{"", "x", "-0.1", "1.5", "ge:", "ge:0.1,0.2,0.3", "ge:0.1,0.2,0.3,2", "ge:a,b,c,d"} {
+		if _, err := ParseLossModel(in); err == nil {
+			t.Errorf("parsed invalid loss model %q", in)
+		}
+	}
+}
+
+func TestParseCapacityTrace(t *testing.T) {
+	trace, err := ParseCapacityTrace(strings.NewReader(`# offset in ms, capacity in bps
+1000,2000000
+
+3000	500000
+500 1000000
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		offset time.Duration
+		rate   int
+	}{
+		// The first step is valid before its offset.
+		{0, 1_000_000},
+		{500 * time.Millisecond, 1_000_000},
+		{999 * time.Millisecond, 1_000_000},
+		{time.Second, 2_000_000},
+		{2999 * time.Millisecond, 2_000_000},
+		{3 * time.Second, 500_000},
+		// The last step is valid until the end.
+		{time.Hour, 500_000},
+	} {
+		if rate := trace.Rate(tc.offset); rate != tc.rate {
+			t.Errorf("rate at %v is %v, want %v", tc.offset, rate, tc.rate)
+		}
+	}
+
+	for _, in := range []string{"", "# comment only\n", "1000\n", "1000,1,2\n", "-1,1000\n", "1000,x\n", "0,-5\n"} {
+		if _, err := ParseCapacityTrace(strings.NewReader(in)); err == nil {
+			t.Errorf("parsed invalid capacity trace %q", in)
+		}
+	}
+}
+
+func TestRMCATVariableCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		offset time.Duration
+		rate   int
+	}{
+		{0, 1_000_000},
+		{39 * time.Second, 1_000_000},
+		{40 * time.Second, 2_500_000},
+		{60 * time.Second, 600_000},
+		{79 * time.Second, 600_000},
+		{100 * time.Second, 1_000_000},
+	} {
+		if rate := RMCATVariableCapacity.Rate(tc.offset); rate != tc.rate {
+			t.Errorf("rate at %v is %v, want %v", tc.offset, rate, tc.rate)
+		}
+	}
+}
+
+// newTestEmulatedConn returns an EmulatedConn without its loop, so that
+// tests can drive the link by calling dequeue with chosen times.
+func newTestEmulatedConn(profile *EmulationProfile, now time.Time) *EmulatedConn {
+	return &EmulatedConn{
+		profile:    profile,
+		rand:       rand.New(rand.NewSource(profile.Seed)),
+		start:      now,
+		tokens:     float64(profile.Burst),
+		lastRefill: now,
+	}
+}
+
+// enqueue adds n packets of size bytes to the queue of c as if they were
+// written at the given time.
+func enqueue(c *EmulatedConn, n, size int, at time.Time) {
+	for i := 0; i < n; i++ {
+		c.queue = append(c.queue, &emulatedPacket{data: make([]byte, size), enqueued: at})
+		c.queuedBytes += size
+	}
+}
+
+func TestEmulatedConnTokenBucket(t *testing.T) {
+	start := time.Now()
+	// 1000 bytes per second with a bucket of two packets.
+	c := newTestEmulatedConn(&EmulationProfile{Rate: 8000, Burst: 2000}, start)
+	enqueue(c, 5, 1000, start)
+
+	wait := c.dequeue(start)
+	if len(c.delayLine) != 2 {
+		t.Fatalf("%v packets passed a full bucket of two packets", len(c.delayLine))
+	}
+	if wait != time.Second {
+		t.Errorf("next packet passes after %v, want 1s", wait)
+	}
+	c.dequeue(start.Add(500 * time.Millisecond))
+	if len(c.delayLine) != 2 {
+		t.Errorf("%v packets passed before the next token was earned", len(c.delayLine))
+	}
+	c.dequeue(start.Add(time.Second))
+	if len(c.delayLine) != 3 {
+		t.Errorf("%v packets passed after one second, want 3", len(c.delayLine))
+	}
+	if c.queuedBytes != 2000 {
+		t.Errorf("%v bytes queued, want 2000", c.queuedBytes)
+	}
+
+	// The bucket does not fill beyond Burst while packets wait, so the
+	// remaining two packets empty it.
+	c.dequeue(start.Add(time.Hour))
+	if len(c.queue) != 0 {
+		t.Fatalf("%v packets left in the queue", len(c.queue))
+	}
+	if c.tokens != 0 {
+		t.Errorf("bucket holds %v tokens after two packets, want it capped at the burst of 2000", c.tokens)
+	}
+}
+
+func TestEmulatedConnQueueLimit(t *testing.T) {
+	start := time.Now()
+	c := newTestEmulatedConn(&EmulationProfile{Rate: 8000, QueueLimit: 2500}, start)
+	for i := 0; i < 3; i++ {
+		n, err := c.WriteTo(make([]byte, 1000), nil)
+		if err != nil || n != 1000 {
+			t.Fatalf("write returned %v, %v, want dropped packets to be reported as written", n, err)
+		}
+	}
+	if len(c.queue) != 2 || c.queuedBytes != 2000 {
+		t.Errorf("queued %v packets of %v bytes, want 2 packets within the limit", len(c.queue), c.queuedBytes)
+	}
+}
+
+func TestEmulatedConnCEMarking(t *testing.T) {
+	for _, ecn := range []ECN{NotECT, ECT1} {
+		start := time.Now()
+		c := newTestEmulatedConn(&EmulationProfile{Rate: 8000, Burst: 1000, CEThreshold: 100 * time.Millisecond}, start)
+		c.ecn = ecn
+		enqueue(c, 2, 1000, start)
+
+		c.dequeue(start)
+		c.dequeue(start.Add(time.Second))
+		if len(c.delayLine) != 2 {
+			t.Fatalf("%v packets passed, want 2", len(c.delayLine))
+		}
+		if c.delayLine[0].ce {
+			t.Errorf("marked packet which did not wait with %v", ecn)
+		}
+		if want := ecn != NotECT; c.delayLine[1].ce != want {
+			t.Errorf("marked packet which waited for 1s with %v: %v, want %v", ecn, c.delayLine[1].ce, want)
+		}
+	}
+}
+
+func TestEmulatedConnRate(t *testing.T) {
+	const (
+		rate    = 4_000_000
+		packets = 200
+		size    = 1000
+		// burst absorbs late wake ups of the emulator loop, which would
+		// otherwise lose the tokens earned while it oversleeps.
+		burst = 10
+	)
+	recv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer recv.Close()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := NewEmulatedConn(conn, &EmulationProfile{Rate: rate, Burst: burst * size})
+	defer send.Close()
+
+	for i := 0; i < packets; i++ {
+		if _, err := send.WriteTo(make([]byte, size), recv.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := recv.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2*size)
+	var first time.Time
+	for i := 0; i < packets; i++ {
+		if _, _, err := recv.ReadFrom(buf); err != nil {
+			t.Fatalf("received %v of %v packets: %v", i, packets, err)
+		}
+		if i == 0 {
+			first = time.Now()
+		}
+	}
+	// The first burst passes the full bucket, all other packets wait for
+	// their tokens.
+	received := float64(8*size*(packets-burst)) / time.Since(first).Seconds()
+	if received < 0.8*rate || received > 1.1*rate {
+		t.Errorf("received %v bps over a bottleneck of %v bps", received, rate)
+	}
+}
@@ -0,0 +1,173 @@
+package transport
+
+import "fmt"
+
+// KeyFrameFunc reports whether an RTP payload starts a key frame. It may
+// report more than one packet of the same key frame, like parameter sets
+// followed by the first fragment of the picture, which share the RTP
+// timestamp.
+type KeyFrameFunc func(payload []byte) bool
+
+// KeyFrameDetector returns the KeyFrameFunc for the given codec.
+func KeyFrameDetector(codec string) (KeyFrameFunc, error) {
+	switch codec {
+	case "h264":
+		return isH264KeyFrameStart, nil
+	case "vp8":
+		return isVP8KeyFrameStart, nil
+	case "vp9":
+		return isVP9KeyFrameStart, nil
+	case "h265":
+		return isH265KeyFrameStart, nil
+	case "av1":
+		return isAV1KeyFrameStart, nil
+	default:
+		return nil, fmt.Errorf("no key frame detector for codec %v", codec)
+	}
+}
+
+const (
+	h264NALUTypeIDR  = 5
+	h264NALUTypeSPS  = 7
+	h264NALUTypeSTAP = 24
+	h264NALUTypeFUA  = 28
+)
+
+// isH264KeyFrameStart detects IDR slices and SPS (RFC 6184) in single NAL
+// unit packets, STAP-A aggregates and the first fragment of FU-A packets.
+func isH264KeyFrameStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	switch naluType := payload[0] & 0x1F; naluType {
+	case h264NALUTypeIDR, h264NALUTypeSPS:
+		return true
+
+	case h264NALUTypeSTAP:
+		for offset := 1; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if t := payload[offset] & 0x1F; t == h264NALUTypeIDR || t == h264NALUTypeSPS {
+				return true
+			}
+			offset += size
+		}
+		return false
+
+	case h264NALUTypeFUA:
+		if len(payload) < 2 {
+			return false
+		}
+		start := payload[1]&0x80 != 0
+		return start && payload[1]&0x1F == h264NALUTypeIDR
+	}
+	return false
+}
+
+// isVP8KeyFrameStart parses the VP8 payload descriptor (RFC 7741) and checks
+// the inverse key frame flag of the first partition.
+func isVP8KeyFrameStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	start := payload[0]&0x10 != 0
+	partitionID := payload[0] & 0x0F
+	if !start || partitionID != 0 {
+		return false
+	}
+	offset := 1
+	if payload[0]&0x80 != 0 {
+		if len(payload) <= offset {
+			return false
+		}
+		ext := payload[offset]
+		offset++
+		if ext&0x80 != 0 {
+			if len(payload) <= offset {
+				return false
+			}
+			if payload[offset]&0x80 != 0 {
+				offset += 2
+			} else {
+				offset++
+			}
+		}
+		if ext&0x40 != 0 {
+			offset++
+		}
+		if ext&0x30 != 0 {
+			offset++
+		}
+	}
+	if len(payload) <= offset {
+		return false
+	}
+	return payload[offset]&0x01 == 0
+}
+
+// isVP9KeyFrameStart checks the inter-picture predicted and start of frame
+// flags of the VP9 payload descriptor.
+func isVP9KeyFrameStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	interPredicted := payload[0]&0x40 != 0
+	start := payload[0]&0x08 != 0
+	return !interPredicted && start
+}
+
+const (
+	h265NALUTypeIRAPMin = 16
+	h265NALUTypeIRAPMax = 21
+	h265NALUTypeVPS     = 32
+	h265NALUTypeSPS     = 33
+	h265NALUTypeAP      = 48
+	h265NALUTypeFU      = 49
+)
+
+// isH265KeyFrameNALU reports whether the NAL unit type belongs to an intra
+// random access point or a parameter set which precedes one.
+func isH265KeyFrameNALU(naluType byte) bool {
+	return naluType >= h265NALUTypeIRAPMin && naluType <= h265NALUTypeIRAPMax ||
+		naluType == h265NALUTypeVPS || naluType == h265NALUTypeSPS
+}
+
+// isH265KeyFrameStart detects IRAP pictures and VPS/SPS (RFC 7798) in single
+// NAL unit packets, aggregation packets without DONL fields and the first
+// fragment of fragmentation units.
+func isH265KeyFrameStart(payload []byte) bool {
+	if len(payload) < 2 {
+		return false
+	}
+	switch naluType := (payload[0] >> 1) & 0x3F; naluType {
+	case h265NALUTypeAP:
+		for offset := 2; offset+2 < len(payload); {
+			size := int(payload[offset])<<8 | int(payload[offset+1])
+			offset += 2
+			if isH265KeyFrameNALU((payload[offset] >> 1) & 0x3F) {
+				return true
+			}
+			offset += size
+		}
+		return false
+
+	case h265NALUTypeFU:
+		if len(payload) < 3 {
+			return false
+		}
+		start := payload[2]&0x80 != 0
+		return start && isH265KeyFrameNALU(payload[2]&0x3F)
+
+	default:
+		return isH265KeyFrameNALU(naluType)
+	}
+}
+
+// isAV1KeyFrameStart checks the N flag of the AV1 aggregation header, which
+// is set on the first packet of a coded video sequence.
+func isAV1KeyFrameStart(payload []byte) bool {
+	if len(payload) < 1 {
+		return false
+	}
+	return payload[0]&0x08 != 0
+}
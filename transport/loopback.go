@@ -0,0 +1,369 @@
+package transport
+
+import (
+	"container/heap"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// ErrLoopbackClosed is returned when writing to a closed loopback session.
+var ErrLoopbackClosed = errors.New("loopback session closed")
+
+// Loopback is one end of an in-memory session pair created by NewLoopback.
+// Packets written on one end are delivered to the flow with the same ID on
+// the other end after the configured link impairments were applied. It is
+// meant to run senders and receivers in a single process, e.g. in tests.
+type Loopback struct {
+	link *loopbackLink
+	peer *Loopback
+
+	flowsMu  sync.Mutex
+	flows    map[uint64]*packetQueue
+	flowsErr error
+
+	closeOnce sync.Once
+}
+
+// LoopbackOption can be used to configure the links of a loopback pair. All
+// options apply to both directions.
+type LoopbackOption func(*loopbackLink) error
+
+// LoopbackDelay sets the one-way delay of each packet.
+func LoopbackDelay(delay time.Duration) LoopbackOption {
+	return func(l *loopbackLink) error {
+		l.delay = delay
+		return nil
+	}
+}
+
+// LoopbackLoss drops each packet with probability p.
+func LoopbackLoss(p float64) LoopbackOption {
+	return func(l *loopbackLink) error {
+		if p < 0 || p > 1 {
+			return errors.New("loss probability must be in [0, 1]")
+		}
+		l.loss = p
+		return nil
+	}
+}
+
+// LoopbackReorder holds back each packet with probability p for an
+// additional delay d, so that packets sent later can overtake it.
+func LoopbackReorder(p float64, d time.Duration) LoopbackOption {
+	return func(l *loopbackLink) error {
+		if p < 0 || p > 1 {
+			return errors.New("reorder probability must be in [0, 1]")
+		}
+		l.reorder = p
+		l.reorderDelay = d
+		return nil
+	}
+}
+
+// LoopbackSeed seeds the random source used to decide on losses and
+// reordering, which makes these decisions reproducible.
+func LoopbackSeed(seed int64) LoopbackOption {
+	return func(l *loopbackLink) error {
+		l.rand = rand.New(rand.NewSource(seed))
+		return nil
+	}
+}
+
+// LoopbackControlHandler sets the handler which is called for the control
+// messages received by either end of the pair.
+func LoopbackControlHandler(handler func(Session, *ControlMessage)) LoopbackOption {
+	return func(l *loopbackLink) error {
+		l.controlHandler = handler
+		return nil
+	}
+}
+
+// NewLoopback returns two connected in-memory sessions.
+func NewLoopback(opts ...LoopbackOption) (*Loopback, *Loopback, error) {
+	a := &Loopback{flows: map[uint64]*packetQueue{}}
+	b := &Loopback{flows: map[uint64]*packetQueue{}}
+	a.peer, b.peer = b, a
+
+	var err error
+	if a.link, err = newLoopbackLink(b, 0, opts...); err != nil {
+		return nil, nil, err
+	}
+	if b.link, err = newLoopbackLink(a, 1, opts...); err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+func (l *Loopback) flow(id uint64) *packetQueue {
+	l.flowsMu.Lock()
+	defer l.flowsMu.Unlock()
+
+	f, ok := l.flows[id]
+	if !ok {
+		f = newPacketQueue()
+		l.flows[id] = f
+		if l.flowsErr != nil {
+			f.closeWithError(l.flowsErr)
+		}
+	}
+	return f
+}
+
+func (l *Loopback) Writer(id uint64) (WriteFlow, error) {
+	return &LoopbackWriteFlow{id: id, link: l.link}, nil
+}
+
+func (l *Loopback) Reader(id uint64) (ReadFlow, error) {
+	return l.flow(id), nil
+}
+
+func (l *Loopback) Capabilities() Capability {
+	return Acks | Flows
+}
+
+// MaxPacketSize returns DefaultMTU, loopback sessions do not limit the size
+// of packets.
+func (l *Loopback) MaxPacketSize() int {
+	return DefaultMTU
+}
+
+// SendControl delivers m to the peer immediately, control messages are not
+// subject to the link impairments. Terminal messages stop both directions of
+// the pair.
+func (l *Loopback) SendControl(m *ControlMessage) error {
+	if l.isShutdown() {
+		return ErrLoopbackClosed
+	}
+	if h := l.link.controlHandler; h != nil {
+		h(l.peer, m)
+	}
+	if !m.terminal() {
+		return nil
+	}
+	l.shutdown(m.localErr())
+	l.peer.shutdown(m.err())
+	return nil
+}
+
+// Close stops both directions of the pair by sending a ControlEOS message.
+// Packets which are still in flight are discarded and readers return
+// ErrSessionClosed on this end and ErrEndOfStream on the peer once they
+// consumed all packets delivered before.
+func (l *Loopback) Close() error {
+	if l.isShutdown() {
+		return nil
+	}
+	return l.SendControl(&ControlMessage{Type: ControlEOS})
+}
+
+func (l *Loopback) isShutdown() bool {
+	l.flowsMu.Lock()
+	defer l.flowsMu.Unlock()
+	return l.flowsErr != nil
+}
+
+func (l *Loopback) shutdown(err error) {
+	l.closeOnce.Do(func() {
+		l.link.close()
+		l.flowsMu.Lock()
+		defer l.flowsMu.Unlock()
+		l.flowsErr = err
+		for _, f := range l.flows {
+			f.closeWithError(err)
+		}
+	})
+}
+
+// LoopbackWriteFlow writes packets to a flow of the peer of a Loopback.
+type LoopbackWriteFlow struct {
+	id   uint64
+	link *loopbackLink
+}
+
+func (w *LoopbackWriteFlow) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	return w.WriteRTPNotify(header, payload, nil)
+}
+
+func (w *LoopbackWriteFlow) WriteRTPNotify(header *rtp.Header, payload []byte, notify func(bool)) (int, error) {
+	headerBuf, err := header.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	buf := append(headerBuf, payload...)
+	return len(buf), w.link.send(w.id, buf, notify)
+}
+
+func (w *LoopbackWriteFlow) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	buf, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return 0, err
+	}
+	return len(buf), w.link.send(w.id, buf, nil)
+}
+
+func (w *LoopbackWriteFlow) Close() error {
+	return nil
+}
+
+type loopbackPacket struct {
+	flowID  uint64
+	data    []byte
+	notify  func(bool)
+	lost    bool
+	deliver time.Time
+	seq     uint64
+}
+
+type loopbackQueue []*loopbackPacket
+
+func (q loopbackQueue) Len() int { return len(q) }
+
+func (q loopbackQueue) Less(i, j int) bool {
+	if q[i].deliver.Equal(q[j].deliver) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].deliver.Before(q[j].deliver)
+}
+
+func (q loopbackQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *loopbackQueue) Push(x interface{}) { *q = append(*q, x.(*loopbackPacket)) }
+
+func (q *loopbackQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	p := old[n-1]
+	*q = old[:n-1]
+	return p
+}
+
+// loopbackLink carries packets in one direction of a loopback pair. A single
+// goroutine delivers packets in order of their delivery time, so that
+// packets with equal delivery times keep the order in which they were sent.
+type loopbackLink struct {
+	dst *Loopback
+
+	controlHandler func(Session, *ControlMessage)
+
+	delay        time.Duration
+	loss         float64
+	reorder      float64
+	reorderDelay time.Duration
+	rand         *rand.Rand
+
+	mu     sync.Mutex
+	queue  loopbackQueue
+	seq    uint64
+	closed bool
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func newLoopbackLink(dst *Loopback, seed int64, opts ...LoopbackOption) (*loopbackLink, error) {
+	l := &loopbackLink{
+		dst:  dst,
+		rand: rand.New(rand.NewSource(seed)),
+		wake: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		if err := opt(l); err != nil {
+			return nil, err
+		}
+	}
+	go l.loop()
+	return l, nil
+}
+
+func (l *loopbackLink) send(flowID uint64, data []byte, notify func(bool)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return ErrLoopbackClosed
+	}
+
+	delay := l.delay
+	if l.reorder > 0 && l.rand.Float64() < l.reorder {
+		delay += l.reorderDelay
+	}
+	heap.Push(&l.queue, &loopbackPacket{
+		flowID:  flowID,
+		data:    data,
+		notify:  notify,
+		lost:    l.loss > 0 && l.rand.Float64() < l.loss,
+		deliver: time.Now().Add(delay),
+		seq:     l.seq,
+	})
+	l.seq++
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (l *loopbackLink) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+}
+
+func (l *loopbackLink) next() (*loopbackPacket, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.queue) == 0 {
+		return nil, -1
+	}
+	if wait := time.Until(l.queue[0].deliver); wait > 0 {
+		return nil, wait
+	}
+	return heap.Pop(&l.queue).(*loopbackPacket), 0
+}
+
+func (l *loopbackLink) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		pkt, wait := l.next()
+		if pkt != nil {
+			if !pkt.lost {
+				l.dst.flow(pkt.flowID).push(pkt.data)
+			}
+			if pkt.notify != nil {
+				pkt.notify(!pkt.lost)
+			}
+			continue
+		}
+
+		var timeout <-chan time.Time
+		if wait > 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+			timeout = timer.C
+		}
+		select {
+		case <-l.wake:
+		case <-timeout:
+		case <-l.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+// writeSequence writes n packets with sequence numbers 0 to n-1 to flow 0
+// of l and returns the sequence numbers of the packets which were lost once
+// all of them were delivered.
+func writeSequence(t *testing.T, l *Loopback, n int) []uint16 {
+	t.Helper()
+	w, _ := l.Writer(0)
+	var mu sync.Mutex
+	var lost []uint16
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		seq := uint16(i)
+		header := &rtp.Header{Version: 2, SequenceNumber: seq}
+		_, err := w.(*LoopbackWriteFlow).WriteRTPNotify(header, []byte{0}, func(received bool) {
+			if !received {
+				mu.Lock()
+				lost = append(lost, seq)
+				mu.Unlock()
+			}
+			wg.Done()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	return lost
+}
+
+// readSequence reads n packets from flow 0 of l and returns their sequence
+// numbers.
+func readSequence(t *testing.T, l *Loopback, n int) []uint16 {
+	t.Helper()
+	r, _ := l.Reader(0)
+	buf := make([]byte, DefaultMTU)
+	seqs := make([]uint16, 0, n)
+	for i := 0; i < n; i++ {
+		k, err := r.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pkt rtp.Packet
+		if err := pkt.Unmarshal(buf[:k]); err != nil {
+			t.Fatal(err)
+		}
+		seqs = append(seqs, pkt.SequenceNumber)
+	}
+	return seqs
+}
+
+func newTestLoopback(t *testing.T, opts ...LoopbackOption) (*Loopback, *Loopback) {
+	t.Helper()
+	a, b, err := NewLoopback(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a, b
+}
+
+func TestLoopbackDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	a, b := newTestLoopback(t, LoopbackDelay(delay))
+
+	start := time.Now()
+	if lost := writeSequence(t, a, 100); len(lost) > 0 {
+		t.Fatalf("lost %v without loss", lost)
+	}
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("packets delivered after %v, want at least %v", elapsed, delay)
+	}
+	for i, seq := range readSequence(t, b, 100) {
+		if seq != uint16(i) {
+			t.Fatalf("received packet %v at position %v without reordering", seq, i)
+		}
+	}
+}
+
+func TestLoopbackLoss(t *testing.T) {
+	const n = 1000
+	run := func() []uint16 {
+		a, b := newTestLoopback(t, LoopbackLoss(0.2), LoopbackSeed(3))
+		lost := writeSequence(t, a, n)
+		readSequence(t, b, n-len(lost))
+		return lost
+	}
+
+	lost := run()
+	if len(lost) < 150 || len(lost) > 250 {
+		t.Errorf("lost %v of %v packets, want about 20%%", len(lost), n)
+	}
+	if again := run(); !reflect.DeepEqual(lost, again) {
+		t.Errorf("lost different packets with the same seed")
+	}
+}
+
+func TestLoopbackReorder(t *testing.T) {
+	const n = 200
+	a, b := newTestLoopback(t, LoopbackReorder(0.1, 20*time.Millisecond))
+	writeSequence(t, a, n)
+
+	seen := make(map[uint16]bool, n)
+	reordered := 0
+	for i, seq := range readSequence(t, b, n) {
+		if seen[seq] {
+			t.Fatalf("received packet %v twice", seq)
+		}
+		seen[seq] = true
+		if seq != uint16(i) {
+			reordered++
+		}
+	}
+	if reordered == 0 {
+		t.Error("received all packets in order")
+	}
+}
+
+func TestLoopbackOptionErrors(t *testing.T) {
+	for _, opt := range []LoopbackOption{LoopbackLoss(-0.1), LoopbackLoss(1.1), LoopbackReorder(2, time.Millisecond)} {
+		if _, _, err := NewLoopback(opt); err == nil {
+			t.Error("NewLoopback accepted a probability outside of [0, 1]")
+		}
+	}
+}
+
+func TestLoopbackClose(t *testing.T) {
+	var received []ControlType
+	a, b := newTestLoopback(t, LoopbackControlHandler(func(_ Session, m *ControlMessage) {
+		received = append(received, m.Type)
+	}))
+	writeSequence(t, a, 1)
+
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(received, []ControlType{ControlEOS}) {
+		t.Errorf("peer received control messages %v, want EOS", received)
+	}
+	w, _ := a.Writer(0)
+	if _, err := w.WriteRTP(&rtp.Header{Version: 2}, nil); !errors.Is(err, ErrLoopbackClosed) {
+		t.Errorf("write after close returned %v, want %v", err, ErrLoopbackClosed)
+	}
+
+	// Packets delivered before the close can still be read.
+	readSequence(t, b, 1)
+	buf := make([]byte, DefaultMTU)
+	rb, _ := b.Reader(0)
+	if _, err := rb.Read(buf); !errors.Is(err, ErrEndOfStream) {
+		t.Errorf("peer read returned %v, want %v", err, ErrEndOfStream)
+	}
+	ra, _ := a.Reader(0)
+	if _, err := ra.Read(buf); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("local read returned %v, want %v", err, ErrSessionClosed)
+	}
+}
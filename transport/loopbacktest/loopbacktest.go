@@ -0,0 +1,111 @@
+// Package loopbacktest provides utilities to run senders and receivers over
+// a transport.Loopback pair in tests.
+package loopbacktest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mengelbart/rtq-go-endpoint/transport"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// FrameInterval is the interval at which SendMedia sends frames.
+const FrameInterval = 10 * time.Millisecond
+
+// Link is a loopback pair together with the goroutines reading from it.
+type Link struct {
+	A, B *transport.Loopback
+
+	wg sync.WaitGroup
+}
+
+// New returns a Link connected by a loopback pair created with opts. The
+// test fails if the pair cannot be created.
+func New(t testing.TB, opts ...transport.LoopbackOption) *Link {
+	t.Helper()
+	a, b, err := transport.NewLoopback(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Link{A: a, B: b}
+}
+
+// Go calls read in a new goroutine until it returns an error.
+func (l *Link) Go(read func() error) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		for read() == nil {
+		}
+	}()
+}
+
+// Drain discards all packets read from f until reading fails.
+func (l *Link) Drain(f transport.ReadFlow) {
+	buf := make([]byte, transport.DefaultMTU)
+	l.Go(func() error {
+		_, err := f.Read(buf)
+		return err
+	})
+}
+
+// Close closes the loopback pair and waits for the goroutines started by Go
+// to return. Goroutines which do not read from the pair must be stopped
+// before.
+func (l *Link) Close() {
+	l.A.Close()
+	l.wg.Wait()
+}
+
+// FlowReader returns a function which reads from f and can be used as an
+// interceptor.RTPReaderFunc or interceptor.RTCPReaderFunc.
+func FlowReader(f transport.ReadFlow) func([]byte, interceptor.Attributes) (int, interceptor.Attributes, error) {
+	return func(buf []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, err := f.Read(buf)
+		return n, a, err
+	}
+}
+
+// BitrateController is implemented by the sender interceptors of the
+// congestion controllers.
+type BitrateController interface {
+	GetTargetBitrate(ssrc uint32) (float64, error)
+}
+
+// SendMedia writes a frame to w every FrameInterval for the given duration.
+// Like an encoder would, each frame is as large as the target bitrate of c
+// allows and consists of packets with packetSize bytes of payload.
+func SendMedia(t testing.TB, w interceptor.RTPWriter, c BitrateController, ssrc uint32, packetSize int, duration time.Duration) {
+	t.Helper()
+	ticker := time.NewTicker(FrameInterval)
+	defer ticker.Stop()
+
+	seq := uint16(0)
+	budget := 0.0
+	for end := time.Now().Add(duration); time.Now().Before(end); <-ticker.C {
+		bitrate, err := c.GetTargetBitrate(ssrc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		budget += bitrate / 8 * FrameInterval.Seconds()
+		packets := int(budget / float64(packetSize))
+		budget -= float64(packets * packetSize)
+		for i := 0; i < packets; i++ {
+			header := &rtp.Header{
+				Version:        2,
+				PayloadType:    96,
+				SequenceNumber: seq,
+				Timestamp:      uint32(seq),
+				SSRC:           ssrc,
+				Marker:         i == packets-1,
+			}
+			if _, err := w.Write(header, make([]byte, packetSize), nil); err != nil {
+				t.Fatal(err)
+			}
+			seq++
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// DefaultMTU is the packet size used by UDP and TCP sessions if no MTU is
+// configured. Like the minimum QUIC packet size, it is assumed to fit on
+// any path.
+const DefaultMTU = 1200
+
+const (
+	// The fork of quic-go always announces a max_datagram_frame_size of
+	// 1220 bytes and does not export the value negotiated with the peer.
+	quicMaxDatagramFrameSize = 1220
+	// quic-go sends packets of at most 1252 bytes on IPv4 and 1232 bytes on
+	// IPv6 paths until its own path MTU discovery found larger sizes.
+	quicPacketSizeIPv4 = 1252
+	quicPacketSizeIPv6 = 1232
+	// quicPacketOverhead is the size of a short header with the default 4
+	// byte connection ID and the longest packet number, plus the AEAD tag.
+	quicPacketOverhead = 1 + 4 + 4 + 16
+	// quicFlowIDLen is the length of flow IDs below 64.
+	quicFlowIDLen = 1
+
+	// udpMaxPacketSizeIPv4 and udpMaxPacketSizeIPv6 are the largest UDP
+	// payloads on Ethernet, used as upper bound for probing if no MTU is
+	// configured.
+	udpMaxPacketSizeIPv4 = 1500 - 20 - 8
+	udpMaxPacketSizeIPv6 = 1500 - 40 - 8
+
+	// udpMaxProbes is the number of probes sent for each size before the
+	// size is considered too large.
+	udpMaxProbes = 3
+	// udpProbeTimeout is the time to wait for the acknowledgement of a
+	// probe.
+	udpProbeTimeout = 250 * time.Millisecond
+)
+
+// MTU sets the largest packet sent by UDP and TCP sessions and the size of
+// their read buffers. QUIC sessions use the smaller of mtu and the largest
+// datagram accepted by the peer.
+func MTU(mtu int) Option {
+	return func(c *Config) error {
+		if mtu < DefaultMTU {
+			return fmt.Errorf("MTU must be at least %v bytes, got %v", DefaultMTU, mtu)
+		}
+		c.MTU = mtu
+		return nil
+	}
+}
+
+// ProbeMTU makes UDP clients search the largest packet size between
+// DefaultMTU and the configured MTU which reaches the peer when the session
+// is established, similar to DPLPMTUD (RFC 8899).
+func ProbeMTU() Option {
+	return func(c *Config) error {
+		c.ProbeMTU = true
+		return nil
+	}
+}
+
+// mtu returns the configured MTU or def if none is configured.
+func (c *Config) mtu(def int) int {
+	if c.MTU == 0 {
+		return def
+	}
+	return c.MTU
+}
+
+// quicMaxPacketSize returns the largest RTP packet which fits into a single
+// datagram of a QUIC session with the peer at addr.
+func quicMaxPacketSize(addr net.Addr) int {
+	packetSize := quicPacketSizeIPv4
+	if a, ok := addr.(*net.UDPAddr); ok && a.IP.To4() == nil {
+		packetSize = quicPacketSizeIPv6
+	}
+	frameSize := quicMaxDatagramFrameSize
+	if packetSize-quicPacketOverhead < frameSize {
+		frameSize = packetSize - quicPacketOverhead
+	}
+	// A datagram frame starts with its type and the length of the data,
+	// the data starts with the flow ID.
+	return frameSize - 1 - int(quicvarint.Len(uint64(frameSize))) - quicFlowIDLen
+}
+
+// udpMaxPacketSize returns the upper bound for probing the path to addr.
+func udpMaxPacketSize(addr *net.UDPAddr) int {
+	if addr.IP.To4() == nil {
+		return udpMaxPacketSizeIPv6
+	}
+	return udpMaxPacketSizeIPv4
+}
+
+// probeMTU searches the largest packet size between DefaultMTU and max which
+// reaches the peer by a binary search. Each size is probed up to
+// udpMaxProbes times with a padded ControlProbe packet, which the peer
+// acknowledges. Probes are sent with the don't fragment bit set. Packets
+// other than acknowledgements received while probing are dropped, control
+// messages are handled as usual.
+func (u *UDP) probeMTU(max int) (int, error) {
+	conn, ok := udpConn(u.PacketConn)
+	if !ok {
+		return 0, errors.New("probing requires a UDP socket")
+	}
+	if err := setDontFragment(conn); err != nil {
+		return 0, fmt.Errorf("failed to set don't fragment: %w", err)
+	}
+	defer u.PacketConn.SetReadDeadline(time.Time{})
+
+	buf := make([]byte, max+1)
+	lo, hi := DefaultMTU, max
+	for lo < hi {
+		size := (lo + hi + 1) / 2
+		ok, err := u.probe(size, buf)
+		if err != nil {
+			return lo, err
+		}
+		log.Printf("mtu probe of %v bytes acknowledged: %v", size, ok)
+		if ok {
+			lo = size
+		} else {
+			hi = size - 1
+		}
+	}
+	return lo, nil
+}
+
+// probe reports whether a probe of size bytes was acknowledged. If SRTP is
+// enabled, probes may be slightly larger than size, see marshalControl.
+// Each probe is marshaled again, since the peer drops replayed SRTCP
+// packets.
+func (u *UDP) probe(size int, buf []byte) (bool, error) {
+	for i := 0; i < udpMaxProbes; i++ {
+		packet, err := u.marshalControl(&ControlMessage{Type: ControlProbe}, size)
+		if err != nil {
+			return false, err
+		}
+		if _, err := u.writeToPeer(packet); err != nil {
+			if errors.Is(err, syscall.EMSGSIZE) {
+				return false, nil
+			}
+			return false, err
+		}
+		deadline := time.Now().Add(udpProbeTimeout)
+		if err := u.PacketConn.SetReadDeadline(deadline); err != nil {
+			return false, err
+		}
+		for {
+			n, _, err := u.PacketConn.ReadFrom(buf)
+			if err != nil {
+				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+					break
+				}
+				return false, err
+			}
+			if n > len(buf)-1 {
+				continue
+			}
+			_, m, err := u.openPacket(buf[:n])
+			if err != nil || m == nil {
+				continue
+			}
+			if m.Type == ControlProbeAck {
+				if m.Size == len(packet) {
+					return true, nil
+				}
+				continue
+			}
+			if m.Type == ControlMetadataAck {
+				u.ackMetadata()
+				continue
+			}
+			u.config.handleControl(u, m)
+			if m.terminal() {
+				u.end(m.err(), false)
+				return false, m.err()
+			}
+		}
+	}
+	return false, nil
+}
+
+// ackProbe acknowledges a probe of size bytes received from addr.
+func (u *UDP) ackProbe(size int, addr net.Addr) {
+	buf, err := u.marshalControl(&ControlMessage{Type: ControlProbeAck, Size: size}, 0)
+	if err != nil {
+		log.Printf("failed to marshal probe ack: %v", err)
+		return
+	}
+	if _, err := u.WriteTo(buf, addr); err != nil {
+		log.Printf("failed to send probe ack: %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"errors"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// setDontFragment sets the don't fragment bit on packets sent on conn and
+// makes the kernel ignore its path MTU estimate, so that probes larger than
+// the path MTU are dropped instead of fragmented. Like setupECN, both IPv4
+// and IPv6 options are set.
+func setDontFragment(conn *net.UDPConn) error {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var err4, err6 error
+	if err := rawConn.Control(func(fd uintptr) {
+		err4 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+		err6 = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_PROBE)
+	}); err != nil {
+		return err
+	}
+	if err4 != nil && err6 != nil {
+		return errors.New("failed to set don't fragment for both IPv4 and IPv6")
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+)
+
+func setDontFragment(conn *net.UDPConn) error {
+	return errors.New("not supported on this platform")
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"io"
+	"sync"
+)
+
+const packetQueueSize = 1000
+
+// packetQueue buffers packets for a ReadFlow. Each Read returns exactly one
+// packet. Packets which do not fit into the buffer passed to Read are
+// dropped and io.ErrShortBuffer is returned. Once the queue is closed, Read
+// returns io.EOF or the error passed to closeWithError after all buffered
+// packets were consumed.
+type packetQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	packets [][]byte
+	closed  bool
+	err     error
+}
+
+func newPacketQueue() *packetQueue {
+	f := &packetQueue{}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *packetQueue) push(buf []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed || len(f.packets) >= packetQueueSize {
+		// Silently drop data when the buffer is full.
+		return
+	}
+	f.packets = append(f.packets, buf)
+	f.cond.Signal()
+}
+
+func (f *packetQueue) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(f.packets) == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if len(f.packets) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		return 0, io.EOF
+	}
+	buf := f.packets[0]
+	f.packets = f.packets[1:]
+	if len(p) < len(buf) {
+		return 0, io.ErrShortBuffer
+	}
+	return copy(p, buf), nil
+}
+
+func (f *packetQueue) Close() error {
+	f.closeWithError(nil)
+	return nil
+}
+
+// closeWithError closes the queue. Only the error of the first call is kept.
+func (f *packetQueue) closeWithError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	f.err = err
+	f.cond.Broadcast()
+}
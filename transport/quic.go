@@ -2,66 +2,194 @@ package transport
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/tls"
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
-	"math/big"
+	"log"
+	"net"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/qlog"
-	"github.com/mengelbart/rtq-go"
 	"github.com/mengelbart/rtq-go-endpoint/internal/utils"
 	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
 )
 
+func init() {
+	Register("quic", func(addr string, opts ...Option) (Session, error) {
+		return NewQUICClient(addr, opts...)
+	}, func(addr string, opts ...Option) (Session, error) {
+		return NewQUICServer(addr, opts...)
+	})
+	RegisterListener("quic", func(addr string, opts ...Option) (Listener, error) {
+		return NewQUICListener(addr, opts...)
+	})
+}
+
 type QUIC struct {
-	rtqSession  *rtq.Session
 	quicSession quic.Session
+
+	// conn is the packet conn the session runs on if it was created by us
+	// instead of quic-go, nil otherwise.
+	conn net.PacketConn
+	// listener accepted the session if it was created for this session only
+	// by NewQUICServer, nil otherwise.
+	listener *QUICListener
+
+	config *Config
+	// legacy is set if the peer negotiated the legacy RTQ framing.
+	legacy bool
+
+	flowsMu     sync.Mutex
+	flows       map[uint64]*packetQueue
+	flowsClosed bool
+	flowsErr    error
+
+	controlMu    sync.Mutex
+	control      quic.Stream
+	controlReady chan struct{}
+
+	acceptStreamsOnce sync.Once
 }
 
-func NewQUICServer(addr string) (*QUIC, error) {
-	quicConf := &quic.Config{
-		EnableDatagrams: true,
-	}
-	qlogWriter, err := utils.GetQLOGWriter()
+// NewQUICServer accepts a single session on addr.
+func NewQUICServer(addr string, opts ...Option) (*QUIC, error) {
+	l, err := NewQUICListener(addr, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("could not get qlog writer: %w", err)
+		return nil, err
 	}
-	if qlogWriter != nil {
-		quicConf.Tracer = qlog.NewTracer(qlogWriter)
+	q, err := l.accept(context.Background())
+	if err != nil {
+		l.Close()
+		return nil, err
 	}
+	// The session owns the listener and its socket, which stay open until
+	// the session is closed, since closing the listener closes the session.
+	q.listener = l
+	return q, nil
+}
+
+// QUICListener accepts QUIC sessions from any number of clients on the same
+// address.
+type QUICListener struct {
+	listener quic.Listener
+	// conn is the packet conn the listener runs on if it was created by us
+	// instead of quic-go, nil otherwise.
+	conn   net.PacketConn
+	config *Config
+}
 
-	listener, err := quic.ListenAddr(addr, generateTLSConfig(), quicConf)
+func NewQUICListener(addr string, opts ...Option) (*QUICListener, error) {
+	config, err := newConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
-	quicSession, err := listener.Accept(context.Background())
+	quicConf, err := config.quicConfig()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.serverTLSConfig()
 	if err != nil {
 		return nil, err
 	}
 
-	rtqSession, err := rtq.NewSession(quicSession)
+	var conn net.PacketConn
+	var listener quic.Listener
+	if config.Emulation != nil {
+		a, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = config.listenPacket(a)
+		if err != nil {
+			return nil, err
+		}
+		listener, err = quic.Listen(conn, tlsConfig, quicConf)
+	} else {
+		listener, err = quic.ListenAddr(addr, tlsConfig, quicConf)
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &QUIC{
-		rtqSession:  rtqSession,
-		quicSession: quicSession,
+	return &QUICListener{
+		listener: listener,
+		conn:     conn,
+		config:   config,
 	}, nil
 }
 
-func NewQUICClient(addr string, t ...logging.Tracer) (*QUIC, error) {
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-		NextProtos:         []string{"rtq"},
+func (l *QUICListener) accept(ctx context.Context) (*QUIC, error) {
+	quicSession, err := l.listener.Accept(ctx)
+	if err != nil {
+		return nil, err
 	}
+	return newQUIC(quicSession, nil, l.config, false), nil
+}
+
+func (l *QUICListener) Accept(ctx context.Context) (Session, error) {
+	q, err := l.accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Addr returns the local address of the listener.
+func (l *QUICListener) Addr() net.Addr {
+	return l.listener.Addr()
+}
+
+// Close stops accepting sessions and closes all sessions accepted by the
+// listener.
+func (l *QUICListener) Close() error {
+	err := l.listener.Close()
+	if l.conn != nil {
+		if cerr := l.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func NewQUICClient(addr string, opts ...Option) (*QUIC, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := config.clientTLSConfig()
+	quicConf, err := config.quicConfig()
+	if err != nil {
+		return nil, err
+	}
+	var conn net.PacketConn
+	var quicSession quic.Session
+	if config.Emulation != nil {
+		a, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+		conn, err = config.listenPacket(nil)
+		if err != nil {
+			return nil, err
+		}
+		quicSession, err = quic.Dial(conn, a, addr, tlsConfig, quicConf)
+	} else {
+		quicSession, err = quic.DialAddr(addr, tlsConfig, quicConf)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newQUIC(quicSession, conn, config, true), nil
+}
+
+// quicConfig returns the quic-go config shared by clients and servers.
+func (c *Config) quicConfig() (*quic.Config, error) {
 	quicConf := &quic.Config{
 		EnableDatagrams: true,
 	}
+	if err := c.QUIC.apply(quicConf); err != nil {
+		return nil, err
+	}
 	qlogWriter, err := utils.GetQLOGWriter()
 	if err != nil {
 		return nil, fmt.Errorf("could not get qlog writer: %w", err)
@@ -70,29 +198,64 @@ func NewQUICClient(addr string, t ...logging.Tracer) (*QUIC, error) {
 	if qlogWriter != nil {
 		tracers = append(tracers, qlog.NewTracer(qlogWriter))
 	}
-	if len(t) > 0 {
-		tracers = append(tracers, t...)
-	}
+	tracers = append(tracers, c.Tracers...)
 	if len(tracers) > 0 {
 		quicConf.Tracer = logging.NewMultiplexedTracer(tracers...)
 	}
-	quicSession, err := quic.DialAddr(addr, tlsConfig, quicConf)
-	if err != nil {
-		return nil, err
+	return quicConf, nil
+}
+
+func newQUIC(quicSession quic.Session, conn net.PacketConn, config *Config, dialer bool) *QUIC {
+	q := &QUIC{
+		quicSession:  quicSession,
+		conn:         conn,
+		config:       config,
+		legacy:       quicSession.ConnectionState().TLS.NegotiatedProtocol == LegacyALPN,
+		flows:        map[uint64]*packetQueue{},
+		controlReady: make(chan struct{}),
 	}
-	rtqSession, err := rtq.NewSession(quicSession)
-	if err != nil {
-		return nil, err
+	if q.legacy {
+		log.Printf("peer negotiated legacy RTQ framing")
 	}
-	return &QUIC{
-		rtqSession:  rtqSession,
-		quicSession: quicSession,
-	}, nil
+	go q.receiveDatagrams()
+	switch {
+	case q.legacy:
+	case dialer:
+		go q.openControl()
+	default:
+		go q.acceptControl()
+	}
+	return q
+}
+
+// Framing returns the ALPN of the RTP over QUIC framing used by the session.
+func (q *QUIC) Framing() string {
+	if q.legacy {
+		return LegacyALPN
+	}
+	return ALPN
 }
 
 type WriteFlowCloser struct {
 	*QUIC
-	*rtq.WriteFlow
+	flowID uint64
+}
+
+func (q *WriteFlowCloser) Write(buf []byte) (int, error) {
+	return len(buf), q.sendDatagram(q.flowID, buf, nil)
+}
+
+func (q *WriteFlowCloser) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	return q.WriteRTPNotify(header, payload, nil)
+}
+
+func (q *WriteFlowCloser) WriteRTPNotify(header *rtp.Header, payload []byte, notify func(bool)) (int, error) {
+	headerBuf, err := header.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	buf := append(headerBuf, payload...)
+	return len(buf), q.sendDatagram(q.flowID, buf, notify)
 }
 
 func (q *WriteFlowCloser) WriteRTCP(pkts []rtcp.Packet) (int, error) {
@@ -100,38 +263,79 @@ func (q *WriteFlowCloser) WriteRTCP(pkts []rtcp.Packet) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return q.Write(buf)
+	return len(buf), q.sendDatagram(q.rtcpFlowID(q.flowID), buf, nil)
 }
 
-func (q *QUIC) Writer(id uint64) (*WriteFlowCloser, error) {
-	f, err := q.rtqSession.OpenWriteFlow(id)
-	if err != nil {
-		return nil, err
+func (q *QUIC) Writer(id uint64) (WriteFlow, error) {
+	if q.config.StreamMapping != DatagramMapping {
+		return q.streamWriter(id)
 	}
 	return &WriteFlowCloser{
-		QUIC:      q,
-		WriteFlow: f,
+		QUIC:   q,
+		flowID: id,
 	}, nil
 }
 
+// ReadFlowCloser reads the RTP and RTCP packets of a flow.
 type ReadFlowCloser struct {
 	*QUIC
-	*rtq.ReadFlow
+	queue *packetQueue
 }
 
-func (q *QUIC) Reader(id uint64) (*ReadFlowCloser, error) {
-	f, err := q.rtqSession.AcceptFlow(id)
-	if err != nil {
-		return nil, err
+func (r *ReadFlowCloser) Read(p []byte) (int, error) {
+	return r.queue.Read(p)
+}
+
+func (r *ReadFlowCloser) Close() error {
+	return r.QUIC.Close()
+}
+
+func (q *QUIC) Reader(id uint64) (ReadFlow, error) {
+	if q.config.StreamMapping != DatagramMapping {
+		q.acceptStreamsOnce.Do(func() {
+			go q.acceptStreams()
+		})
 	}
 	return &ReadFlowCloser{
-		QUIC:     q,
-		ReadFlow: f,
+		QUIC:  q,
+		queue: q.flow(id),
 	}, nil
 }
 
+func (q *QUIC) Capabilities() Capability {
+	if q.config.StreamMapping != DatagramMapping {
+		// Media streams are reported as neither acked nor free for other
+		// data, all incoming streams are read as media.
+		return Flows
+	}
+	return Acks | Streams | Flows
+}
+
+// MaxPacketSize returns the largest RTP packet which fits into a single
+// datagram, limited by the configured MTU. Packets sent on streams are
+// limited to the same size, so that the stream mapping does not change the
+// packetization.
+func (q *QUIC) MaxPacketSize() int {
+	size := quicMaxPacketSize(q.quicSession.RemoteAddr())
+	if q.config.MTU != 0 && q.config.MTU < size {
+		return q.config.MTU
+	}
+	return size
+}
+
 func (q *QUIC) Close() error {
-	return q.rtqSession.Close()
+	err := q.SendControl(&ControlMessage{Type: ControlEOS})
+	if q.listener != nil {
+		if cerr := q.listener.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if q.conn != nil {
+		if cerr := q.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
 func (q *QUIC) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error) {
@@ -141,27 +345,3 @@ func (q *QUIC) AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error)
 func (q *QUIC) OpenUniStream() (quic.SendStream, error) {
 	return q.quicSession.OpenUniStream()
 }
-
-// Setup a bare-bones TLS config for the server
-func generateTLSConfig() *tls.Config {
-	key, err := rsa.GenerateKey(rand.Reader, 1024)
-	if err != nil {
-		panic(err)
-	}
-	template := x509.Certificate{SerialNumber: big.NewInt(1)}
-	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
-	if err != nil {
-		panic(err)
-	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
-	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
-
-	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
-	if err != nil {
-		panic(err)
-	}
-	return &tls.Config{
-		Certificates: []tls.Certificate{tlsCert},
-		NextProtos:   []string{"rtq"},
-	}
-}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+// QUICCongestionControl selects the congestion controller of QUIC
+// connections.
+type QUICCongestionControl string
+
+const (
+	// QUICNoCC disables QUIC congestion control, so that only the media
+	// congestion controller limits the sending rate.
+	QUICNoCC QUICCongestionControl = "none"
+	// QUICNewReno uses NewReno.
+	QUICNewReno QUICCongestionControl = "newreno"
+	// QUICCubic uses Cubic.
+	QUICCubic QUICCongestionControl = "cubic"
+)
+
+// ParseQUICCongestionControl parses the name of a QUIC congestion
+// controller. An empty string selects the default of quic-go, NewReno.
+func ParseQUICCongestionControl(s string) (QUICCongestionControl, error) {
+	switch cc := QUICCongestionControl(strings.ToLower(s)); cc {
+	case "", QUICNoCC, QUICNewReno, QUICCubic:
+		return cc, nil
+	case "nocc":
+		return QUICNoCC, nil
+	default:
+		return "", fmt.Errorf("invalid QUIC congestion controller %q, options: '%v', '%v', '%v'", s, QUICNoCC, QUICNewReno, QUICCubic)
+	}
+}
+
+// QUICConfig holds the connection settings of QUIC sessions. Zero values
+// select the defaults of quic-go.
+type QUICConfig struct {
+	// HandshakeIdleTimeout aborts the handshake if no packet was received
+	// from the peer within this time.
+	HandshakeIdleTimeout time.Duration
+	// MaxIdleTimeout closes the connection if no packet was received from
+	// the peer within this time.
+	MaxIdleTimeout time.Duration
+	// KeepAlive sends packets periodically to keep idle connections open.
+	KeepAlive bool
+	// InitialStreamReceiveWindow and MaxStreamReceiveWindow bound the flow
+	// control window of each stream.
+	InitialStreamReceiveWindow uint64
+	MaxStreamReceiveWindow     uint64
+	// InitialConnectionReceiveWindow and MaxConnectionReceiveWindow bound
+	// the flow control window of the connection.
+	InitialConnectionReceiveWindow uint64
+	MaxConnectionReceiveWindow     uint64
+	// MaxIncomingStreams limits the number of concurrent bidirectional
+	// streams opened by the peer. The control channel uses one of them.
+	MaxIncomingStreams int64
+	// MaxIncomingUniStreams limits the number of concurrent unidirectional
+	// streams opened by the peer, which carry media if the stream mapping
+	// is not DatagramMapping.
+	MaxIncomingUniStreams int64
+	// CongestionControl selects the QUIC congestion controller.
+	CongestionControl QUICCongestionControl
+}
+
+// ConfigureQUIC applies c to the connections of QUIC sessions.
+func ConfigureQUIC(c QUICConfig) Option {
+	return func(config *Config) error {
+		if c.MaxIncomingStreams < 0 {
+			return fmt.Errorf("QUIC sessions require at least one incoming bidirectional stream for the control channel")
+		}
+		if c.MaxStreamReceiveWindow != 0 && c.InitialStreamReceiveWindow > c.MaxStreamReceiveWindow {
+			return fmt.Errorf("initial stream receive window %v exceeds maximum %v", c.InitialStreamReceiveWindow, c.MaxStreamReceiveWindow)
+		}
+		if c.MaxConnectionReceiveWindow != 0 && c.InitialConnectionReceiveWindow > c.MaxConnectionReceiveWindow {
+			return fmt.Errorf("initial connection receive window %v exceeds maximum %v", c.InitialConnectionReceiveWindow, c.MaxConnectionReceiveWindow)
+		}
+		config.QUIC = c
+		return nil
+	}
+}
+
+// apply sets the fields of quicConf configured in c.
+func (c *QUICConfig) apply(quicConf *quic.Config) error {
+	switch c.CongestionControl {
+	case "", QUICNewReno:
+		quicConf.CongestionControl = quic.CongestionControlNewReno
+	case QUICCubic:
+		quicConf.CongestionControl = quic.CongestionControlCubic
+	case QUICNoCC:
+		quicConf.CongestionControl = quic.CongestionControlNone
+	default:
+		return fmt.Errorf("invalid QUIC congestion controller %q", c.CongestionControl)
+	}
+	quicConf.HandshakeIdleTimeout = c.HandshakeIdleTimeout
+	quicConf.MaxIdleTimeout = c.MaxIdleTimeout
+	quicConf.KeepAlive = c.KeepAlive
+	quicConf.InitialStreamReceiveWindow = c.InitialStreamReceiveWindow
+	quicConf.MaxStreamReceiveWindow = c.MaxStreamReceiveWindow
+	quicConf.InitialConnectionReceiveWindow = c.InitialConnectionReceiveWindow
+	quicConf.MaxConnectionReceiveWindow = c.MaxConnectionReceiveWindow
+	quicConf.MaxIncomingStreams = c.MaxIncomingStreams
+	quicConf.MaxIncomingUniStreams = c.MaxIncomingUniStreams
+	return nil
+}
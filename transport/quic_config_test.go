@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+)
+
+func TestQUICConfigCongestionControl(t *testing.T) {
+	for name, want := range map[string]quic.CongestionControl{
+		"":        quic.CongestionControlNewReno,
+		"newreno": quic.CongestionControlNewReno,
+		"cubic":   quic.CongestionControlCubic,
+		"none":    quic.CongestionControlNone,
+		"nocc":    quic.CongestionControlNone,
+	} {
+		cc, err := ParseQUICCongestionControl(name)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", name, err)
+		}
+		c := QUICConfig{CongestionControl: cc}
+		quicConf := &quic.Config{}
+		if err := c.apply(quicConf); err != nil {
+			t.Fatalf("failed to apply %q: %v", name, err)
+		}
+		if quicConf.CongestionControl != want {
+			t.Errorf("%q selected congestion controller %v, want %v", name, quicConf.CongestionControl, want)
+		}
+	}
+	if _, err := ParseQUICCongestionControl("bbr"); err == nil {
+		t.Error("parsed unknown congestion controller")
+	}
+}
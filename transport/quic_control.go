@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// The control channel of a QUIC session is the first bidirectional stream.
+// It is opened by the dialer, which sends its metadata first. Every message
+// is prefixed by its length as a QUIC variable-length integer. Terminal
+// messages are followed by closing the connection with the error code of
+// the message, so that peers which miss the message still learn why the
+// session ended. The receiver of a terminal message closes the connection
+// as soon as it read the message, the sender waits for that up to
+// controlCloseTimeout before closing the connection itself. Sessions using
+// the legacy RTQ framing have no control channel and only use the error
+// code.
+
+const (
+	// maxControlMessageSize limits the length of a single control message.
+	maxControlMessageSize = 1 << 16
+	// controlCloseTimeout is the time the sender of a terminal message waits
+	// for the peer to close the connection.
+	controlCloseTimeout = 500 * time.Millisecond
+)
+
+func (q *QUIC) openControl() {
+	stream, err := q.quicSession.OpenStream()
+	if err != nil {
+		log.Printf("failed to open control stream: %v", err)
+		return
+	}
+	q.setControl(stream)
+	if err := q.SendControl(q.config.metadataMessage()); err != nil {
+		log.Printf("failed to send session metadata: %v", err)
+	}
+	q.readControl(stream)
+}
+
+func (q *QUIC) acceptControl() {
+	stream, err := q.quicSession.AcceptStream(q.quicSession.Context())
+	if err != nil {
+		return
+	}
+	q.setControl(stream)
+	q.readControl(stream)
+}
+
+func (q *QUIC) setControl(stream quic.Stream) {
+	q.controlMu.Lock()
+	defer q.controlMu.Unlock()
+	q.control = stream
+	close(q.controlReady)
+}
+
+func (q *QUIC) readControl(stream quic.Stream) {
+	r := quicvarint.NewReader(stream)
+	for {
+		length, err := quicvarint.Read(r)
+		if err != nil {
+			return
+		}
+		if length > maxControlMessageSize {
+			q.closeWithMessage(&ControlMessage{Type: ControlError, Code: ProtocolError, Reason: "control message too large"})
+			return
+		}
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			return
+		}
+		m, err := unmarshalControlMessage(buf)
+		if err != nil {
+			q.closeWithMessage(&ControlMessage{Type: ControlError, Code: ProtocolError, Reason: err.Error()})
+			return
+		}
+		q.config.handleControl(q, m)
+		if m.terminal() {
+			q.closeFlows(m.err())
+			q.closeWithMessage(m)
+			return
+		}
+	}
+}
+
+func (q *QUIC) SendControl(m *ControlMessage) error {
+	if m.terminal() {
+		if q.sessionErr() != nil {
+			return q.closeWithMessage(m)
+		}
+		q.closeFlows(m.localErr())
+		// Do not wait for the control channel, the error code of the
+		// connection is enough to end the session.
+		select {
+		case <-q.controlReady:
+			if err := q.writeControl(m); err != nil {
+				log.Printf("failed to send %v control message: %v", m.Type, err)
+				break
+			}
+			select {
+			case <-q.quicSession.Context().Done():
+			case <-time.After(controlCloseTimeout):
+			}
+		default:
+		}
+		return q.closeWithMessage(m)
+	}
+	if q.legacy {
+		return ErrControlUnsupported
+	}
+	select {
+	case <-q.controlReady:
+	case <-q.quicSession.Context().Done():
+		return ErrSessionClosed
+	}
+	return q.writeControl(m)
+}
+
+func (q *QUIC) writeControl(m *ControlMessage) error {
+	buf, err := m.marshal()
+	if err != nil {
+		return err
+	}
+	var msg bytes.Buffer
+	quicvarint.Write(&msg, uint64(len(buf)))
+	msg.Write(buf)
+
+	q.controlMu.Lock()
+	defer q.controlMu.Unlock()
+	if _, err := q.control.Write(msg.Bytes()); err != nil {
+		return quicSessionError(err)
+	}
+	return nil
+}
+
+// closeWithMessage closes the connection with the error code of the
+// terminal message m.
+func (q *QUIC) closeWithMessage(m *ControlMessage) error {
+	code := NoError
+	if m.Type == ControlError {
+		code = m.Code
+	}
+	err := q.quicSession.CloseWithError(quic.ApplicationErrorCode(code), m.Reason)
+	q.closeFlows(m.localErr())
+	return err
+}
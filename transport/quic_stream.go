@@ -0,0 +1,219 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/quicvarint"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// StreamMapping selects how RTP packets are mapped to QUIC.
+type StreamMapping int
+
+const (
+	// DatagramMapping sends every RTP packet in a QUIC datagram.
+	DatagramMapping StreamMapping = iota
+	// FramePerStream sends every media frame on its own unidirectional
+	// stream. A frame ends with an RTP packet with the marker bit set.
+	FramePerStream
+	// GOPPerStream sends every group of pictures on its own unidirectional
+	// stream. A group of pictures starts with a key frame.
+	GOPPerStream
+)
+
+func (m StreamMapping) String() string {
+	switch m {
+	case DatagramMapping:
+		return "datagram"
+	case FramePerStream:
+		return "frame"
+	case GOPPerStream:
+		return "gop"
+	default:
+		return fmt.Sprintf("mapping(%d)", int(m))
+	}
+}
+
+// ParseStreamMapping returns the StreamMapping named s.
+func ParseStreamMapping(s string) (StreamMapping, error) {
+	for _, m := range []StreamMapping{DatagramMapping, FramePerStream, GOPPerStream} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown stream mapping: %v", s)
+}
+
+// streamErrorDeadlineExceeded is used to reset streams which were not
+// delivered before their deadline.
+const streamErrorDeadlineExceeded quic.StreamErrorCode = 0x1
+
+// maxStreamPacketSize limits the length of a single packet read from a stream.
+const maxStreamPacketSize = 1 << 16
+
+// StreamWriteFlowCloser sends RTP packets on QUIC streams according to the
+// configured StreamMapping. Each stream starts with the flow ID followed by
+// the RTP packets, each prefixed by its length. Both the flow ID and the
+// length are encoded as QUIC variable-length integers. RTCP packets are sent
+// in datagrams.
+type StreamWriteFlowCloser struct {
+	*QUIC
+
+	flowID   uint64
+	mapping  StreamMapping
+	deadline time.Duration
+	keyFrame KeyFrameFunc
+
+	m      sync.Mutex
+	stream quic.SendStream
+	// keyFrameTimestamp is the RTP timestamp of the last key frame, which
+	// started the current group of pictures.
+	keyFrameTimestamp uint32
+	keyFrameSeen      bool
+}
+
+func (w *StreamWriteFlowCloser) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	headerBuf, err := header.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	pkt := append(headerBuf, payload...)
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.mapping == GOPPerStream && w.startsGOP(header, payload) && w.stream != nil {
+		w.closeStream()
+	}
+
+	var buf bytes.Buffer
+	if w.stream == nil {
+		if w.stream, err = w.quicSession.OpenUniStream(); err != nil {
+			return 0, fmt.Errorf("failed to open stream: %w", quicSessionError(err))
+		}
+		quicvarint.Write(&buf, w.flowID)
+	}
+	quicvarint.Write(&buf, uint64(len(pkt)))
+	buf.Write(pkt)
+
+	if w.deadline > 0 {
+		if err = w.stream.SetWriteDeadline(time.Now().Add(w.deadline)); err != nil {
+			return 0, err
+		}
+	}
+	if _, err = w.stream.Write(buf.Bytes()); err != nil {
+		w.stream.CancelWrite(streamErrorDeadlineExceeded)
+		w.stream = nil
+		return 0, fmt.Errorf("failed to write to stream: %w", quicSessionError(err))
+	}
+
+	if w.mapping == FramePerStream && header.Marker {
+		w.closeStream()
+	}
+	return len(pkt), nil
+}
+
+// startsGOP reports whether the packet is the first packet of a new key
+// frame. Parameter sets and all fragments of key frames are detected as key
+// frame packets, but only the first one with a new timestamp starts a group
+// of pictures.
+func (w *StreamWriteFlowCloser) startsGOP(header *rtp.Header, payload []byte) bool {
+	if w.keyFrame == nil || !w.keyFrame(payload) {
+		return false
+	}
+	if w.keyFrameSeen && header.Timestamp == w.keyFrameTimestamp {
+		return false
+	}
+	w.keyFrameSeen = true
+	w.keyFrameTimestamp = header.Timestamp
+	return true
+}
+
+// closeStream finishes the current stream and resets it if it is not done
+// before the deadline.
+func (w *StreamWriteFlowCloser) closeStream() {
+	stream := w.stream
+	w.stream = nil
+	if err := stream.Close(); err != nil {
+		log.Printf("failed to close stream %v: %v", stream.StreamID(), err)
+	}
+	if w.deadline > 0 {
+		time.AfterFunc(w.deadline, func() {
+			stream.CancelWrite(streamErrorDeadlineExceeded)
+		})
+	}
+}
+
+func (w *StreamWriteFlowCloser) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	buf, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return 0, err
+	}
+	return len(buf), w.sendDatagram(w.rtcpFlowID(w.flowID), buf, nil)
+}
+
+func (q *QUIC) streamWriter(id uint64) (WriteFlow, error) {
+	return &StreamWriteFlowCloser{
+		QUIC:     q,
+		flowID:   id,
+		mapping:  q.config.StreamMapping,
+		deadline: q.config.StreamDeadline,
+		keyFrame: q.config.KeyFrame,
+	}, nil
+}
+
+func (q *QUIC) acceptStreams() {
+	for {
+		stream, err := q.quicSession.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+		go q.readStream(stream)
+	}
+}
+
+// readStream reads the packets of a single stream until the stream ends or is
+// reset by the sender. Incomplete packets of reset streams are dropped.
+func (q *QUIC) readStream(stream quic.ReceiveStream) {
+	r := quicvarint.NewReader(stream)
+	flowID, err := quicvarint.Read(r)
+	if err != nil {
+		return
+	}
+	flow := q.flow(flowID)
+	for {
+		length, err := quicvarint.Read(r)
+		if err != nil {
+			logStreamError(stream, err)
+			return
+		}
+		if length > maxStreamPacketSize {
+			log.Printf("dropping stream %v: packet of %v bytes too large", stream.StreamID(), length)
+			stream.CancelRead(0)
+			return
+		}
+		pkt := make([]byte, length)
+		if _, err := io.ReadFull(stream, pkt); err != nil {
+			logStreamError(stream, err)
+			return
+		}
+		flow.push(pkt)
+	}
+}
+
+func logStreamError(stream quic.ReceiveStream, err error) {
+	var streamErr *quic.StreamError
+	if errors.Is(err, io.EOF) || errors.As(err, &streamErr) {
+		return
+	}
+	log.Printf("failed to read from stream %v: %v", stream.StreamID(), err)
+}
@@ -0,0 +1,145 @@
+package transport
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/lucas-clemente/quic-go/quicvarint"
+)
+
+// RTP over QUIC framing (https://datatracker.ietf.org/doc/draft-ietf-avtcore-rtp-over-quic/).
+//
+// Every datagram and every stream starts with the flow ID as a QUIC
+// variable-length integer. Datagrams carry a single RTP or RTCP packet after
+// the flow ID, streams carry a sequence of packets, each prefixed by its
+// length as a variable-length integer. RTP and RTCP packets of an RTP session
+// share the same flow ID and are demultiplexed as described in RFC 5761.
+//
+// The legacy framing of RTQ
+// (https://tools.ietf.org/html/draft-hurst-quic-rtp-tunnelling-01) uses the
+// same datagram format, but sends RTCP on a separate flow. To interoperate
+// with RTQ peers, RTP of flow n is sent on flow n and RTCP on flow n+1, where
+// n is even.
+const (
+	// ALPN is the ALPN token of the current RTP over QUIC draft.
+	ALPN = "roq"
+	// LegacyALPN is the ALPN token of the legacy RTQ framing.
+	LegacyALPN = "rtq"
+)
+
+// LegacyFraming restricts the QUIC transport to the legacy RTQ framing
+// instead of offering both framings and preferring the current one.
+func LegacyFraming() Option {
+	return func(c *Config) error {
+		c.LegacyFraming = true
+		return nil
+	}
+}
+
+// alpn returns the ALPN tokens to offer in order of preference.
+func (c *Config) alpn() []string {
+	if len(c.ALPN) > 0 {
+		return c.ALPN
+	}
+	if c.LegacyFraming {
+		return []string{LegacyALPN}
+	}
+	return []string{ALPN, LegacyALPN}
+}
+
+// rtcpFlowID returns the flow ID on which RTCP packets of flow id are sent.
+func (q *QUIC) rtcpFlowID(id uint64) uint64 {
+	if q.legacy {
+		return id + 1
+	}
+	return id
+}
+
+// localFlowID maps a flow ID received from the peer to the flow which reads
+// its packets.
+func (q *QUIC) localFlowID(id uint64) uint64 {
+	if q.legacy {
+		return id &^ 1
+	}
+	return id
+}
+
+func (q *QUIC) flow(id uint64) *packetQueue {
+	q.flowsMu.Lock()
+	defer q.flowsMu.Unlock()
+
+	id = q.localFlowID(id)
+	f, ok := q.flows[id]
+	if !ok {
+		f = newPacketQueue()
+		if q.flowsClosed {
+			f.closeWithError(q.flowsErr)
+		}
+		q.flows[id] = f
+	}
+	return f
+}
+
+// sessionErr returns the error returned by the flows after the session
+// ended, or nil while the session is up.
+func (q *QUIC) sessionErr() error {
+	q.flowsMu.Lock()
+	defer q.flowsMu.Unlock()
+	return q.flowsErr
+}
+
+// closeFlows closes all flows, readers return err once they consumed all
+// packets. Only the error of the first call is kept.
+func (q *QUIC) closeFlows(err error) {
+	q.flowsMu.Lock()
+	defer q.flowsMu.Unlock()
+
+	if q.flowsClosed {
+		return
+	}
+	q.flowsClosed = true
+	q.flowsErr = err
+	for _, f := range q.flows {
+		f.closeWithError(err)
+	}
+}
+
+func (q *QUIC) sendDatagram(flowID uint64, data []byte, notify func(bool)) error {
+	buf := bytes.Buffer{}
+	quicvarint.Write(&buf, flowID)
+	buf.Write(data)
+	var err error
+	if notify != nil {
+		err = q.quicSession.SendMessageNotify(buf.Bytes(), notify)
+	} else {
+		err = q.quicSession.SendMessage(buf.Bytes())
+	}
+	if err != nil {
+		if serr := q.sessionErr(); serr != nil {
+			return serr
+		}
+		return quicSessionError(err)
+	}
+	return nil
+}
+
+func (q *QUIC) receiveDatagrams() {
+	for {
+		message, err := q.quicSession.ReceiveMessage()
+		if err != nil {
+			sessionErr := quicSessionError(err)
+			if sessionErr == err {
+				log.Printf("failed to receive datagram: %v", err)
+			}
+			q.closeFlows(sessionErr)
+			return
+		}
+		reader := bytes.NewReader(message)
+		flowID, err := quicvarint.Read(reader)
+		if err != nil {
+			log.Printf("failed to parse flow identifier from datagram of length %v: %v", len(message), err)
+			continue
+		}
+		q.flow(flowID).push(message[len(message)-reader.Len():])
+	}
+}
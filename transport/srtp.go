@@ -0,0 +1,184 @@
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/pion/srtp/v2"
+)
+
+const (
+	// SRTPKeyLen is the length of a pre-shared SRTP master key followed by
+	// the master salt for the AES_CM_128_HMAC_SHA1_80 protection profile.
+	SRTPKeyLen = srtpMasterKeyLen + srtpMasterSaltLen
+
+	srtpProfile       = srtp.ProtectionProfileAes128CmHmacSha1_80
+	srtpMasterKeyLen  = 16
+	srtpMasterSaltLen = 14
+
+	// srtpOverhead is the number of bytes SRTP adds to RTP packets.
+	srtpOverhead = 10
+	// srtcpOverhead is the number of bytes SRTCP adds to RTCP packets,
+	// the SRTCP index followed by the authentication tag.
+	srtcpOverhead = 4 + 10
+
+	// srtpReplayWindow is the number of indices below the highest received
+	// index which are accepted once, see RFC 3711 section 3.3.2.
+	srtpReplayWindow = 64
+)
+
+// SRTPKeys protects RTP, RTCP and control packets sent on UDP sessions
+// with SRTP and SRTCP (RFC 3711) using pre-shared master keys, like keys
+// exchanged by SDES (RFC 4568). The client encrypts with clientKey and the
+// server with serverKey, each key is a master key followed by the master
+// salt and must be SRTPKeyLen bytes long. Both endpoints must be configured
+// with the same pair of keys.
+func SRTPKeys(clientKey, serverKey []byte) Option {
+	return func(c *Config) error {
+		for _, key := range [][]byte{clientKey, serverKey} {
+			if len(key) != SRTPKeyLen {
+				return fmt.Errorf("SRTP key must be %v bytes, got %v", SRTPKeyLen, len(key))
+			}
+		}
+		c.SRTPClientKey = clientKey
+		c.SRTPServerKey = serverKey
+		return nil
+	}
+}
+
+// ParseSRTPKey decodes a base64 encoded SRTP master key and salt, as used in
+// the inline key parameters of SDES (RFC 4568).
+func ParseSRTPKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRTP key: %w", err)
+	}
+	if len(key) != SRTPKeyLen {
+		return nil, fmt.Errorf("SRTP key must be %v bytes, got %v", SRTPKeyLen, len(key))
+	}
+	return key, nil
+}
+
+// srtpSession encrypts outgoing and decrypts incoming packets. An
+// srtp.Context keeps the state of one direction and is not safe for
+// concurrent use, so each direction has its own context and lock. Incoming
+// packets are checked against a replay window.
+type srtpSession struct {
+	encryptMu sync.Mutex
+	encrypt   *srtp.Context
+
+	decryptMu sync.Mutex
+	decrypt   *srtp.Context
+}
+
+func newSRTPSession(clientKey, serverKey []byte, client bool) (*srtpSession, error) {
+	local, remote := serverKey, clientKey
+	if client {
+		local, remote = clientKey, serverKey
+	}
+	encrypt, err := srtp.CreateContext(local[:srtpMasterKeyLen], local[srtpMasterKeyLen:], srtpProfile)
+	if err != nil {
+		return nil, err
+	}
+	decrypt, err := srtp.CreateContext(remote[:srtpMasterKeyLen], remote[srtpMasterKeyLen:], srtpProfile,
+		srtp.SRTPReplayProtection(srtpReplayWindow),
+		srtp.SRTCPReplayProtection(srtpReplayWindow),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &srtpSession{
+		encrypt: encrypt,
+		decrypt: decrypt,
+	}, nil
+}
+
+func (s *srtpSession) encryptRTP(buf []byte) ([]byte, error) {
+	s.encryptMu.Lock()
+	defer s.encryptMu.Unlock()
+	return s.encrypt.EncryptRTP(nil, buf, nil)
+}
+
+func (s *srtpSession) encryptRTCP(buf []byte) ([]byte, error) {
+	s.encryptMu.Lock()
+	defer s.encryptMu.Unlock()
+	return s.encrypt.EncryptRTCP(nil, buf, nil)
+}
+
+// decryptPacket decrypts the SRTP or SRTCP packet in buf and returns the
+// plain packet.
+func (s *srtpSession) decryptPacket(buf []byte) ([]byte, error) {
+	s.decryptMu.Lock()
+	defer s.decryptMu.Unlock()
+
+	if !IsRTCP(buf) {
+		return s.decrypt.DecryptRTP(nil, buf, nil)
+	}
+	// srtp.Context returns SRTCP packets whose encryption flag is not set
+	// without checking their authentication tag, all packets sent by
+	// encryptRTCP are encrypted.
+	if len(buf) < srtcpOverhead || buf[len(buf)-srtcpOverhead]>>7 == 0 {
+		return nil, errors.New("unencrypted SRTCP packet")
+	}
+	return s.decrypt.DecryptRTCP(nil, buf, nil)
+}
+
+const (
+	// rtcpTypeApp is the packet type of RTCP APP packets (RFC 3550 section
+	// 6.7).
+	rtcpTypeApp = 204
+	// rtcpAppHeaderLen is the length of the header of an APP packet up to
+	// its application-dependent data.
+	rtcpAppHeaderLen = 12
+)
+
+// controlAppName is the name of the RTCP APP packets which carry control
+// packets if SRTP is enabled.
+var controlAppName = [4]byte{'R', 'T', 'Q', 'C'}
+
+// marshalControlApp returns an RTCP APP packet which carries the control
+// packet buf, padded to a multiple of four bytes, and is at least size
+// bytes long once it is protected with SRTCP.
+func marshalControlApp(buf []byte, size int) []byte {
+	length := rtcpAppHeaderLen + len(buf)
+	if length < size-srtcpOverhead {
+		length = size - srtcpOverhead
+	}
+	length = (length + 3) &^ 3
+
+	out := make([]byte, length)
+	out[0] = 2 << 6
+	out[1] = rtcpTypeApp
+	binary.BigEndian.PutUint16(out[2:], uint16(length/4-1))
+	// The SSRC field is left zero, control packets are not related to
+	// any stream.
+	copy(out[8:], controlAppName[:])
+	n := copy(out[rtcpAppHeaderLen:], buf)
+	// Trailing white space is ignored by the JSON decoder.
+	for i := rtcpAppHeaderLen + n; i < length; i++ {
+		out[i] = ' '
+	}
+	return out
+}
+
+// unmarshalControlApp returns the control packet carried by the RTCP APP
+// packet buf and false if buf is any other RTCP packet.
+func unmarshalControlApp(buf []byte) ([]byte, bool) {
+	if len(buf) < rtcpAppHeaderLen+1 || buf[1] != rtcpTypeApp || string(buf[8:12]) != string(controlAppName[:]) {
+		return nil, false
+	}
+	if int(binary.BigEndian.Uint16(buf[2:])+1)*4 != len(buf) {
+		return nil, false
+	}
+	data := buf[rtcpAppHeaderLen:]
+	return data, isControlPacket(data)
+}
+
+// IsRTCP distinguishes RTCP from RTP packets by the payload type field as
+// described in RFC 5761.
+func IsRTCP(buf []byte) bool {
+	return len(buf) > 1 && buf[1] >= 192 && buf[1] <= 223
+}
@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/srtp/v2"
+)
+
+func newTestSRTPKeys(t *testing.T) (clientKey, serverKey []byte) {
+	t.Helper()
+	clientKey = make([]byte, SRTPKeyLen)
+	serverKey = make([]byte, SRTPKeyLen)
+	if _, err := rand.Read(clientKey); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rand.Read(serverKey); err != nil {
+		t.Fatal(err)
+	}
+	return clientKey, serverKey
+}
+
+// newTestSRTPPair returns a client and a server UDP session which only have
+// their SRTP sessions set up.
+func newTestSRTPPair(t *testing.T) (*UDP, *UDP) {
+	t.Helper()
+	clientKey, serverKey := newTestSRTPKeys(t)
+	client, err := newSRTPSession(clientKey, serverKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newSRTPSession(clientKey, serverKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UDP{srtp: client}, &UDP{srtp: server}
+}
+
+// TestSRTPStandardPeer checks that each endpoint encrypts with its own
+// master key as any RFC 3711 implementation configured with the same keys
+// expects.
+func TestSRTPStandardPeer(t *testing.T) {
+	clientKey, serverKey := newTestSRTPKeys(t)
+	for _, client := range []bool{true, false} {
+		s, err := newSRTPSession(clientKey, serverKey, client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		local, remote := serverKey, clientKey
+		if client {
+			local, remote = clientKey, serverKey
+		}
+		peerDecrypt, err := srtp.CreateContext(local[:srtpMasterKeyLen], local[srtpMasterKeyLen:], srtpProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peerEncrypt, err := srtp.CreateContext(remote[:srtpMasterKeyLen], remote[srtpMasterKeyLen:], srtpProfile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		plain, err := (&rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: 1, SSRC: 1},
+			Payload: []byte("payload"),
+		}).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := s.encryptRTP(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(encrypted) != len(plain)+srtpOverhead {
+			t.Errorf("SRTP packet of %v bytes, want %v", len(encrypted), len(plain)+srtpOverhead)
+		}
+		decrypted, err := peerDecrypt.DecryptRTP(nil, encrypted, nil)
+		if err != nil {
+			t.Fatalf("peer failed to decrypt SRTP packet: %v", err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("peer decrypted %x, want %x", decrypted, plain)
+		}
+
+		plain, err = rtcp.Marshal([]rtcp.Packet{&rtcp.PictureLossIndication{SenderSSRC: 2, MediaSSRC: 1}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err = peerEncrypt.EncryptRTCP(nil, plain, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decrypted, err = s.decryptPacket(encrypted)
+		if err != nil {
+			t.Fatalf("failed to decrypt SRTCP packet of peer: %v", err)
+		}
+		if !bytes.Equal(decrypted, plain) {
+			t.Errorf("decrypted %x, want %x", decrypted, plain)
+		}
+	}
+}
+
+func TestSRTPControlReplay(t *testing.T) {
+	client, server := newTestSRTPPair(t)
+
+	buf, err := client.marshalControl(&ControlMessage{Type: ControlEOS}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsRTCP(buf) {
+		t.Fatal("control packet is not sent as SRTCP")
+	}
+	_, m, err := server.openPacket(append([]byte(nil), buf...))
+	if err != nil {
+		t.Fatalf("failed to open control packet: %v", err)
+	}
+	if m == nil || m.Type != ControlEOS {
+		t.Fatalf("opened %v, want EOS", m)
+	}
+	if _, _, err := server.openPacket(append([]byte(nil), buf...)); err == nil {
+		t.Error("accepted replayed control packet")
+	}
+
+	// Packets sent after the replayed one are still accepted.
+	buf, err = client.marshalControl(&ControlMessage{Type: ControlEOS}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.openPacket(buf); err != nil {
+		t.Errorf("failed to open next control packet: %v", err)
+	}
+}
+
+func TestSRTPRejectsUnprotectedControl(t *testing.T) {
+	client, server := newTestSRTPPair(t)
+
+	plain, err := marshalControlPacket(&ControlMessage{Type: ControlEOS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.openPacket(plain); err == nil {
+		t.Error("accepted unprotected control packet")
+	}
+
+	// An SRTCP packet without the encryption flag is not authenticated by
+	// srtp.Context and must be rejected.
+	buf, err := client.marshalControl(&ControlMessage{Type: ControlEOS}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := marshalControlApp(plain, 0)
+	forged := append(app, make([]byte, srtcpOverhead)...)
+	if _, _, err := server.openPacket(forged); err == nil {
+		t.Error("accepted unencrypted SRTCP control packet")
+	}
+
+	buf[len(buf)-1] ^= 1
+	if _, _, err := server.openPacket(buf); err == nil {
+		t.Error("accepted control packet with invalid authentication tag")
+	}
+}
+
+func TestSRTPControlPadding(t *testing.T) {
+	client, server := newTestSRTPPair(t)
+	for _, size := range []int{0, 1200, 1201, 1202, 1203, 1472} {
+		buf, err := client.marshalControl(&ControlMessage{Type: ControlProbe}, size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(buf) < size || len(buf) > size+3 && size > 0 {
+			t.Errorf("control packet of %v bytes padded to %v", size, len(buf))
+		}
+		_, m, err := server.openPacket(buf)
+		if err != nil {
+			t.Fatalf("failed to open padded control packet: %v", err)
+		}
+		if m.Type != ControlProbe {
+			t.Errorf("opened %v, want probe", m.Type)
+		}
+	}
+}
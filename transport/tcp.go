@@ -0,0 +1,259 @@
+package transport
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"sync"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+func init() {
+	Register("tcp", func(addr string, opts ...Option) (Session, error) {
+		return NewTCPClient(addr, opts...)
+	}, func(addr string, opts ...Option) (Session, error) {
+		return NewTCPServer(addr, opts...)
+	})
+}
+
+// TCP carries RTP and RTCP over a single TCP connection using the framing
+// defined in RFC 4571: every packet is prefixed by its length as a 16 bit
+// unsigned integer in network byte order. Like UDP, TCP does not distinguish
+// flows, all writers and readers share the connection.
+type TCP struct {
+	net.Conn
+	config *Config
+
+	writeMu sync.Mutex
+	reader  *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+func NewTCPServer(addr string, opts ...Option) (*TCP, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return newTCP(conn, config), nil
+}
+
+func NewTCPClient(addr string, opts ...Option) (*TCP, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	t := newTCP(conn, config)
+	if err := t.SendControl(config.metadataMessage()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send session metadata: %w", err)
+	}
+	return t, nil
+}
+
+func newTCP(conn net.Conn, config *Config) *TCP {
+	return &TCP{
+		Conn:   conn,
+		config: config,
+		reader: bufio.NewReader(conn),
+	}
+}
+
+func (t *TCP) Writer(id uint64) (WriteFlow, error) {
+	return &TCPWriteFlowCloser{TCP: t}, nil
+}
+
+func (t *TCP) Reader(id uint64) (ReadFlow, error) {
+	return &TCPReadFlowCloser{TCP: t}, nil
+}
+
+func (t *TCP) Capabilities() Capability {
+	return 0
+}
+
+// MaxPacketSize returns the configured MTU. Since packets are framed, it
+// only limits the packet size to what the peer expects to read.
+func (t *TCP) MaxPacketSize() int {
+	return t.config.mtu(DefaultMTU)
+}
+
+func (t *TCP) SendControl(m *ControlMessage) error {
+	if t.isClosed() {
+		return ErrSessionClosed
+	}
+	buf, err := marshalControlPacket(m)
+	if err != nil {
+		return err
+	}
+	if !m.terminal() {
+		if err := t.sessionErr(); err != nil {
+			return err
+		}
+		_, err = t.writeFrame(buf)
+		return err
+	}
+
+	if t.sessionErr() == nil {
+		_, err = t.writeFrame(buf)
+	}
+	t.end(m.localErr(), true)
+	if cerr := t.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close ends the session by sending a ControlEOS message.
+func (t *TCP) Close() error {
+	if t.isClosed() {
+		return nil
+	}
+	return t.SendControl(&ControlMessage{Type: ControlEOS})
+}
+
+// end records the error returned by all flows after the session ended and
+// whether the connection was closed. Only the first error is kept.
+func (t *TCP) end(err error, closed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.closed = t.closed || closed
+}
+
+func (t *TCP) sessionErr() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *TCP) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+// writeFrame writes buf as a single RFC 4571 frame.
+func (t *TCP) writeFrame(buf []byte) (int, error) {
+	if len(buf) > math.MaxUint16 {
+		return 0, fmt.Errorf("packet of %v bytes exceeds maximum RFC 4571 frame size", len(buf))
+	}
+	frame := make([]byte, 2+len(buf))
+	binary.BigEndian.PutUint16(frame, uint16(len(buf)))
+	copy(frame[2:], buf)
+
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+
+	if _, err := t.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// readFrame reads the next RFC 4571 frame into p. If p is too small to hold
+// the frame, the frame is discarded and io.ErrShortBuffer is returned.
+func (t *TCP) readFrame(p []byte) (int, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(t.reader, length[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint16(length[:]))
+	if n > len(p) {
+		if _, err := t.reader.Discard(n); err != nil {
+			return 0, err
+		}
+		return 0, io.ErrShortBuffer
+	}
+	return io.ReadFull(t.reader, p[:n])
+}
+
+type TCPWriteFlowCloser struct {
+	*TCP
+}
+
+func (t *TCPWriteFlowCloser) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if err := t.sessionErr(); err != nil {
+		return 0, err
+	}
+	headerBuf, err := header.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	return t.writeFrame(append(headerBuf, payload...))
+}
+
+func (t *TCPWriteFlowCloser) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	if err := t.sessionErr(); err != nil {
+		return 0, err
+	}
+	buf, err := rtcp.Marshal(pkts)
+	if err != nil {
+		return 0, err
+	}
+	return t.writeFrame(buf)
+}
+
+func (t *TCPWriteFlowCloser) Close() error {
+	return t.TCP.Close()
+}
+
+type TCPReadFlowCloser struct {
+	*TCP
+}
+
+// Read returns the next RTP or RTCP packet. Control packets are passed to
+// the ControlHandler of the session.
+func (t *TCPReadFlowCloser) Read(p []byte) (int, error) {
+	for {
+		if err := t.sessionErr(); err != nil {
+			return 0, err
+		}
+		n, err := t.readFrame(p)
+		if err != nil {
+			if serr := t.sessionErr(); serr != nil {
+				return 0, serr
+			}
+			return 0, err
+		}
+		if !isControlPacket(p[:n]) {
+			return n, nil
+		}
+		m, err := unmarshalControlPacket(p[:n])
+		if err != nil {
+			log.Printf("dropping invalid control packet: %v", err)
+			continue
+		}
+		t.config.handleControl(t.TCP, m)
+		if m.terminal() {
+			t.end(m.err(), false)
+		}
+	}
+}
+
+func (t *TCPReadFlowCloser) Close() error {
+	return t.TCP.Close()
+}
@@ -0,0 +1,190 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// newTestTCPPair returns two TCP sessions connected by net.Pipe. Control
+// messages received by the second session are sent on the returned
+// channel.
+func newTestTCPPair(t *testing.T) (*TCP, *TCP, <-chan *ControlMessage) {
+	t.Helper()
+	a, b := net.Pipe()
+	control := make(chan *ControlMessage, 10)
+	config, err := newConfig(ControlHandler(func(_ Session, m *ControlMessage) {
+		control <- m
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := newTCP(a, &Config{}), newTCP(b, config)
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return client, server, control
+}
+
+// writeAsync runs write in a new goroutine, since writes to a net.Pipe block
+// until they are read. The returned channel receives the error of write.
+func writeAsync(write func() error) <-chan error {
+	errC := make(chan error, 1)
+	go func() {
+		errC <- write()
+	}()
+	return errC
+}
+
+func TestTCPFraming(t *testing.T) {
+	client, server, _ := newTestTCPPair(t)
+	w, _ := client.Writer(0)
+	header := &rtp.Header{Version: 2, PayloadType: 96, SequenceNumber: 7, SSRC: 1}
+	payload := []byte("payload")
+	errC := writeAsync(func() error {
+		_, err := w.WriteRTP(header, payload)
+		return err
+	})
+
+	// Each packet is prefixed by its length in network byte order.
+	var length [2]byte
+	if _, err := io.ReadFull(server.Conn, length[:]); err != nil {
+		t.Fatal(err)
+	}
+	want, err := (&rtp.Packet{Header: *header, Payload: payload}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := binary.BigEndian.Uint16(length[:]); int(n) != len(want) {
+		t.Fatalf("frame length %v, want %v", n, len(want))
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(server.Conn, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("frame %x, want %x", got, want)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.writeFrame(make([]byte, 1<<16)); err == nil {
+		t.Error("wrote a frame larger than the 16 bit length allows")
+	}
+}
+
+func TestTCPReadFrameShortBuffer(t *testing.T) {
+	client, server, _ := newTestTCPPair(t)
+	errC := writeAsync(func() error {
+		for _, size := range []int{100, 10} {
+			if _, err := client.writeFrame(bytes.Repeat([]byte{0x80}, size)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	r, _ := server.Reader(0)
+	buf := make([]byte, 50)
+	if _, err := r.Read(buf); !errors.Is(err, io.ErrShortBuffer) {
+		t.Fatalf("read of oversized frame returned %v, want %v", err, io.ErrShortBuffer)
+	}
+	// The oversized frame was discarded, the next read starts at the next
+	// frame.
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Errorf("read frame of %v bytes, want 10", n)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTCPControlInStream(t *testing.T) {
+	client, server, control := newTestTCPPair(t)
+	w, _ := client.Writer(0)
+	errC := writeAsync(func() error {
+		if _, err := w.WriteRTP(&rtp.Header{Version: 2, SequenceNumber: 1}, nil); err != nil {
+			return err
+		}
+		if err := client.SendControl(&ControlMessage{Type: ControlStats, Stats: map[string]float64{"loss-rate": 0.5}}); err != nil {
+			return err
+		}
+		_, err := w.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: 1}})
+		return err
+	})
+
+	r, _ := server.Reader(0)
+	buf := make([]byte, DefaultMTU)
+	n, err := r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsRTCP(buf[:n]) {
+		t.Fatal("read RTCP packet, want RTP packet first")
+	}
+	// The control packet between both packets is passed to the handler
+	// instead of the reader.
+	n, err = r.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsRTCP(buf[:n]) {
+		t.Errorf("read %x, want RTCP packet", buf[:n])
+	}
+	m := <-control
+	if m.Type != ControlStats || m.Stats["loss-rate"] != 0.5 {
+		t.Errorf("received control message %+v, want stats", m)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTCPEndOfStream(t *testing.T) {
+	client, server, control := newTestTCPPair(t)
+	w, _ := client.Writer(0)
+	errC := writeAsync(func() error {
+		if _, err := w.WriteRTP(&rtp.Header{Version: 2}, nil); err != nil {
+			return err
+		}
+		return client.Close()
+	})
+
+	r, _ := server.Reader(0)
+	buf := make([]byte, DefaultMTU)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("failed to read packet sent before EOS: %v", err)
+	}
+	if _, err := r.Read(buf); !errors.Is(err, ErrEndOfStream) {
+		t.Errorf("read after EOS returned %v, want %v", err, ErrEndOfStream)
+	}
+	if m := <-control; m.Type != ControlEOS {
+		t.Errorf("received control message %v, want EOS", m.Type)
+	}
+	if err := <-errC; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.WriteRTP(&rtp.Header{Version: 2}, nil); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("write after close returned %v, want %v", err, ErrSessionClosed)
+	}
+	cr, _ := client.Reader(0)
+	if _, err := cr.Read(buf); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("local read after close returned %v, want %v", err, ErrSessionClosed)
+	}
+	if err := server.SendControl(&ControlMessage{Type: ControlStats}); !errors.Is(err, ErrEndOfStream) {
+		t.Errorf("control message after EOS returned %v, want %v", err, ErrEndOfStream)
+	}
+}
@@ -0,0 +1,275 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TLSCertificate makes the server present the certificate chain and key
+// loaded from the given PEM files instead of an ephemeral self-signed
+// certificate.
+func TLSCertificate(certFile, keyFile string) Option {
+	return func(c *Config) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		c.Certificate = &cert
+		return nil
+	}
+}
+
+// TLSRootCAs makes the client verify the server certificate against the CA
+// certificates in the given PEM file instead of the system roots.
+func TLSRootCAs(caFile string) Option {
+	return func(c *Config) error {
+		buf, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("no certificates found in CA bundle %v", caFile)
+		}
+		c.RootCAs = pool
+		return nil
+	}
+}
+
+// TLSPinSHA256 makes the client accept only server certificates with the
+// given SHA-256 fingerprint, written in hex with optional colons. Without
+// TLSRootCAs, a matching pin replaces the verification of the certificate
+// chain, which allows connecting to servers with self-signed certificates.
+func TLSPinSHA256(fingerprint string) Option {
+	return func(c *Config) error {
+		pin, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return fmt.Errorf("invalid SHA-256 fingerprint: %v", fingerprint)
+		}
+		c.Pins = append(c.Pins, pin)
+		return nil
+	}
+}
+
+// TLSInsecureSkipVerify disables the verification of the server
+// certificate. It should only be used for testing.
+func TLSInsecureSkipVerify() Option {
+	return func(c *Config) error {
+		c.InsecureSkipVerify = true
+		return nil
+	}
+}
+
+// NextProtos overrides the ALPN tokens offered in the TLS handshake. The session
+// uses the legacy RTQ framing only if LegacyALPN is negotiated.
+func NextProtos(protos ...string) Option {
+	return func(c *Config) error {
+		if len(protos) == 0 {
+			return errors.New("NextProtos requires at least one protocol")
+		}
+		c.ALPN = protos
+		return nil
+	}
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER encoded certificate
+// in the format accepted by TLSPinSHA256.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// serverTLSConfig returns the TLS config of a QUIC server. If no
+// certificate was configured, an ephemeral self-signed certificate is
+// generated and its fingerprint is logged, so that clients can pin it.
+func (c *Config) serverTLSConfig() (*tls.Config, error) {
+	cert := c.Certificate
+	if cert == nil {
+		der, key, err := selfSignedCertificate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate TLS certificate: %w", err)
+		}
+		cert = &tls.Certificate{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}
+		log.Printf("using self-signed certificate with SHA-256 fingerprint %v", Fingerprint(der))
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{*cert},
+		NextProtos:   c.alpn(),
+	}, nil
+}
+
+// clientTLSConfig returns the TLS config of a QUIC client.
+func (c *Config) clientTLSConfig() *tls.Config {
+	tlsConfig := &tls.Config{
+		RootCAs:            c.RootCAs,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		NextProtos:         c.alpn(),
+	}
+	if len(c.Pins) > 0 {
+		// Chain verification runs before VerifyPeerCertificate, so it only
+		// needs to be skipped if the pin is the only trust anchor.
+		if c.RootCAs == nil {
+			tlsConfig.InsecureSkipVerify = true
+		}
+		tlsConfig.VerifyPeerCertificate = c.verifyPin
+	}
+	return tlsConfig
+}
+
+func (c *Config) verifyPin(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server did not present a certificate")
+	}
+	sum := sha256.Sum256(rawCerts[0])
+	for _, pin := range c.Pins {
+		if bytes.Equal(pin, sum[:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("server certificate fingerprint %x does not match any pin", sum)
+}
+
+// selfSignedCertificate generates a self-signed ECDSA certificate which is
+// valid for one day.
+func selfSignedCertificate() ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certificateTemplate("rtq-go-endpoint", 24*time.Hour)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return der, key, nil
+}
+
+// GenerateCertificates writes a certificate and key for hosts, signed by
+// a local CA, to dir/name.pem and dir/name-key.pem. The CA is read from
+// dir/ca.pem and dir/ca-key.pem, or created there if it does not exist yet,
+// so that several leaf certificates can share a CA. Clients can verify the
+// leaf certificates by passing dir/ca.pem to TLSRootCAs.
+func GenerateCertificates(dir, name string, hosts []string, validFor time.Duration) error {
+	caCert, caKey, err := loadOrCreateCA(dir, validFor)
+	if err != nil {
+		return err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template, err := certificateTemplate(name, validFor)
+	if err != nil {
+		return err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	return writeCertificate(dir, name, der, key)
+}
+
+func loadOrCreateCA(dir string, validFor time.Duration) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+	if _, err := os.Stat(certFile); err == nil {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("CA key in %v is not an ECDSA key", keyFile)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, key, nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template, err := certificateTemplate("rtq-go-endpoint CA", validFor)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeCertificate(dir, "ca", der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+func certificateTemplate(commonName string, validFor time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+	}, nil
+}
+
+// writeCertificate writes der to dir/name.pem and key to dir/name-key.pem.
+func writeCertificate(dir, name string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".pem"), certPEM, 0644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0600)
+}
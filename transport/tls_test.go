@@ -0,0 +1,115 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestListener generates a CA and a server certificate for 127.0.0.1 in a
+// temporary directory and returns a listener presenting the certificate.
+func newTestListener(t *testing.T) (*QUICListener, string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := GenerateCertificates(dir, "server", []string{"127.0.0.1"}, time.Hour); err != nil {
+		t.Fatalf("failed to generate certificates: %v", err)
+	}
+	l, err := NewQUICListener("127.0.0.1:0", TLSCertificate(
+		filepath.Join(dir, "server.pem"),
+		filepath.Join(dir, "server-key.pem"),
+	))
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			if _, err := l.Accept(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+	return l, dir
+}
+
+func serverFingerprint(t *testing.T, dir string) string {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	if err != nil {
+		t.Fatalf("failed to load certificate: %v", err)
+	}
+	return Fingerprint(cert.Certificate[0])
+}
+
+func TestQUICHandshakeGeneratedCertificates(t *testing.T) {
+	l, dir := newTestListener(t)
+	wrongPin := strings.Repeat("00", 32)
+
+	for _, tc := range []struct {
+		name string
+		opts func() []Option
+		ok   bool
+	}{
+		{
+			name: "root CA",
+			opts: func() []Option { return []Option{TLSRootCAs(filepath.Join(dir, "ca.pem"))} },
+			ok:   true,
+		},
+		{
+			name: "pin",
+			opts: func() []Option { return []Option{TLSPinSHA256(serverFingerprint(t, dir))} },
+			ok:   true,
+		},
+		{
+			name: "root CA and pin",
+			opts: func() []Option {
+				return []Option{TLSRootCAs(filepath.Join(dir, "ca.pem")), TLSPinSHA256(serverFingerprint(t, dir))}
+			},
+			ok: true,
+		},
+		{
+			name: "root CA and wrong pin",
+			opts: func() []Option {
+				return []Option{TLSRootCAs(filepath.Join(dir, "ca.pem")), TLSPinSHA256(wrongPin)}
+			},
+		},
+		{
+			name: "wrong pin",
+			opts: func() []Option { return []Option{TLSPinSHA256(wrongPin)} },
+		},
+		{
+			name: "system roots",
+			opts: func() []Option { return nil },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := NewQUICClient(l.Addr().String(), tc.opts()...)
+			if tc.ok && err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+			if !tc.ok && err == nil {
+				q.Close()
+				t.Fatal("handshake succeeded with an untrusted certificate")
+			}
+			if q != nil {
+				q.Close()
+			}
+		})
+	}
+}
+
+func TestQUICHandshakeOtherCA(t *testing.T) {
+	l, _ := newTestListener(t)
+	other := t.TempDir()
+	if err := GenerateCertificates(other, "server", []string{"127.0.0.1"}, time.Hour); err != nil {
+		t.Fatalf("failed to generate certificates: %v", err)
+	}
+	q, err := NewQUICClient(l.Addr().String(), TLSRootCAs(filepath.Join(other, "ca.pem")))
+	if err == nil {
+		q.Close()
+		t.Fatal("handshake succeeded with a certificate of another CA")
+	}
+}
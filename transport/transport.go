@@ -0,0 +1,398 @@
+// Package transport provides the network sessions used to carry RTP and RTCP
+// between sender and receiver.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// Capability describes optional features a Session may support.
+type Capability uint
+
+const (
+	// Acks signals that the write flows of a session implement
+	// AckingWriteFlow and report delivery of each RTP packet.
+	Acks Capability = 1 << iota
+	// Streams signals that the session implements StreamSession and can
+	// carry data on reliable streams next to the media flows.
+	Streams
+	// Flows signals that the session keeps the packets of different flow
+	// IDs apart. Without it, all flows share one stream of packets, which
+	// must be read from a single ReadFlow.
+	Flows
+)
+
+func (c Capability) String() string {
+	switch c {
+	case Acks:
+		return "acks"
+	case Streams:
+		return "streams"
+	case Flows:
+		return "flows"
+	default:
+		return fmt.Sprintf("capability(%d)", uint(c))
+	}
+}
+
+// WriteFlow sends RTP and RTCP packets to the peer of a Session.
+type WriteFlow interface {
+	WriteRTP(header *rtp.Header, payload []byte) (int, error)
+	WriteRTCP(pkts []rtcp.Packet) (int, error)
+	io.Closer
+}
+
+// AckingWriteFlow is a WriteFlow which can notify the caller when a sent RTP
+// packet was acknowledged or declared lost by the transport.
+type AckingWriteFlow interface {
+	WriteFlow
+	WriteRTPNotify(header *rtp.Header, payload []byte, notify func(bool)) (int, error)
+}
+
+// ReadFlow receives packets sent by the peer of a Session.
+type ReadFlow interface {
+	io.ReadCloser
+}
+
+// Session is a connection between two endpoints which multiplexes several
+// flows identified by an ID.
+type Session interface {
+	// Writer opens the flow with the given ID for writing.
+	Writer(id uint64) (WriteFlow, error)
+	// Reader opens the flow with the given ID for reading.
+	Reader(id uint64) (ReadFlow, error)
+	// Capabilities returns the optional features supported by the session.
+	Capabilities() Capability
+	// MaxPacketSize returns the largest RTP packet which the session sends
+	// in one piece and which the peer can read.
+	MaxPacketSize() int
+	// SendControl sends a message on the control channel of the session.
+	// Sending a ControlEOS or ControlError message ends the session.
+	SendControl(m *ControlMessage) error
+	// Close ends the session by sending a ControlEOS message.
+	Close() error
+}
+
+// StreamSession is a Session which supports reliable unidirectional streams.
+type StreamSession interface {
+	Session
+	OpenUniStream() (quic.SendStream, error)
+	AcceptUniStream(ctx context.Context) (quic.ReceiveStream, error)
+}
+
+// Supports reports whether s supports all capabilities in c.
+func Supports(s Session, c Capability) bool {
+	return s.Capabilities()&c == c
+}
+
+// Config holds the settings shared by all transports. Transports ignore
+// settings which do not apply to them.
+type Config struct {
+	// Tracers are added to the QUIC connection tracer.
+	Tracers []logging.Tracer
+	// Emulation applies an emulated link to all outgoing packets.
+	Emulation *EmulationProfile
+	// StreamMapping selects how QUIC carries RTP packets.
+	StreamMapping StreamMapping
+	// StreamDeadline is the time after which streams which were not
+	// delivered yet are reset. Zero disables resets.
+	StreamDeadline time.Duration
+	// KeyFrame detects the start of a group of pictures for GOPPerStream.
+	KeyFrame KeyFrameFunc
+	// LegacyFraming disables the current RTP over QUIC framing in favor of
+	// the legacy RTQ framing.
+	LegacyFraming bool
+	// ALPN overrides the ALPN tokens offered in the TLS handshake.
+	ALPN []string
+	// Certificate is presented by servers. Servers generate a self-signed
+	// certificate if it is nil.
+	Certificate *tls.Certificate
+	// RootCAs are used by clients to verify the server certificate. The
+	// system roots are used if it is nil.
+	RootCAs *x509.CertPool
+	// Pins are SHA-256 fingerprints of accepted server certificates.
+	Pins [][]byte
+	// InsecureSkipVerify disables the verification of the server
+	// certificate.
+	InsecureSkipVerify bool
+	// ControlHandler is called for received control messages.
+	ControlHandler func(Session, *ControlMessage)
+	// Metadata is sent by dialers when the session is established.
+	Metadata map[string]string
+	// SRTPClientKey and SRTPServerKey are the pre-shared SRTP master keys
+	// and salts used by UDP clients and servers to encrypt their packets.
+	// Packets are sent unencrypted if they are nil.
+	SRTPClientKey []byte
+	SRTPServerKey []byte
+	// ECN is the codepoint of packets sent on UDP sessions.
+	ECN ECN
+	// MTU is the largest packet sent by UDP and TCP sessions and an upper
+	// bound for QUIC sessions. Transports use their default if it is zero.
+	MTU int
+	// ProbeMTU enables path MTU probing on UDP clients.
+	ProbeMTU bool
+	// QUIC holds the connection settings of QUIC sessions.
+	QUIC QUICConfig
+}
+
+// Option can be used to configure a Session when it is created.
+type Option func(*Config) error
+
+// Tracers adds QUIC connection tracers to the session.
+func Tracers(t ...logging.Tracer) Option {
+	return func(c *Config) error {
+		c.Tracers = append(c.Tracers, t...)
+		return nil
+	}
+}
+
+// Emulate passes all packets sent by the session through an emulated link
+// described by profile.
+func Emulate(profile *EmulationProfile) Option {
+	return func(c *Config) error {
+		c.Emulation = profile
+		return nil
+	}
+}
+
+// QUICStreams sends RTP packets on QUIC streams instead of datagrams. Streams
+// which are not done after deadline are reset. keyFrame is required for
+// GOPPerStream to detect the start of a new group of pictures.
+func QUICStreams(mapping StreamMapping, deadline time.Duration, keyFrame KeyFrameFunc) Option {
+	return func(c *Config) error {
+		if mapping == GOPPerStream && keyFrame == nil {
+			return fmt.Errorf("stream mapping %v requires a key frame detector", mapping)
+		}
+		c.StreamMapping = mapping
+		c.StreamDeadline = deadline
+		c.KeyFrame = keyFrame
+		return nil
+	}
+}
+
+// listenPacket opens a UDP socket on addr and wraps it in an EmulatedConn
+// if the config requires link emulation.
+func (c *Config) listenPacket(addr *net.UDPAddr) (net.PacketConn, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if c.Emulation != nil {
+		return NewEmulatedConn(conn, c.Emulation), nil
+	}
+	return conn, nil
+}
+
+func newConfig(opts ...Option) (*Config, error) {
+	c := &Config{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// SessionFactory creates a new Session for the given address.
+type SessionFactory func(addr string, opts ...Option) (Session, error)
+
+// Listener accepts sessions from any number of peers.
+type Listener interface {
+	// Accept waits for the next session.
+	Accept(ctx context.Context) (Session, error)
+	// Close stops accepting sessions. Transports whose sessions share the
+	// socket of the listener also close all accepted sessions.
+	Close() error
+}
+
+// ListenerFactory creates a Listener on addr.
+type ListenerFactory func(addr string, opts ...Option) (Listener, error)
+
+// ErrListenerClosed is returned by Accept after the Listener was closed.
+var ErrListenerClosed = errors.New("listener closed")
+
+type factory struct {
+	dial   SessionFactory
+	listen SessionFactory
+	serve  ListenerFactory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]factory{}
+)
+
+// Register makes a transport available under the given name. dial is used
+// by the sending side to connect to addr and listen is used by the receiving
+// side to wait for a connection on addr. Register panics if a transport with
+// the same name is registered twice.
+func Register(name string, dial, listen SessionFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("transport %v registered twice", name))
+	}
+	registry[name] = factory{
+		dial:   dial,
+		listen: listen,
+	}
+}
+
+// RegisterListener allows the transport registered as name to accept
+// several sessions on the same address. RegisterListener panics if name is
+// not registered or already has a ListenerFactory.
+func RegisterListener(name string, serve ListenerFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	f, ok := registry[name]
+	if !ok {
+		panic(fmt.Sprintf("transport %v is not registered", name))
+	}
+	if f.serve != nil {
+		panic(fmt.Sprintf("listener for transport %v registered twice", name))
+	}
+	f.serve = serve
+	registry[name] = f
+}
+
+// Names returns the sorted names of all registered transports.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (factory, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	f, ok := registry[name]
+	if !ok {
+		return factory{}, fmt.Errorf("unknown transport protocol: %v", name)
+	}
+	return f, nil
+}
+
+// Dial connects to addr using the transport registered as name.
+func Dial(name, addr string, opts ...Option) (Session, error) {
+	f, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.dial(addr, opts...)
+}
+
+// Listen waits for a connection on addr using the transport registered as
+// name.
+func Listen(name, addr string, opts ...Option) (Session, error) {
+	f, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.listen(addr, opts...)
+}
+
+// NewListener accepts sessions on addr using the transport registered as
+// name. Transports without a ListenerFactory accept a single session.
+func NewListener(name, addr string, opts ...Option) (Listener, error) {
+	f, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if f.serve != nil {
+		return f.serve(addr, opts...)
+	}
+	return newSingleSessionListener(func() (Session, error) {
+		return f.listen(addr, opts...)
+	}), nil
+}
+
+// singleSessionListener is the Listener of transports which can only accept
+// a single session. The first call to Accept returns the session, all later
+// calls block until the Listener is closed.
+type singleSessionListener struct {
+	mu      sync.Mutex
+	closed  bool
+	session chan sessionResult
+	done    chan struct{}
+}
+
+type sessionResult struct {
+	session Session
+	err     error
+}
+
+func newSingleSessionListener(listen func() (Session, error)) *singleSessionListener {
+	l := &singleSessionListener{
+		session: make(chan sessionResult, 1),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		s, err := listen()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.closed {
+			if s != nil {
+				s.Close()
+			}
+			return
+		}
+		l.session <- sessionResult{session: s, err: err}
+	}()
+	return l
+}
+
+func (l *singleSessionListener) Accept(ctx context.Context) (Session, error) {
+	select {
+	case r := <-l.session:
+		return r.session, r.err
+	case <-l.done:
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops waiting for the session. A session which was not accepted
+// before Close is closed as soon as it is established.
+func (l *singleSessionListener) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	select {
+	case r := <-l.session:
+		if r.session != nil {
+			r.session.Close()
+		}
+	default:
+	}
+	return nil
+}
@@ -1,116 +1,535 @@
 package transport
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/pion/rtcp"
 	"github.com/pion/rtp"
 )
 
+func init() {
+	Register("udp", func(addr string, opts ...Option) (Session, error) {
+		return NewUDPClient(addr, opts...)
+	}, func(addr string, opts ...Option) (Session, error) {
+		return NewUDPServer(addr, opts...)
+	})
+}
+
+// UDP sends RTP, RTCP and control packets on a single UDP socket. Like TCP,
+// UDP does not distinguish flows, all writers and readers share the socket.
+// If SRTPKeys are configured, RTP and RTCP packets are sent as SRTP and
+// SRTCP, and control packets are sent in SRTCP APP packets. Clients
+// configured with ProbeMTU probe the path MTU before the session is
+// returned.
+//
+// Clients retransmit their metadata until the server acknowledges it, since
+// it may be lost like any other packet. Servers pass only the first copy to
+// the ControlHandler.
+//
+// Clients send to the address they dialed. Servers send to the address of
+// the last packet received from the client, so that they follow clients
+// which reconnect from a new port. If SRTP is enabled, only packets which
+// were authenticated update the address.
 type UDP struct {
-	*net.UDPConn
-	addr    net.Addr
-	writers []*UDPWriteFlowCloser
+	net.PacketConn
+	config *Config
+	srtp   *srtpSession
+	ecn    bool
+	mtu    int
+	client bool
+
+	// metadataAcked is closed when a client receives the acknowledgement
+	// of its metadata.
+	metadataAcked   chan struct{}
+	metadataAckOnce sync.Once
+
+	mu sync.Mutex
+	// addr is the address of the peer, it is nil until a server received
+	// the first packet.
+	addr   net.Addr
+	closed bool
+	err    error
+	// metadata is set when a server received the metadata of the client.
+	metadata bool
 }
 
-func NewUDPServer(addr string) (*UDP, error) {
+const (
+	// udpTerminalRepeat is the number of times terminal control messages
+	// are sent, since they may be lost.
+	udpTerminalRepeat = 3
+	// udpReadBufferSize fits the largest UDP payload.
+	udpReadBufferSize = 1<<16 - 1
+	// udpMetadataInterval is the time between retransmissions of the
+	// metadata of a client until it is acknowledged.
+	udpMetadataInterval = 200 * time.Millisecond
+	// udpMetadataRetransmissions limits the retransmissions of the
+	// metadata, since the acknowledgement is only received while the
+	// session is read.
+	udpMetadataRetransmissions = 25
+)
+
+func NewUDPServer(addr string, opts ...Option) (*UDP, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
 	a, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.ListenUDP("udp", a)
+	conn, err := config.listenPacket(a)
 	if err != nil {
 		return nil, err
 	}
 
-	return &UDP{
-		UDPConn: conn,
-	}, nil
+	u := &UDP{
+		PacketConn: conn,
+		config:     config,
+		mtu:        config.mtu(DefaultMTU),
+	}
+	if config.ProbeMTU {
+		// Clients may probe up to the default upper bound, the read
+		// buffers of the receiver must fit the probed size.
+		u.mtu = config.mtu(udpMaxPacketSize(a))
+	}
+	if err := u.setupECN(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := u.setupSRTP(false); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return u, nil
 }
 
-func NewUDPClient(addr string) (*UDP, error) {
+func NewUDPClient(addr string, opts ...Option) (*UDP, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
 	a, err := net.ResolveUDPAddr("udp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.DialUDP("udp", nil, a)
+	conn, err := config.listenPacket(nil)
 	if err != nil {
 		return nil, err
 	}
-	return &UDP{
-		addr:    a,
-		UDPConn: conn,
+	u := &UDP{
+		PacketConn:    conn,
+		config:        config,
+		mtu:           config.mtu(DefaultMTU),
+		client:        true,
+		addr:          a,
+		metadataAcked: make(chan struct{}),
+	}
+	if err := u.setupECN(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := u.setupSRTP(true); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := u.SendControl(config.metadataMessage()); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send session metadata: %w", err)
+	}
+	go u.retransmitMetadata(config.metadataMessage())
+	if config.ProbeMTU {
+		mtu, err := u.probeMTU(config.mtu(udpMaxPacketSize(a)))
+		if err != nil {
+			u.Close()
+			return nil, fmt.Errorf("failed to probe MTU: %w", err)
+		}
+		log.Printf("using MTU of %v bytes", mtu)
+		u.mtu = mtu
+	}
+	return u, nil
+}
+
+// setupECN enables reading the ECN codepoint of received packets and marks
+// sent packets if configured. Failing to read codepoints is only fatal if
+// marking was requested.
+func (u *UDP) setupECN() error {
+	conn, ok := udpConn(u.PacketConn)
+	if !ok {
+		return nil
+	}
+	if err := setupECN(conn, u.config.ECN); err != nil {
+		if u.config.ECN != NotECT {
+			return fmt.Errorf("failed to setup ECN: %w", err)
+		}
+		log.Printf("failed to enable reading ECN: %v", err)
+		return nil
+	}
+	u.ecn = true
+	if e, ok := u.PacketConn.(*EmulatedConn); ok {
+		e.ecn = u.config.ECN
+	}
+	return nil
+}
+
+// retransmitMetadata sends the metadata m of a client again until the server
+// acknowledges it or the session ends.
+func (u *UDP) retransmitMetadata(m *ControlMessage) {
+	ticker := time.NewTicker(udpMetadataInterval)
+	defer ticker.Stop()
+	for i := 0; i < udpMetadataRetransmissions; i++ {
+		select {
+		case <-u.metadataAcked:
+			return
+		case <-ticker.C:
+		}
+		if u.isClosed() || u.sessionErr() != nil {
+			return
+		}
+		if err := u.SendControl(m); err != nil {
+			log.Printf("failed to retransmit session metadata: %v", err)
+			return
+		}
+	}
+	log.Printf("session metadata was not acknowledged after %v retransmissions", udpMetadataRetransmissions)
+}
+
+// ackMetadata records that the server acknowledged the metadata of a
+// client.
+func (u *UDP) ackMetadata() {
+	if !u.client {
+		return
+	}
+	u.metadataAckOnce.Do(func() {
+		close(u.metadataAcked)
+	})
+}
+
+// firstMetadata reports whether a server received the metadata of the client
+// for the first time.
+func (u *UDP) firstMetadata() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	first := !u.metadata
+	u.metadata = true
+	return first
+}
+
+// sendMetadataAck acknowledges the metadata received from addr.
+func (u *UDP) sendMetadataAck(addr net.Addr) {
+	buf, err := u.marshalControl(&ControlMessage{Type: ControlMetadataAck}, 0)
+	if err != nil {
+		log.Printf("failed to marshal metadata ack: %v", err)
+		return
+	}
+	if _, err := u.WriteTo(buf, addr); err != nil {
+		log.Printf("failed to send metadata ack: %v", err)
+	}
+}
+
+func (u *UDP) setupSRTP(client bool) error {
+	if u.config.SRTPClientKey == nil {
+		return nil
+	}
+	s, err := newSRTPSession(u.config.SRTPClientKey, u.config.SRTPServerKey, client)
+	if err != nil {
+		return fmt.Errorf("failed to setup SRTP: %w", err)
+	}
+	u.srtp = s
+	return nil
+}
+
+func (u *UDP) Writer(id uint64) (WriteFlow, error) {
+	return &UDPWriteFlowCloser{UDP: u}, nil
+}
+
+func (u *UDP) Reader(id uint64) (ReadFlow, error) {
+	return &UDPReadFlowCloser{
+		UDP: u,
+		buf: make([]byte, udpReadBufferSize),
 	}, nil
 }
 
-func (u *UDP) Writer(id uint64) (*UDPWriteFlowCloser, error) {
-	w := UDPWriteFlowCloser{UDP: u}
-	u.writers = append(u.writers, &w)
-	return &w, nil
+// peer returns the address of the peer or nil if it is unknown.
+func (u *UDP) peer() net.Addr {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.addr
 }
 
-func (u *UDP) setAddr(a net.Addr) {
-	u.addr = a
-	for _, w := range u.writers {
-		w.addr = a
+// setPeer makes a server send to the client at addr, from which it received
+// a valid packet. The address of clients never changes.
+func (u *UDP) setPeer(addr net.Addr) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.client || addr == nil {
+		return
 	}
+	if u.addr != nil && u.addr.String() == addr.String() {
+		return
+	}
+	if u.addr != nil {
+		log.Printf("peer address changed from %v to %v", u.addr, addr)
+	}
+	u.addr = addr
 }
 
-func (u *UDP) Reader(id uint64) (*UDPReadFlowCloser, error) {
-	return &UDPReadFlowCloser{UDP: u, setUDPAddr: u.setAddr}, nil
+// writeToPeer writes buf to the peer.
+func (u *UDP) writeToPeer(buf []byte) (int, error) {
+	addr := u.peer()
+	if addr == nil {
+		return 0, errors.New("peer address unknown")
+	}
+	return u.WriteTo(buf, addr)
+}
+
+func (u *UDP) Capabilities() Capability {
+	return 0
+}
+
+// MaxPacketSize returns the MTU minus the SRTP authentication tag.
+func (u *UDP) MaxPacketSize() int {
+	if u.srtp != nil {
+		return u.mtu - srtpOverhead
+	}
+	return u.mtu
+}
+
+func (u *UDP) SendControl(m *ControlMessage) error {
+	if u.isClosed() {
+		return ErrSessionClosed
+	}
+	if !m.terminal() {
+		if err := u.sessionErr(); err != nil {
+			return err
+		}
+		buf, err := u.marshalControl(m, 0)
+		if err != nil {
+			return err
+		}
+		_, err = u.writeToPeer(buf)
+		return err
+	}
+
+	var err error
+	if u.peer() != nil && u.sessionErr() == nil {
+		var buf []byte
+		if buf, err = u.marshalControl(m, 0); err != nil {
+			return err
+		}
+		for i := 0; i < udpTerminalRepeat; i++ {
+			if _, err = u.writeToPeer(buf); err != nil {
+				break
+			}
+		}
+	}
+	u.end(m.localErr(), true)
+	if cerr := u.PacketConn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// marshalControl returns the control packet of m, which is padded to size
+// bytes if it is shorter. If SRTP is enabled, the control packet is sent in
+// an SRTCP APP packet, which may exceed size by up to three bytes, since
+// RTCP packets are a multiple of four bytes long.
+func (u *UDP) marshalControl(m *ControlMessage, size int) ([]byte, error) {
+	buf, err := marshalControlPacket(m)
+	if err != nil {
+		return nil, err
+	}
+	if u.srtp != nil {
+		return u.srtp.encryptRTCP(marshalControlApp(buf, size))
+	}
+	// Trailing white space is ignored by the JSON decoder.
+	for len(buf) < size {
+		buf = append(buf, ' ')
+	}
+	return buf, nil
+}
+
+// openPacket returns the plain RTP or RTCP packet in buf, or the control
+// message if buf is a control packet. If SRTP is enabled, packets which
+// fail to decrypt or were replayed are rejected, and control packets are
+// only accepted in SRTCP APP packets.
+func (u *UDP) openPacket(buf []byte) ([]byte, *ControlMessage, error) {
+	if u.srtp == nil {
+		if isControlPacket(buf) {
+			m, err := unmarshalControlPacket(buf)
+			return nil, m, err
+		}
+		if len(buf) < 2 || buf[0]>>6 != 2 {
+			return nil, nil, errors.New("neither RTP nor RTCP")
+		}
+		return buf, nil, nil
+	}
+	if isControlPacket(buf) {
+		return nil, nil, errors.New("unprotected control packet")
+	}
+	buf, err := u.srtp.decryptPacket(buf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if control, ok := unmarshalControlApp(buf); ok {
+		m, err := unmarshalControlPacket(control)
+		return nil, m, err
+	}
+	return buf, nil, nil
+}
+
+// Close ends the session by sending a ControlEOS message.
+func (u *UDP) Close() error {
+	if u.isClosed() {
+		return nil
+	}
+	return u.SendControl(&ControlMessage{Type: ControlEOS})
+}
+
+// end records the error returned by all flows after the session ended and
+// whether the socket was closed. Only the first error is kept.
+func (u *UDP) end(err error, closed bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.err == nil {
+		u.err = err
+	}
+	u.closed = u.closed || closed
+}
+
+func (u *UDP) sessionErr() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.err
+}
+
+func (u *UDP) isClosed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.closed
 }
 
 type UDPWriteFlowCloser struct {
 	*UDP
-	addr net.Addr
 }
 
 func (u *UDPWriteFlowCloser) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	if err := u.sessionErr(); err != nil {
+		return 0, err
+	}
 	headerBuf, err := header.Marshal()
 	if err != nil {
 		return 0, err
 	}
-	return u.UDP.Write(append(headerBuf, payload...))
+	buf := append(headerBuf, payload...)
+	if u.srtp != nil {
+		if buf, err = u.srtp.encryptRTP(buf); err != nil {
+			return 0, err
+		}
+	}
+	return u.writeToPeer(buf)
 }
 
 func (u *UDPWriteFlowCloser) WriteRTCP(pkts []rtcp.Packet) (int, error) {
+	if err := u.sessionErr(); err != nil {
+		return 0, err
+	}
 	buf, err := rtcp.Marshal(pkts)
 	if err != nil {
 		return 0, err
 	}
-	return u.WriteTo(buf, u.addr)
+	if u.srtp != nil {
+		if buf, err = u.srtp.encryptRTCP(buf); err != nil {
+			return 0, err
+		}
+	}
+	return u.writeToPeer(buf)
 }
 
 func (u *UDPWriteFlowCloser) Close() error {
-	_, err := u.Write([]byte("eos"))
-	if err != nil {
-		return err
-	}
-	return u.UDPConn.Close()
+	return u.UDP.Close()
 }
 
 type UDPReadFlowCloser struct {
 	*UDP
-	addr       net.Addr
-	setUDPAddr func(net.Addr)
+	buf []byte
 }
 
-func (u *UDPReadFlowCloser) Read(p []byte) (n int, err error) {
-	n, addr, err := u.UDPConn.ReadFrom(p)
-	if addr != u.addr {
-		u.addr = addr
-		u.setUDPAddr(addr)
-	}
+// Read returns the next RTP or RTCP packet. Control packets are passed to
+// the ControlHandler of the session. If SRTP is enabled, packets which fail
+// to decrypt or were replayed are dropped. If p is too small to hold the packet, the packet
+// is dropped and io.ErrShortBuffer is returned.
+func (u *UDPReadFlowCloser) Read(p []byte) (int, error) {
+	n, _, err := u.ReadECN(p)
 	return n, err
 }
 
-func (u *UDPReadFlowCloser) Close() error {
-	_, err := u.WriteTo([]byte("eos"), u.addr)
-	if err != nil {
-		return fmt.Errorf("failed to send EOS: %w", err)
+// ReadECN is like Read and additionally returns the ECN codepoint of the
+// packet. It returns NotECT if the platform cannot read codepoints.
+func (u *UDPReadFlowCloser) ReadECN(p []byte) (int, ECN, error) {
+	for {
+		if err := u.sessionErr(); err != nil {
+			return 0, NotECT, err
+		}
+		n, addr, ecn, err := u.readFrom(u.buf)
+		if err != nil {
+			if serr := u.sessionErr(); serr != nil {
+				return 0, NotECT, serr
+			}
+			return 0, NotECT, err
+		}
+		packet, m, err := u.openPacket(u.buf[:n])
+		if err != nil {
+			log.Printf("dropping invalid packet: %v", err)
+			continue
+		}
+		if m == nil {
+			u.setPeer(addr)
+			if len(packet) > len(p) {
+				return 0, ecn, io.ErrShortBuffer
+			}
+			return copy(p, packet), ecn, nil
+		}
+		switch m.Type {
+		case ControlProbe:
+			u.ackProbe(n, addr)
+			continue
+		case ControlProbeAck:
+			// Late acknowledgement of a probe which timed out.
+			continue
+		case ControlMetadataAck:
+			u.ackMetadata()
+			continue
+		}
+		u.setPeer(addr)
+		if m.Type == ControlMetadata {
+			u.sendMetadataAck(addr)
+			if !u.firstMetadata() {
+				continue
+			}
+		}
+		u.config.handleControl(u.UDP, m)
+		if m.terminal() {
+			u.end(m.err(), false)
+		}
 	}
-	return u.UDPConn.Close()
+}
+
+func (u *UDPReadFlowCloser) readFrom(p []byte) (int, net.Addr, ECN, error) {
+	if conn, ok := udpConn(u.PacketConn); ok && u.ecn {
+		return readECN(conn, p)
+	}
+	n, addr, err := u.PacketConn.ReadFrom(p)
+	return n, addr, NotECT, err
+}
+
+func (u *UDPReadFlowCloser) Close() error {
+	return u.UDP.Close()
 }